@@ -1,9 +1,45 @@
 package appconfig
 
-import "github.com/SaiNageswarS/go-api-boot/config"
+import (
+	"time"
+
+	"github.com/SaiNageswarS/go-api-boot/config"
+)
 
 type AppConfig struct {
 	config.BootConfig `ini:",extends"`
 
-	EnableSearchSummarization bool `ini:"enable_search_summarization"`
+	EnableSearchSummarization bool          `ini:"enable_search_summarization"`
+	StripPIIBeforeEmbedding   bool          `ini:"strip_pii_before_embedding"` // Remove patient details from /search queries before they leave the server
+	PromptsDir                string        `ini:"prompts_dir"`                // MCP prompt templates, default "prompts"
+	InstructionsDir           string        `ini:"instructions_dir"`           // Versioned assistant instructions, default "instructions"
+	InstructionsVersion       string        `ini:"instructions_version"`       // Active instructions version, default "v1"
+	PublicURL                 string        `ini:"public_url"`                 // Server URL in the OpenAPI document
+	OAuthIssuer               string        `ini:"oauth_issuer"`               // Enables OAuth for /mcp; expected iss of access tokens
+	OAuthJWKSFile             string        `ini:"oauth_jwks_file"`            // Public signing keys of the issuer (JWKS)
+	OAuthAudience             string        `ini:"oauth_audience"`             // Expected aud, default public_url + "/mcp"
+	OAuthScopeMap             string        `ini:"oauth_scope_map"`            // Token scope to our scope, e.g. "mcp:read=documents:read"
+	RateLimitSearch           int           `ini:"rate_limit_search"`          // Requests per minute per key on search routes, default 30; -1: unlimited
+	RateLimitDocumentsRead    int           `ini:"rate_limit_documents_read"`  // Same for document routes and /mcp, default 120
+	RateLimitCases            int           `ini:"rate_limit_cases"`           // Same for /cases routes, default 60
+	RateLimitAdmin            int           `ini:"rate_limit_admin"`           // Same for /admin routes, default 60
+	DailyQuota                int           `ini:"daily_quota"`                // Requests per key per UTC day; 0: unlimited
+	MCPSessionTimeout         time.Duration `ini:"mcp_session_timeout"`        // Idle MCP sessions are closed after this, default 30m
+	DefaultTenant             string        `ini:"default_tenant"`             // Tenant of keys and requests that name none, default "devinderhealthcare"
+	ControlDatabase           string        `ini:"control_database"`           // Database of API keys, usage and audit events, default "devinderhealthcare"
+	AuditRetention            time.Duration `ini:"audit_retention"`            // Audit events are deleted after this, default 2160h (90 days); negative: kept
+	EmbeddingModel            string        `ini:"embedding_model"`            // Model /search embeds queries with and ingest embeds chunks with, default the only one registered
+	PageIndexDir              string        `ini:"pageindex_dir"`              // Serve PageIndex documents from build_pageindex.py output here instead of MongoDB; MongoDB is still needed for the rest
+
+	Tenants         []Tenant         `ini:"-"` // from the [tenant.<id>] sections, see LoadTenants
+	EmbeddingModels []EmbeddingModel `ini:"-"` // from the [embedding.<id>] sections, see LoadEmbeddingModels
+}
+
+// ControlDB is the database of the API keys, their usage and the audit log,
+// shared by all tenants.
+func (c *AppConfig) ControlDB() string {
+	if c.ControlDatabase != "" {
+		return c.ControlDatabase
+	}
+	return "devinderhealthcare"
 }
@@ -0,0 +1,102 @@
+package appconfig
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-ini/ini"
+)
+
+// embeddingSectionPrefix names the config.ini sections that register
+// embedding models:
+//
+//	[embedding.jina-v4]
+//	provider=jina
+//	model=jina-embeddings-v4
+//	dimensions=2048
+//	query_task=retrieval.query
+//	passage_task=retrieval.passage
+//	collection=chunk_ann_index
+//	index=chunkEmbeddingIndex
+const embeddingSectionPrefix = "embedding."
+
+// embeddingIDPattern keeps model IDs fit for collection names.
+var embeddingIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Defaults of the optional fields of an embedding model.
+const (
+	defaultQueryTask        = "retrieval.query"
+	defaultPassageTask      = "retrieval.passage"
+	defaultVectorCollection = "chunk_ann_index"
+	defaultVectorIndex      = "chunkEmbeddingIndex"
+)
+
+// EmbeddingModel is a model chunks can be embedded with. Each model's vectors
+// live in a collection of their own, so that the vectors of several models,
+// which differ in dimensions, can be kept side by side while switching.
+type EmbeddingModel struct {
+	ID          string `ini:"-"`
+	Provider    string `ini:"provider"`     // client that runs it: jina, ollama or hashing
+	Model       string `ini:"model"`        // the provider's name for it, e.g. jina-embeddings-v4
+	Dimensions  int    `ini:"dimensions"`   // length of its vectors
+	QueryTask   string `ini:"query_task"`   // task of search queries, default retrieval.query
+	PassageTask string `ini:"passage_task"` // task of chunks, default retrieval.passage
+	Collection  string `ini:"collection"`   // holds its vectors, default chunk_ann_index_<id>
+	Index       string `ini:"index"`        // vector index of the collection, default chunkEmbeddingIndex
+}
+
+// DefaultEmbeddingModel is the model of deployments that register none, the
+// one vectors were embedded with before models could be configured.
+var DefaultEmbeddingModel = EmbeddingModel{
+	ID:          "jina-v4",
+	Provider:    "jina",
+	Model:       "jina-embeddings-v4",
+	Dimensions:  2048,
+	QueryTask:   defaultQueryTask,
+	PassageTask: defaultPassageTask,
+	Collection:  defaultVectorCollection,
+	Index:       defaultVectorIndex,
+}
+
+// LoadEmbeddingModels reads the [embedding.<id>] sections of the config file.
+// Like the tenants, they are shared by every ENV.
+func LoadEmbeddingModels(path string) ([]EmbeddingModel, error) {
+	file, err := ini.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var models []EmbeddingModel
+	for _, section := range file.Sections() {
+		id, ok := strings.CutPrefix(section.Name(), embeddingSectionPrefix)
+		if !ok {
+			continue
+		}
+		if !embeddingIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("invalid embedding model ID %q", id)
+		}
+
+		m := EmbeddingModel{ID: id}
+		if err := section.MapTo(&m); err != nil {
+			return nil, fmt.Errorf("embedding model %s: %w", id, err)
+		}
+		if m.Provider == "" || m.Dimensions <= 0 {
+			return nil, fmt.Errorf("embedding model %s: provider and dimensions are required", id)
+		}
+		if m.QueryTask == "" {
+			m.QueryTask = defaultQueryTask
+		}
+		if m.PassageTask == "" {
+			m.PassageTask = defaultPassageTask
+		}
+		if m.Collection == "" {
+			m.Collection = defaultVectorCollection + "_" + id
+		}
+		if m.Index == "" {
+			m.Index = defaultVectorIndex
+		}
+		models = append(models, m)
+	}
+	return models, nil
+}
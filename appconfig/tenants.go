@@ -0,0 +1,64 @@
+package appconfig
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-ini/ini"
+)
+
+// tenantSectionPrefix names the config.ini sections that define tenants:
+//
+//	[tenant.devinderhealthcare]
+//	name=Devinder Healthcare
+//	database=devinderhealthcare
+//	instructions_version=v1
+const tenantSectionPrefix = "tenant."
+
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Tenant is a practice whose materia medica corpus is hosted by this
+// deployment. Each tenant's documents and chunks live in its own database.
+// There is no collection prefix to share one database: odm.CollectionOf names
+// a collection by its model's CollectionName(), which cannot vary per request,
+// and the search indexes and change streams use the same fixed names.
+type Tenant struct {
+	ID                  string `ini:"-"`
+	Name                string `ini:"name"`
+	Database            string `ini:"database"`             // default: the tenant ID
+	InstructionsVersion string `ini:"instructions_version"` // overrides instructions_version
+}
+
+// LoadTenants reads the [tenant.<id>] sections of the config file. Unlike the
+// rest of AppConfig they are shared by every ENV.
+func LoadTenants(path string) ([]Tenant, error) {
+	file, err := ini.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tenants []Tenant
+	for _, section := range file.Sections() {
+		id, ok := strings.CutPrefix(section.Name(), tenantSectionPrefix)
+		if !ok {
+			continue
+		}
+		if !tenantIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("invalid tenant ID %q", id)
+		}
+
+		t := Tenant{ID: id}
+		if err := section.MapTo(&t); err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", id, err)
+		}
+		if t.Database == "" {
+			t.Database = id
+		}
+		if t.Name == "" {
+			t.Name = id
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, nil
+}
@@ -0,0 +1,289 @@
+// Package audit records who read which remedies and searched for what, for
+// clinical accountability.
+package audit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/SaiNageswarS/go-api-boot/logger"
+	"github.com/SaiNageswarS/go-api-boot/odm"
+	"github.com/SaiNageswarS/go-collection-boot/async"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/appconfig"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/redact"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+)
+
+const (
+	ChannelREST = "rest"
+	ChannelMCP  = "mcp"
+
+	// defaultRetention applies when audit_retention is not configured.
+	defaultRetention = 90 * 24 * time.Hour
+
+	// Events are written in batches by one goroutine, so auditing adds no
+	// round trip to requests. When Mongo falls this far behind, events are
+	// dropped (and logged) rather than blocking requests.
+	queueSize    = 4096
+	maxBatchSize = 256
+
+	indexTimeout = time.Minute
+	writeTimeout = 30 * time.Second
+)
+
+// Log writes audit events to audit_events in the control database, where they
+// expire after the retention period.
+type Log struct {
+	coll      *mongo.Collection
+	repo      odm.OdmCollectionInterface[db.AuditEventModel]
+	retention time.Duration // <= 0: kept
+	queue     chan db.AuditEventModel
+
+	closeOnce sync.Once
+	closed    chan struct{} // closed by Close
+	done      chan struct{} // closed by write once the queue is drained
+}
+
+func ProvideLog(ccfg *appconfig.AppConfig, mongo odm.MongoClient) *Log {
+	retention := ccfg.AuditRetention
+	if retention == 0 {
+		retention = defaultRetention
+	}
+
+	database := ccfg.ControlDB()
+	l := &Log{
+		coll:      mongo.Database(database).Collection(db.AuditEventModel{}.CollectionName()),
+		repo:      odm.CollectionOf[db.AuditEventModel](mongo, database),
+		retention: retention,
+		queue:     make(chan db.AuditEventModel, queueSize),
+		closed:    make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), indexTimeout)
+		defer cancel()
+		if err := odm.EnsureIndexes[db.AuditEventModel](ctx, mongo, database); err != nil {
+			logger.Error("Failed to create audit indexes", zap.Error(err))
+		}
+	}()
+	go l.write()
+	return l
+}
+
+// Start begins recording a call by the given key. The returned context carries
+// the Call, so handlers can add the document and result count; Finish queues
+// the event. A nil Log records nothing.
+func (l *Log) Start(ctx context.Context, channel, action, keyID, keyName string) (context.Context, *Call) {
+	if l == nil {
+		return ctx, nil
+	}
+
+	c := &Call{log: l, start: time.Now()}
+	c.event = db.AuditEventModel{
+		Channel: channel,
+		Action:  action,
+		KeyID:   keyID,
+		KeyName: keyName,
+	}
+	return context.WithValue(ctx, callKey{}, c), c
+}
+
+// Filter selects events for Find. Empty fields match everything.
+type Filter struct {
+	KeyID   string
+	Tenant  string
+	Channel string
+	Action  string
+	DocID   string
+	Since   time.Time
+	Until   time.Time
+	Limit   int64
+}
+
+// Find returns the matching events, newest first.
+func (l *Log) Find(ctx context.Context, f Filter) ([]db.AuditEventModel, error) {
+	filter := bson.M{}
+	for field, v := range map[string]string{"keyId": f.KeyID, "tenant": f.Tenant, "channel": f.Channel, "action": f.Action, "docId": f.DocID} {
+		if v != "" {
+			filter[field] = v
+		}
+	}
+	if !f.Since.IsZero() || !f.Until.IsZero() {
+		span := bson.M{}
+		if !f.Since.IsZero() {
+			span["$gte"] = f.Since
+		}
+		if !f.Until.IsZero() {
+			span["$lt"] = f.Until
+		}
+		filter["time"] = span
+	}
+
+	events, err := async.Await(l.repo.Find(ctx, filter, bson.D{{Key: "time", Value: -1}}, f.Limit, 0))
+	if events == nil {
+		events = []db.AuditEventModel{}
+	}
+	return events, err
+}
+
+func (l *Log) enqueue(e db.AuditEventModel) {
+	select {
+	case l.queue <- e:
+	default:
+		logger.Error("Audit queue full, dropping event", zap.String("keyId", e.KeyID), zap.String("action", e.Action), zap.String("docId", e.DocID))
+	}
+}
+
+// Close writes the events still queued and stops the writer, waiting until
+// they are written or ctx is done. Call it once the server has stopped taking
+// requests; events finished after Close are not written. A nil Log is closed.
+func (l *Log) Close(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.closeOnce.Do(func() { close(l.closed) })
+	select {
+	case <-l.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// write inserts queued events, batching whatever has accumulated while the
+// previous batch was written, until Close, when it writes what is left.
+func (l *Log) write() {
+	defer close(l.done)
+	for {
+		select {
+		case e := <-l.queue:
+			l.insert(e)
+		case <-l.closed:
+			for {
+				select {
+				case e := <-l.queue:
+					l.insert(e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// insert writes e with up to maxBatchSize-1 more queued events.
+func (l *Log) insert(e db.AuditEventModel) {
+	batch := []any{e}
+drain:
+	for len(batch) < maxBatchSize {
+		select {
+		case e := <-l.queue:
+			batch = append(batch, e)
+		default:
+			break drain
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+	if _, err := l.coll.InsertMany(ctx, batch); err != nil {
+		logger.Error("Failed to write audit events", zap.Int("count", len(batch)), zap.Error(err))
+	}
+}
+
+// Call is an audit event being recorded. Its methods are safe on a nil Call and
+// from concurrent handlers.
+type Call struct {
+	log   *Log
+	start time.Time
+
+	mu    sync.Mutex
+	event db.AuditEventModel
+	done  bool
+}
+
+type callKey struct{}
+
+func fromContext(ctx context.Context) *Call {
+	c, _ := ctx.Value(callKey{}).(*Call)
+	return c
+}
+
+// SetTenant records the tenant the call was resolved to.
+func (c *Call) SetTenant(id string) {
+	c.update(func(e *db.AuditEventModel) { e.Tenant = id })
+}
+
+// SetArg records an argument of the call, e.g. lines or query, with patient
+// details masked.
+func (c *Call) SetArg(name, value string) {
+	if value == "" {
+		return
+	}
+	value = redact.Mask(value)
+	c.update(func(e *db.AuditEventModel) {
+		if e.Args == nil {
+			e.Args = map[string]string{}
+		}
+		e.Args[name] = value
+	})
+}
+
+// Finish queues the event with the call's outcome: the HTTP status for REST,
+// the error for MCP.
+func (c *Call) Finish(status int, err error) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done {
+		return
+	}
+	c.done = true
+
+	now := time.Now()
+	e := c.event
+	e.ID = bson.NewObjectID().Hex()
+	e.Time = c.start
+	e.LatencyMs = now.Sub(c.start).Milliseconds()
+	e.Status = status
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if c.log.retention > 0 {
+		e.ExpiresAt = c.start.Add(c.log.retention)
+	}
+	c.log.enqueue(e)
+}
+
+func (c *Call) update(f func(*db.AuditEventModel)) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f(&c.event)
+}
+
+// SetDoc records the remedy read by the call in ctx.
+func SetDoc(ctx context.Context, docID string) {
+	fromContext(ctx).update(func(e *db.AuditEventModel) { e.DocID = docID })
+}
+
+// SetArg records an argument of the call in ctx.
+func SetArg(ctx context.Context, name, value string) {
+	fromContext(ctx).SetArg(name, value)
+}
+
+// SetResults records how many documents, nodes or passages the call in ctx
+// returned.
+func SetResults(ctx context.Context, n int) {
+	fromContext(ctx).update(func(e *db.AuditEventModel) { e.ResultCount = n })
+}
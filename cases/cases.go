@@ -0,0 +1,348 @@
+// Package cases keeps the patient cases worked up in consultations, so an
+// assistant that loses its context between conversations can pick a case up
+// again, and searches can be personalised with the case's symptoms.
+package cases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/SaiNageswarS/go-api-boot/logger"
+	"github.com/SaiNageswarS/go-api-boot/odm"
+	"github.com/SaiNageswarS/go-collection-boot/async"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/tenant"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+)
+
+// Categories are the symptom categories, highest ranking first.
+var Categories = []string{"mental", "general", "particular", "modality", "concomitant"}
+
+// Responses are the ways a patient can respond to a remedy, as recorded at a
+// follow-up.
+var Responses = []string{"amelioration", "aggravation", "new_symptoms", "unchanged"}
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 200
+
+	maxItems      = 200  // entries of each list of a case, e.g. symptoms
+	maxTextLength = 2000 // characters per field
+
+	// searchSymptoms is how many symptoms personalise a search; more would
+	// drown out the query itself.
+	searchSymptoms = 8
+
+	// updateAttempts bounds how often Update re-applies a change to a case
+	// that another request saved in the meantime.
+	updateAttempts = 5
+
+	indexTimeout = time.Minute
+)
+
+var (
+	// ErrNotFound is returned for missing cases, and for cases of other keys.
+	ErrNotFound = errors.New("case not found")
+
+	// ErrInvalid wraps validation failures, which are the caller's to fix.
+	ErrInvalid = errors.New("invalid case")
+
+	// ErrConflict is returned when a case kept changing while Update applied
+	// a change to it.
+	ErrConflict = errors.New("case is being changed by another request")
+)
+
+// Summary is a case as listed: enough to pick one, without its contents.
+type Summary struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	PatientRef   string    `json:"patientRef,omitempty"`
+	ChosenRemedy string    `json:"chosenRemedy,omitempty"` // document ID
+	Symptoms     int       `json:"symptoms"`
+	FollowUps    int       `json:"followUps"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// Store reads and writes the cases collection of the request's tenant. Every
+// method is scoped to one API key; a key never sees another's cases.
+type Store struct {
+	mongo odm.MongoClient
+}
+
+func ProvideStore(mongo odm.MongoClient, tenants *tenant.Registry) *Store {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), indexTimeout)
+		defer cancel()
+		for _, database := range tenants.Databases() {
+			if err := odm.EnsureIndexes[db.CaseModel](ctx, mongo, database); err != nil {
+				logger.Error("Failed to create case indexes", zap.String("database", database), zap.Error(err))
+			}
+		}
+	}()
+	return &Store{mongo: mongo}
+}
+
+func (s *Store) repo(ctx context.Context) (odm.OdmCollectionInterface[db.CaseModel], error) {
+	database, err := tenant.Database(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return odm.CollectionOf[db.CaseModel](s.mongo, database), nil
+}
+
+// Create saves a new case for keyID.
+func (s *Store) Create(ctx context.Context, keyID string, c db.CaseModel) (*db.CaseModel, error) {
+	repo, err := s.repo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.ID = bson.NewObjectID().Hex()
+	c.KeyID = keyID
+	c.CreatedOn = 0
+	if err := prepare(&c, time.Now()); err != nil {
+		return nil, err
+	}
+	if _, err := async.Await(repo.Save(ctx, c)); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Get returns keyID's case with the given ID.
+func (s *Store) Get(ctx context.Context, keyID, id string) (*db.CaseModel, error) {
+	repo, err := s.repo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := async.Await(repo.FindOne(ctx, bson.M{"_id": id, "keyId": keyID}))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	return c, err
+}
+
+// Update applies change to keyID's case and saves it. The ID, key and
+// creation time cannot be changed. A changed remedy or potency moves the
+// earlier prescription to PreviousRemedies.
+//
+// The case is replaced only if its updatedAt is still the one read, so that
+// concurrent updates, e.g. two save_case calls appending symptoms, do not
+// overwrite each other; if it is not, change is applied again to the case as
+// now saved. change may therefore run more than once.
+func (s *Store) Update(ctx context.Context, keyID, id string, change func(*db.CaseModel)) (*db.CaseModel, error) {
+	database, err := tenant.Database(ctx)
+	if err != nil {
+		return nil, err
+	}
+	coll := s.mongo.Database(database).Collection(db.CaseModel{}.CollectionName())
+
+	for range updateAttempts {
+		c, err := s.Get(ctx, keyID, id)
+		if err != nil {
+			return nil, err
+		}
+
+		createdOn, read := c.CreatedOn, c.UpdatedAt
+		var previous *db.ChosenRemedy
+		if c.ChosenRemedy != nil {
+			prescribed := *c.ChosenRemedy
+			previous = &prescribed
+		}
+		change(c)
+		c.ID, c.KeyID, c.CreatedOn = id, keyID, createdOn
+		trackPrescription(c, previous)
+		if err := prepare(c, updateTime(read)); err != nil {
+			return nil, err
+		}
+
+		res, err := coll.ReplaceOne(ctx, bson.M{"_id": id, "keyId": keyID, "updatedAt": read}, c)
+		if err != nil {
+			return nil, err
+		}
+		if res.MatchedCount == 1 {
+			return c, nil
+		}
+	}
+	return nil, ErrConflict
+}
+
+// updateTime returns the time to stamp an update of a case last updated at
+// read. MongoDB keeps milliseconds, so the time is advanced past read should
+// both fall in the same millisecond, or the next update could not tell them
+// apart.
+func updateTime(read time.Time) time.Time {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	if !now.After(read) {
+		now = read.Add(time.Millisecond)
+	}
+	return now
+}
+
+// List returns keyID's cases, most recently updated first.
+func (s *Store) List(ctx context.Context, keyID string, limit int64) ([]Summary, error) {
+	repo, err := s.repo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := async.Await(repo.Find(ctx, bson.M{"keyId": keyID}, bson.D{{Key: "updatedAt", Value: -1}}, limit, 0))
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Summary, 0, len(found))
+	for _, c := range found {
+		sum := Summary{
+			ID:         c.ID,
+			Title:      c.Title,
+			PatientRef: c.PatientRef,
+			Symptoms:   len(c.Symptoms),
+			FollowUps:  len(c.FollowUps),
+			UpdatedAt:  c.UpdatedAt,
+		}
+		if c.ChosenRemedy != nil {
+			sum.ChosenRemedy = c.ChosenRemedy.DocID
+		}
+		out = append(out, sum)
+	}
+	return out, nil
+}
+
+// Delete removes keyID's case with the given ID.
+func (s *Store) Delete(ctx context.Context, keyID, id string) error {
+	if _, err := s.Get(ctx, keyID, id); err != nil {
+		return err
+	}
+	repo, err := s.repo(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = async.Await(repo.DeleteOne(ctx, bson.M{"_id": id, "keyId": keyID}))
+	return err
+}
+
+// SearchContext returns the case's leading symptoms, mentals first, for adding
+// to a search query.
+func SearchContext(c *db.CaseModel) string {
+	symptoms := slices.Clone(c.Symptoms)
+	slices.SortStableFunc(symptoms, func(a, b db.CaseSymptom) int {
+		return slices.Index(Categories, a.Category) - slices.Index(Categories, b.Category)
+	})
+
+	texts := make([]string, 0, searchSymptoms)
+	for _, sym := range symptoms[:min(len(symptoms), searchSymptoms)] {
+		texts = append(texts, sym.Text)
+	}
+	return strings.Join(texts, "; ")
+}
+
+// trackPrescription keeps the remedy prescribed before an update in the
+// history if the update changed it, and its date if not.
+func trackPrescription(c *db.CaseModel, previous *db.ChosenRemedy) {
+	if previous == nil {
+		return
+	}
+	current := c.ChosenRemedy
+	if current != nil && strings.EqualFold(strings.TrimSpace(current.DocID), previous.DocID) && current.Potency == previous.Potency {
+		if current.ChosenAt.IsZero() {
+			current.ChosenAt = previous.ChosenAt
+		}
+		return
+	}
+	c.PreviousRemedies = append(c.PreviousRemedies, *previous)
+}
+
+// prepare validates c, normalises categories and remedy IDs, fills in dates
+// left out and stamps the update time.
+func prepare(c *db.CaseModel, now time.Time) error {
+	c.Title = strings.TrimSpace(c.Title)
+	if c.Title == "" {
+		return fmt.Errorf("%w: title is required", ErrInvalid)
+	}
+	if err := checkLength("title", c.Title); err != nil {
+		return err
+	}
+	if err := checkLength("patientRef", c.PatientRef); err != nil {
+		return err
+	}
+	for name, n := range map[string]int{"symptoms": len(c.Symptoms), "citations": len(c.Citations), "followUps": len(c.FollowUps), "previousRemedies": len(c.PreviousRemedies)} {
+		if n > maxItems {
+			return fmt.Errorf("%w: at most %d %s", ErrInvalid, maxItems, name)
+		}
+	}
+	if c.Symptoms == nil {
+		c.Symptoms = []db.CaseSymptom{}
+	}
+
+	for i := range c.Symptoms {
+		sym := &c.Symptoms[i]
+		sym.Text = strings.TrimSpace(sym.Text)
+		sym.Category = strings.ToLower(strings.TrimSpace(sym.Category))
+		if sym.Text == "" {
+			return fmt.Errorf("%w: symptom %d has no text", ErrInvalid, i+1)
+		}
+		if !slices.Contains(Categories, sym.Category) {
+			return fmt.Errorf("%w: symptom %d: category must be one of %s", ErrInvalid, i+1, strings.Join(Categories, ", "))
+		}
+		if err := checkLength("symptom text", sym.Text); err != nil {
+			return err
+		}
+	}
+	for i := range c.Citations {
+		cit := &c.Citations[i]
+		cit.DocID = strings.ToUpper(strings.TrimSpace(cit.DocID))
+		if cit.DocID == "" {
+			return fmt.Errorf("%w: citation %d has no docId", ErrInvalid, i+1)
+		}
+		if err := checkLength("citation note", cit.Note); err != nil {
+			return err
+		}
+	}
+	if r := c.ChosenRemedy; r != nil {
+		r.DocID = strings.ToUpper(strings.TrimSpace(r.DocID))
+		if r.DocID == "" {
+			return fmt.Errorf("%w: chosenRemedy has no docId", ErrInvalid)
+		}
+		if err := checkLength("chosenRemedy reason", r.Reason); err != nil {
+			return err
+		}
+		if r.ChosenAt.IsZero() {
+			r.ChosenAt = now
+		}
+	}
+	for i := range c.FollowUps {
+		f := &c.FollowUps[i]
+		f.Response = strings.ToLower(strings.TrimSpace(f.Response))
+		if strings.TrimSpace(f.Notes) == "" {
+			return fmt.Errorf("%w: follow-up %d has no notes", ErrInvalid, i+1)
+		}
+		if f.Response != "" && !slices.Contains(Responses, f.Response) {
+			return fmt.Errorf("%w: follow-up %d: response must be one of %s", ErrInvalid, i+1, strings.Join(Responses, ", "))
+		}
+		if err := checkLength("follow-up notes", f.Notes); err != nil {
+			return err
+		}
+		if f.Date.IsZero() {
+			f.Date = now
+		}
+	}
+
+	c.UpdatedAt = now
+	return nil
+}
+
+func checkLength(field, s string) error {
+	if utf8.RuneCountInString(s) > maxTextLength {
+		return fmt.Errorf("%w: %s is longer than %d characters", ErrInvalid, field, maxTextLength)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package cases
+
+import (
+	"slices"
+	"time"
+
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+)
+
+// EventPrescription is the kind of timeline events recording a prescription;
+// follow-up events have the follow-up's response as their kind.
+const EventPrescription = "prescription"
+
+// TimelineEvent is a prescription or follow-up entry of a case.
+type TimelineEvent struct {
+	Date    time.Time `json:"date"`
+	Kind    string    `json:"kind" jsonschema:"prescription, amelioration, aggravation, new_symptoms, unchanged, or note for follow-ups without a response"`
+	Remedy  string    `json:"remedy,omitempty" jsonschema:"The remedy prescribed, or for follow-ups the remedy in effect"`
+	Potency string    `json:"potency,omitempty"`
+	Notes   string    `json:"notes,omitempty" jsonschema:"The reason for a prescription, or the follow-up notes"`
+}
+
+// Timeline returns the case's prescriptions and follow-ups, oldest first. Each
+// follow-up names the remedy in effect at its date.
+func Timeline(c *db.CaseModel) []TimelineEvent {
+	prescriptions := slices.Clone(c.PreviousRemedies)
+	if c.ChosenRemedy != nil {
+		prescriptions = append(prescriptions, *c.ChosenRemedy)
+	}
+	slices.SortStableFunc(prescriptions, func(a, b db.ChosenRemedy) int { return a.ChosenAt.Compare(b.ChosenAt) })
+
+	events := make([]TimelineEvent, 0, len(prescriptions)+len(c.FollowUps))
+	for _, p := range prescriptions {
+		events = append(events, TimelineEvent{Date: p.ChosenAt, Kind: EventPrescription, Remedy: p.DocID, Potency: p.Potency, Notes: p.Reason})
+	}
+	for _, f := range c.FollowUps {
+		e := TimelineEvent{Date: f.Date, Kind: f.Response, Notes: f.Notes}
+		if e.Kind == "" {
+			e.Kind = "note"
+		}
+		// The last prescription made on or before the follow-up.
+		for _, p := range prescriptions {
+			if p.ChosenAt.After(f.Date) {
+				break
+			}
+			e.Remedy, e.Potency = p.DocID, p.Potency
+		}
+		events = append(events, e)
+	}
+
+	// Stable, so a prescription stays ahead of a follow-up on the same date.
+	slices.SortStableFunc(events, func(a, b TimelineEvent) int { return a.Date.Compare(b.Date) })
+	return events
+}
@@ -0,0 +1,551 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/SaiNageswarS/go-api-boot/odm"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/appconfig"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/controller"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/corpus"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/embedding"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/ingestion"
+	mcptools "github.com/SaiNageswarS/medicine-rag-custom-gpt/mcp"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/middleware"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/relations"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/tenant"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// promotePollInterval is how often ingest -promote checks the search indexes.
+const promotePollInterval = 15 * time.Second
+
+// command is a CLI subcommand run instead of the server: medicine-rag <name> [flags].
+type command struct {
+	usage string
+	run   func(ccfg *appconfig.AppConfig, args []string) error
+}
+
+var commands = map[string]command{
+	"openapi": {
+		usage: "generate openapi-schema.json from the routes (-check to verify it is up to date)",
+		run:   runOpenAPI,
+	},
+	"oauth-token": {
+		usage: "mint a test OAuth access token for /mcp from a local key pair",
+		run:   runOAuthToken,
+	},
+	"ingest": {
+		usage: "build PageIndex trees from the markdown articles and upsert them",
+		run:   runIngest,
+	},
+	"relationships": {
+		usage: "rebuild the remedy relationship graph from the ingested documents",
+		run:   runRelationships,
+	},
+	"verify": {
+		usage: "cross-check the documents, chunks and vectors of the served corpus",
+		run:   runVerify,
+	},
+}
+
+// runCommand runs the named subcommand and exits.
+func runCommand(ccfg *appconfig.AppConfig, name string, args []string) {
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\ncommands:\n", name)
+		for n, c := range commands {
+			fmt.Fprintf(os.Stderr, "  %-10s %s\n", n, c.usage)
+		}
+		os.Exit(2)
+	}
+
+	if err := cmd.run(ccfg, args); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func runOpenAPI(ccfg *appconfig.AppConfig, args []string) error {
+	fs := flag.NewFlagSet("openapi", flag.ExitOnError)
+	out := fs.String("o", controller.OpenAPIFile, "output file, - for stdout")
+	serverURL := fs.String("server", ccfg.PublicURL, "server URL (default public_url from config.ini)")
+	check := fs.Bool("check", false, "fail if the output file differs from the generated document")
+	_ = fs.Parse(args)
+
+	generated, err := controller.OpenAPIDocument(*serverURL)
+	if err != nil {
+		return err
+	}
+
+	if *check {
+		committed, err := os.ReadFile(*out)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(committed, generated) {
+			return fmt.Errorf("%s is out of date; run: ENV=prod go run . openapi", *out)
+		}
+		return nil
+	}
+
+	if *out == "-" {
+		_, err = os.Stdout.Write(generated)
+		return err
+	}
+	return os.WriteFile(*out, generated, 0o644)
+}
+
+// runIngest parses the articles into PageIndex trees and upserts them into
+// the pageindex_docs collection of a new corpus version of a tenant, then
+// rebuilds its relationship graph and, with -chunks, its hybrid search
+// collections. The API keeps serving the active version until the new one is
+// promoted, with -promote or the admin endpoint. Unlike
+// build_pageindex.py it needs no Python or LLM, so the trees have no summaries
+// beyond those kept from earlier ingestion. Runs are incremental: unchanged
+// articles, sections and windows are skipped by content hash, and a full run
+// removes what deleted articles left behind.
+func runIngest(ccfg *appconfig.AppConfig, args []string) error {
+	fs := flag.NewFlagSet("ingest", flag.ExitOnError)
+	dir := fs.String("dir", "articles", "directory of markdown articles")
+	single := fs.String("single", "", "ingest only this file, e.g. ACONITUM.md")
+	summaries := fs.String("summaries", "", "directory of build_pageindex.py trees to take summaries and descriptions from, e.g. results")
+	tenantID := fs.String("tenant", "", "tenant to ingest into (default: default_tenant)")
+	dryRun := fs.Bool("dry-run", false, "parse and report without writing")
+	chunks := fs.Bool("chunks", false, "also chunk and embed the sections for /search (needs JINA_AI_API_KEY)")
+	workers := fs.Int("workers", 4, "concurrent embedding requests")
+	reembed := fs.Bool("reembed", false, "embed every chunk again, not only those whose text changed")
+	modelID := fs.String("model", "", "embed with this registered embedding model (default: embedding_model)")
+	versionName := fs.String("version", "", "resume building this corpus version instead of creating one")
+	promote := fs.Bool("promote", false, "promote the version once built, waiting for its search indexes")
+	wait := fs.Duration("wait", 10*time.Minute, "how long -promote waits for search indexes")
+	_ = fs.Parse(args)
+
+	tenants := tenant.ProvideRegistry(ccfg)
+	t := tenants.Default()
+	if *tenantID != "" {
+		var ok bool
+		if t, ok = tenants.Get(*tenantID); !ok {
+			return fmt.Errorf("unknown tenant %q", *tenantID)
+		}
+	}
+
+	articles, err := ingestion.Articles(*dir, *single)
+	if err != nil {
+		return err
+	}
+	docs := make([]*db.PageIndexDocModel, len(articles))
+	for i, a := range articles {
+		content, err := os.ReadFile(a.Path)
+		if err != nil {
+			return err
+		}
+		docs[i] = ingestion.ParseMarkdown(a.DocID, content)
+	}
+	if *summaries != "" {
+		trees, err := mcptools.NewFilePageIndexStore(*summaries)
+		if err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			tree, err := trees.Document(context.Background(), doc.DocID)
+			if errors.Is(err, mcptools.ErrDocumentNotFound) {
+				fmt.Printf("%s: no tree in %s, summaries kept from the corpus\n", doc.DocID, *summaries)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			ingestion.CarrySummaries(doc, tree)
+		}
+	}
+
+	if *dryRun {
+		resolver := relations.NewResolver(nil)
+		for i, doc := range docs {
+			fmt.Printf("%s: %d lines, %d top-level sections", doc.DocID, doc.LineCount, len(doc.Structure))
+			if *chunks {
+				fmt.Printf(", %d chunks", len(ingestion.Chunk(doc, ingestion.SourceURI(articles[i]), resolver)))
+			}
+			fmt.Println()
+		}
+		return nil
+	}
+
+	models := embedding.ProvideRegistry(ccfg)
+	model := models.Active()
+	if *modelID != "" {
+		var ok bool
+		if model, ok = models.Get(*modelID); !ok {
+			return fmt.Errorf("%w %q", embedding.ErrUnknownModel, *modelID)
+		}
+	}
+
+	mongo := odm.ProvideMongoClient()
+	registry := corpus.ProvideRegistry(mongo, tenants, models)
+	ctx := context.Background()
+
+	var version *db.CorpusVersionModel
+	if *versionName != "" {
+		if version, err = registry.Get(ctx, t.Database, *versionName); err != nil {
+			return fmt.Errorf("%s: %w", *versionName, err)
+		}
+		if version.Active {
+			return fmt.Errorf("%s is active; build a new version instead", *versionName)
+		}
+	} else if version, err = registry.Create(ctx, t.Database); err != nil {
+		return fmt.Errorf("corpus version: %w", err)
+	}
+	fmt.Printf("%s: building corpus version %s in %s\n", t.Database, version.Version, version.Database)
+
+	opts := ingestOptions{full: *single == "", dir: *dir, chunks: *chunks, workers: *workers, reembed: *reembed, model: model, models: models}
+	if err := writeCorpus(ctx, mongo, relations.ProvideGraph(mongo, registry, tenants), version.Database, articles, docs, opts); err != nil {
+		return fmt.Errorf("%w (run again with -version %s to resume)", err, version.Version)
+	}
+
+	if version, err = registry.MarkReady(ctx, t.Database, version.Version); err != nil {
+		return err
+	}
+	fmt.Printf("%s: corpus version %s ready, %d documents, %d chunks\n", t.Database, version.Version, version.Documents, version.Chunks)
+	if !*promote {
+		fmt.Printf("promote it with POST /admin/corpus/promote {\"tenant\": %q, \"version\": %q}\n", t.ID, version.Version)
+		return nil
+	}
+
+	// Search indexes of a new version take a while to build on Atlas.
+	deadline := time.Now().Add(*wait)
+	for {
+		_, err = registry.Promote(ctx, t.Database, version.Version, false)
+		if !errors.Is(err, corpus.ErrIndexesBuilding) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(promotePollInterval)
+	}
+	if err != nil {
+		return fmt.Errorf("promote %s: %w", version.Version, err)
+	}
+	fmt.Printf("%s: corpus version %s is active\n", t.Database, version.Version)
+	return nil
+}
+
+// ingestOptions are the flags of the ingest command writeCorpus follows.
+type ingestOptions struct {
+	full    bool // all articles were parsed, so what is not among them was deleted
+	dir     string
+	chunks  bool
+	workers int
+	reembed bool
+	model   appconfig.EmbeddingModel // embeds the chunks
+	models  *embedding.Registry
+}
+
+// writeCorpus brings the corpus in database up to date with docs, parsed from
+// articles, and reports what changed.
+func writeCorpus(ctx context.Context, mongo odm.MongoClient, graph *relations.Graph, databaseName string, articles []ingestion.Article, docs []*db.PageIndexDocModel, opts ingestOptions) error {
+	database := mongo.Database(databaseName)
+	coll := database.Collection(db.PageIndexDocModel{}.CollectionName())
+
+	var counts ingestion.Counts
+	keepDocs := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		outcome, err := ingestion.Upsert(ctx, coll, doc)
+		if err != nil {
+			return fmt.Errorf("%s: %w", doc.DocID, err)
+		}
+		counts.Count(outcome)
+		keepDocs = append(keepDocs, doc.DocID)
+		if outcome != ingestion.Unchanged {
+			fmt.Printf("%s: %s\n", doc.DocID, outcome)
+		}
+	}
+	// Documents and chunks of deleted articles are only known on a full run.
+	if opts.full {
+		var err error
+		if counts.Removed, err = ingestion.PruneDocs(ctx, coll, keepDocs); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("%s: documents %s\n", databaseName, counts)
+
+	n, err := graph.Rebuild(ctx, databaseName)
+	if err != nil {
+		return fmt.Errorf("relationships: %w", err)
+	}
+	fmt.Printf("%s: %d relationships\n", databaseName, n)
+
+	if !opts.chunks {
+		return nil
+	}
+	resolver, err := relations.LoadResolver(ctx, coll)
+	if err != nil {
+		return err
+	}
+	model, err := embedding.NewModel(opts.model)
+	if err != nil {
+		return err
+	}
+	writer := &ingestion.ChunkWriter{
+		Model:   model,
+		Chunks:  database.Collection(db.ChunkModel{}.CollectionName()),
+		Vectors: embedding.Vectors(database, opts.model),
+		Workers: opts.workers,
+		Reembed: opts.reembed,
+	}
+	for _, m := range opts.models.Models() {
+		if m.ID != opts.model.ID {
+			writer.Others = append(writer.Others, embedding.Vectors(database, m))
+		}
+	}
+	var total ingestion.ChunkReport
+	keepSources := make([]string, 0, len(articles))
+	for i, doc := range docs {
+		source := ingestion.SourceURI(articles[i])
+		keepSources = append(keepSources, source)
+		report, err := writer.Sync(ctx, source, ingestion.Chunk(doc, source, resolver))
+		total.Add(report)
+		if err != nil {
+			return fmt.Errorf("%s chunks: %w", doc.DocID, err)
+		}
+	}
+	if opts.full {
+		removed, err := writer.Prune(ctx, ingestion.SourcePrefix(opts.dir), keepSources)
+		if err != nil {
+			return err
+		}
+		total.Chunks.Removed += removed
+	}
+	fmt.Printf("%s: sections %s\n", databaseName, total.Sections)
+	fmt.Printf("%s: chunks %s; %d embedded with %s\n", databaseName, total.Chunks, total.Embedded, opts.model.ID)
+	return nil
+}
+
+// runRelationships rebuilds the remedy_relationships collection of the active
+// corpus of each tenant, or of one tenant's with -tenant. The ingest command
+// rebuilds it itself; run this after changing documents by other means.
+func runRelationships(ccfg *appconfig.AppConfig, args []string) error {
+	fs := flag.NewFlagSet("relationships", flag.ExitOnError)
+	tenantID := fs.String("tenant", "", "rebuild only this tenant's database (default: all)")
+	_ = fs.Parse(args)
+
+	tenants := tenant.ProvideRegistry(ccfg)
+	databases := tenants.Databases()
+	if *tenantID != "" {
+		t, ok := tenants.Get(*tenantID)
+		if !ok {
+			return fmt.Errorf("unknown tenant %q", *tenantID)
+		}
+		databases = []string{t.Database}
+	}
+
+	mongo := odm.ProvideMongoClient()
+	registry := corpus.ProvideRegistry(mongo, tenants, embedding.ProvideRegistry(ccfg))
+	graph := relations.ProvideGraph(mongo, registry, tenants)
+	ctx := context.Background()
+	for _, tenantDB := range databases {
+		database, err := registry.ActiveDatabase(ctx, tenantDB)
+		if err != nil {
+			return fmt.Errorf("%s: %w", tenantDB, err)
+		}
+		n, err := graph.Rebuild(ctx, database)
+		if err != nil {
+			return fmt.Errorf("%s: %w", database, err)
+		}
+		fmt.Printf("%s: %d relationships\n", database, n)
+	}
+	return nil
+}
+
+// runVerify reports the inconsistencies between the documents, chunks and
+// vectors of the active corpus of each tenant, or of one tenant's with -tenant,
+// and fails if it finds any.
+func runVerify(ccfg *appconfig.AppConfig, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	tenantID := fs.String("tenant", "", "check only this tenant (default: all)")
+	versionName := fs.String("version", "", "check this corpus version of -tenant instead of the active one")
+	_ = fs.Parse(args)
+
+	tenants := tenant.ProvideRegistry(ccfg)
+	databases := tenants.Databases()
+	if *tenantID != "" {
+		t, ok := tenants.Get(*tenantID)
+		if !ok {
+			return fmt.Errorf("unknown tenant %q", *tenantID)
+		}
+		databases = []string{t.Database}
+	} else if *versionName != "" {
+		return errors.New("-version needs -tenant")
+	}
+
+	mongo := odm.ProvideMongoClient()
+	registry := corpus.ProvideRegistry(mongo, tenants, embedding.ProvideRegistry(ccfg))
+	ctx := context.Background()
+	problems := 0
+	for _, tenantDB := range databases {
+		database, err := registry.ActiveDatabase(ctx, tenantDB)
+		if *versionName != "" {
+			var version *db.CorpusVersionModel
+			if version, err = registry.Get(ctx, tenantDB, *versionName); err == nil {
+				database = version.Database
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", tenantDB, err)
+		}
+
+		report, err := registry.Verify(ctx, database)
+		if err != nil {
+			return fmt.Errorf("%s: %w", database, err)
+		}
+		fmt.Printf("%s: %d documents, %d chunks, %d vectors\n", database, report.Documents, report.Chunks, report.Vectors)
+		for _, f := range report.Findings() {
+			if f.Count == 0 {
+				continue
+			}
+			fmt.Printf("  %s: %d\n", f.Name, f.Count)
+			for _, item := range f.Items {
+				fmt.Printf("    %s\n", item)
+			}
+			if f.Count > len(f.Items) {
+				fmt.Printf("    … %d more\n", f.Count-len(f.Items))
+			}
+		}
+		problems += report.Problems()
+	}
+	if problems > 0 {
+		return fmt.Errorf("%d inconsistencies found", problems)
+	}
+	return nil
+}
+
+// runOAuthToken signs an access token with a local Ed25519 key, created on
+// first use. With -jwks it also writes the JWKS of the key, for
+// oauth_jwks_file to point at, unless that file exists and -force is not
+// given, so that a real issuer's keys are never replaced by accident. It lets
+// OAuth mode be tried without an authorization server.
+func runOAuthToken(ccfg *appconfig.AppConfig, args []string) error {
+	fs := flag.NewFlagSet("oauth-token", flag.ExitOnError)
+	keyFile := fs.String("key", "oauth-dev-key.pem", "private key, created if missing")
+	jwksFile := fs.String("jwks", "", "write the JWKS of the key to this file, if it does not exist")
+	force := fs.Bool("force", false, "overwrite an existing -jwks file")
+	issuer := fs.String("iss", ccfg.OAuthIssuer, "issuer (default oauth_issuer)")
+	audience := fs.String("aud", middleware.OAuthAudience(ccfg), "audience")
+	subject := fs.String("sub", "dev-user", "subject")
+	scope := fs.String("scope", middleware.ScopeDocumentsRead, "space-separated scopes")
+	ttl := fs.Duration("ttl", time.Hour, "token lifetime")
+	_ = fs.Parse(args)
+
+	if *issuer == "" {
+		return errors.New("set oauth_issuer in config.ini, or pass -iss")
+	}
+
+	key, err := loadOrCreateSigningKey(*keyFile)
+	if err != nil {
+		return err
+	}
+
+	kid := fmt.Sprintf("%x", sha256.Sum256(key.Public().(ed25519.PublicKey)))[:16]
+	jwks, err := json.MarshalIndent(middleware.JWKS{Keys: []middleware.JWK{{
+		Kty: "OKP",
+		Crv: "Ed25519",
+		Kid: kid,
+		Use: "sig",
+		Alg: "EdDSA",
+		X:   base64.RawURLEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+	}}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeDevJWKS(*jwksFile, append(jwks, '\n'), *force); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{
+		"iss":   *issuer,
+		"aud":   *audience,
+		"sub":   *subject,
+		"scope": *scope,
+		"iat":   now.Unix(),
+		"exp":   now.Add(*ttl).Unix(),
+	})
+	token.Header["kid"] = kid
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		return err
+	}
+	fmt.Println(signed)
+	return nil
+}
+
+// writeDevJWKS writes the JWKS of the local key to path, if one is given,
+// without replacing an existing file unless forced.
+func writeDevJWKS(path string, jwks []byte, force bool) error {
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "JWKS not written; pass -jwks to write it for oauth_jwks_file")
+		return nil
+	}
+	if !force {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			fmt.Fprintf(os.Stderr, "%s exists and was not overwritten; pass -force to replace it\n", path)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(jwks); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	return os.WriteFile(path, jwks, 0o644)
+}
+
+func loadOrCreateSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		pemBytes := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		return key, os.WriteFile(path, pemBytes, 0o600)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 key", path)
+	}
+	return key, nil
+}
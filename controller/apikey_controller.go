@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/SaiNageswarS/go-api-boot/logger"
+	"github.com/SaiNageswarS/go-api-boot/server"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/mcp"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/middleware"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/model"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/openapi"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/tenant"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+)
+
+const maxAdminBodyBytes = 64 << 10
+
+// APIKeyController manages API keys. All routes require the admin scope.
+type APIKeyController struct {
+	keys         *middleware.APIKeyStore
+	instructions *mcp.InstructionsStore
+	sessions     *mcp.SessionRegistry
+	tenants      *tenant.Registry
+	auth         *middleware.APIKeyAuth
+}
+
+func ProvideAPIKeyController(keys *middleware.APIKeyStore, instructions *mcp.InstructionsStore, sessions *mcp.SessionRegistry, tenants *tenant.Registry, auth *middleware.APIKeyAuth) *APIKeyController {
+	return &APIKeyController{keys: keys, instructions: instructions, sessions: sessions, tenants: tenants, auth: auth}
+}
+
+// CreateKey issues a new key and returns it once.
+// POST /admin/keys
+func (c *APIKeyController) CreateKey(w http.ResponseWriter, r *http.Request) {
+	var req model.CreateAPIKeyRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.InstructionsVersion != "" {
+		versions, err := c.instructions.Versions()
+		if err != nil || !slices.Contains(versions, req.InstructionsVersion) {
+			http.Error(w, "Unknown instructions version", http.StatusBadRequest)
+			return
+		}
+	}
+	if _, ok := c.tenants.Get(req.Tenant); req.Tenant != "" && !ok {
+		http.Error(w, "Unknown tenant", http.StatusBadRequest)
+		return
+	}
+
+	key, created, err := c.keys.Create(r.Context(), db.APIKeyModel{
+		Name:                req.Name,
+		Scopes:              req.Scopes,
+		ExpiresAt:           req.ExpiresAt,
+		InstructionsVersion: req.InstructionsVersion,
+		DailyQuota:          req.DailyQuota,
+		Tenant:              req.Tenant,
+	})
+	if err != nil {
+		logger.Error("Failed to create API key", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	logger.Info("API key created", zap.String("keyId", created.KeyID), zap.String("name", created.Name), zap.Strings("scopes", created.Scopes), zap.String("tenant", created.Tenant))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(model.CreateAPIKeyResponse{Key: key, APIKey: created}); err != nil {
+		logger.Error("Failed to encode API key response", zap.Error(err))
+	}
+}
+
+// ListKeys returns every key without its secret.
+// GET /admin/keys
+func (c *APIKeyController) ListKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := c.keys.List(r.Context())
+	if err != nil {
+		logger.Error("Failed to list API keys", zap.Error(err))
+		http.Error(w, "Failed to list API keys", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(keys); err != nil {
+		logger.Error("Failed to encode API keys response", zap.Error(err))
+	}
+}
+
+// RevokeKey disables a key and closes the MCP sessions it opened.
+// DELETE /admin/keys/{id}
+func (c *APIKeyController) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	keyID := extractPathParam(r.URL.Path, "/admin/keys/", "")
+	if keyID == "" {
+		http.Error(w, "Key ID is required", http.StatusBadRequest)
+		return
+	}
+
+	err := c.keys.Revoke(r.Context(), keyID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to revoke API key", zap.String("keyId", keyID), zap.Error(err))
+		http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
+		return
+	}
+
+	closed := c.sessions.RevokeKey(keyID)
+	logger.Info("API key revoked", zap.String("keyId", keyID), zap.Int("sessionsClosed", closed))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *APIKeyController) Operations() []openapi.Operation {
+	return []openapi.Operation{
+		{
+			Method:      http.MethodPost,
+			Pattern:     "/admin/keys",
+			OperationID: "CreateAPIKey",
+			Summary:     "Issue an API key",
+			Response:    openapi.Response{Description: "The new key, shown once", Body: model.CreateAPIKeyResponse{}},
+			Scope:       middleware.ScopeAdmin,
+			Hidden:      true,
+			Handler:     c.CreateKey,
+		},
+		{
+			Method:      http.MethodGet,
+			Pattern:     "/admin/keys",
+			OperationID: "ListAPIKeys",
+			Summary:     "List API keys",
+			Response:    openapi.Response{Description: "API keys without secrets", Body: []db.APIKeyModel(nil)},
+			Scope:       middleware.ScopeAdmin,
+			Hidden:      true,
+			Handler:     c.ListKeys,
+		},
+		{
+			Method:      http.MethodDelete,
+			Pattern:     "/admin/keys/{id}",
+			OperationID: "RevokeAPIKey",
+			Summary:     "Revoke an API key",
+			Params:      []openapi.Param{{Name: "id", In: "path", Description: "Key ID"}},
+			Scope:       middleware.ScopeAdmin,
+			Hidden:      true,
+			Handler:     c.RevokeKey,
+		},
+	}
+}
+
+func (c *APIKeyController) Routes() []server.Route {
+	return routesOf(c.auth, c.Operations())
+}
@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SaiNageswarS/go-api-boot/logger"
+	"github.com/SaiNageswarS/go-api-boot/server"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/audit"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/middleware"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/openapi"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// AuditController serves the audit log. All routes require the admin scope.
+type AuditController struct {
+	log  *audit.Log
+	auth *middleware.APIKeyAuth
+}
+
+func ProvideAuditController(log *audit.Log, auth *middleware.APIKeyAuth) *AuditController {
+	return &AuditController{log: log, auth: auth}
+}
+
+// ListEvents returns audit events, newest first.
+// GET /admin/audit?keyId=&tenant=&channel=&action=&docId=&since=&until=&limit=
+func (c *AuditController) ListEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := audit.Filter{
+		KeyID:   q.Get("keyId"),
+		Tenant:  q.Get("tenant"),
+		Channel: q.Get("channel"),
+		Action:  q.Get("action"),
+		DocID:   q.Get("docId"),
+		Limit:   defaultAuditLimit,
+	}
+
+	var err error
+	if v := q.Get("since"); v != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "since must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "until must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxAuditLimit {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = int64(limit)
+	}
+
+	events, err := c.log.Find(r.Context(), filter)
+	if err != nil {
+		logger.Error("Failed to query audit log", zap.Error(err))
+		http.Error(w, "Failed to query audit log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(events); err != nil {
+		logger.Error("Failed to encode audit response", zap.Error(err))
+	}
+}
+
+func (c *AuditController) Operations() []openapi.Operation {
+	return []openapi.Operation{
+		{
+			Method:      http.MethodGet,
+			Pattern:     "/admin/audit",
+			OperationID: "ListAuditEvents",
+			Summary:     "Query the audit log",
+			Params: []openapi.Param{
+				{Name: "keyId", In: "query", Description: "Only calls by this API key"},
+				{Name: "tenant", In: "query", Description: "Only calls for this tenant"},
+				{Name: "channel", In: "query", Description: "rest or mcp"},
+				{Name: "action", In: "query", Description: "e.g. GET /search or tools/call get_page_content"},
+				{Name: "docId", In: "query", Description: "Only reads of this remedy"},
+				{Name: "since", In: "query", Description: "RFC 3339 time, inclusive"},
+				{Name: "until", In: "query", Description: "RFC 3339 time, exclusive"},
+				{Name: "limit", In: "query", Description: "At most this many events (default 100, max 1000)"},
+			},
+			Response: openapi.Response{Description: "Audit events, newest first", Body: []db.AuditEventModel(nil)},
+			Errors:   map[int]string{http.StatusBadRequest: "Invalid filter"},
+			Scope:    middleware.ScopeAdmin,
+			Hidden:   true,
+			Handler:  c.ListEvents,
+		},
+	}
+}
+
+func (c *AuditController) Routes() []server.Route {
+	return routesOf(c.auth, c.Operations())
+}
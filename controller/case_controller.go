@@ -0,0 +1,353 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/SaiNageswarS/go-api-boot/logger"
+	"github.com/SaiNageswarS/go-api-boot/server"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/audit"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/cases"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/mcp"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/middleware"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/model"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/openapi"
+	"go.uber.org/zap"
+)
+
+const maxCaseBodyBytes = 256 << 10
+
+// CaseController saves and reads the caller's patient cases. Each key sees
+// only the cases it saved.
+type CaseController struct {
+	cases *cases.Store
+	svc   *mcp.PageIndexService
+	auth  *middleware.APIKeyAuth
+}
+
+func ProvideCaseController(store *cases.Store, svc *mcp.PageIndexService, auth *middleware.APIKeyAuth) *CaseController {
+	return &CaseController{cases: store, svc: svc, auth: auth}
+}
+
+// CreateCase saves a new case.
+// POST /cases
+func (c *CaseController) CreateCase(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeCaseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var record db.CaseModel
+	req.Apply(&record)
+	p, _ := middleware.PrincipalFromContext(r.Context())
+	created, err := c.cases.Create(r.Context(), p.KeyID, record)
+	if err != nil {
+		writeCaseError(w, "Failed to save case", "", err)
+		return
+	}
+	audit.SetArg(r.Context(), "caseId", created.ID)
+
+	logger.Info("Case saved", zap.String("caseId", created.ID), zap.String("keyId", p.KeyID))
+	writeCase(w, http.StatusCreated, created)
+}
+
+// ListCases returns the caller's cases, most recently updated first.
+// GET /cases?limit=
+func (c *CaseController) ListCases(w http.ResponseWriter, r *http.Request) {
+	limit := int64(cases.DefaultListLimit)
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > cases.MaxListLimit {
+			http.Error(w, "limit must be between 1 and 200", http.StatusBadRequest)
+			return
+		}
+		limit = int64(n)
+	}
+
+	p, _ := middleware.PrincipalFromContext(r.Context())
+	list, err := c.cases.List(r.Context(), p.KeyID, limit)
+	if err != nil {
+		logger.Error("Failed to list cases", zap.String("keyId", p.KeyID), zap.Error(err))
+		http.Error(w, "Failed to list cases", http.StatusInternalServerError)
+		return
+	}
+	audit.SetResults(r.Context(), len(list))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		logger.Error("Failed to encode cases response", zap.Error(err))
+	}
+}
+
+// GetCase returns one of the caller's cases.
+// GET /cases/{id}
+func (c *CaseController) GetCase(w http.ResponseWriter, r *http.Request) {
+	caseID := extractPathParam(r.URL.Path, "/cases/", "")
+	if caseID == "" {
+		http.Error(w, "Case ID is required", http.StatusBadRequest)
+		return
+	}
+	audit.SetArg(r.Context(), "caseId", caseID)
+
+	p, _ := middleware.PrincipalFromContext(r.Context())
+	found, err := c.cases.Get(r.Context(), p.KeyID, caseID)
+	if err != nil {
+		writeCaseError(w, "Failed to read case", caseID, err)
+		return
+	}
+	writeCase(w, http.StatusOK, found)
+}
+
+// ReplaceCase overwrites one of the caller's cases.
+// PUT /cases/{id}
+func (c *CaseController) ReplaceCase(w http.ResponseWriter, r *http.Request) {
+	caseID := extractPathParam(r.URL.Path, "/cases/", "")
+	if caseID == "" {
+		http.Error(w, "Case ID is required", http.StatusBadRequest)
+		return
+	}
+	audit.SetArg(r.Context(), "caseId", caseID)
+	req, ok := decodeCaseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	p, _ := middleware.PrincipalFromContext(r.Context())
+	updated, err := c.cases.Update(r.Context(), p.KeyID, caseID, req.Apply)
+	if err != nil {
+		writeCaseError(w, "Failed to save case", caseID, err)
+		return
+	}
+	writeCase(w, http.StatusOK, updated)
+}
+
+// DeleteCase removes one of the caller's cases.
+// DELETE /cases/{id}
+func (c *CaseController) DeleteCase(w http.ResponseWriter, r *http.Request) {
+	caseID := extractPathParam(r.URL.Path, "/cases/", "")
+	if caseID == "" {
+		http.Error(w, "Case ID is required", http.StatusBadRequest)
+		return
+	}
+	audit.SetArg(r.Context(), "caseId", caseID)
+
+	p, _ := middleware.PrincipalFromContext(r.Context())
+	if err := c.cases.Delete(r.Context(), p.KeyID, caseID); err != nil {
+		writeCaseError(w, "Failed to delete case", caseID, err)
+		return
+	}
+
+	logger.Info("Case deleted", zap.String("caseId", caseID), zap.String("keyId", p.KeyID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AddFollowUp records a follow-up consultation and, optionally, a second
+// prescription.
+// POST /cases/{id}/follow-ups
+func (c *CaseController) AddFollowUp(w http.ResponseWriter, r *http.Request) {
+	caseID := extractPathParam(r.URL.Path, "/cases/", "/follow-ups")
+	if caseID == "" {
+		http.Error(w, "Case ID is required", http.StatusBadRequest)
+		return
+	}
+	audit.SetArg(r.Context(), "caseId", caseID)
+
+	var req model.FollowUpRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCaseBodyBytes)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Entries) == 0 && req.Prescribe == nil {
+		http.Error(w, "entries or prescribe is required", http.StatusBadRequest)
+		return
+	}
+
+	p, _ := middleware.PrincipalFromContext(r.Context())
+	updated, err := c.cases.Update(r.Context(), p.KeyID, caseID, func(record *db.CaseModel) {
+		record.FollowUps = append(record.FollowUps, req.Entries...)
+		if req.Prescribe != nil {
+			record.ChosenRemedy = req.Prescribe
+		}
+	})
+	if err != nil {
+		writeCaseError(w, "Failed to save follow-up", caseID, err)
+		return
+	}
+	writeCase(w, http.StatusOK, updated)
+}
+
+// GetTimeline returns a case's prescriptions and follow-ups in date order,
+// with the relationship sections of the prescribed remedy.
+// GET /cases/{id}/timeline
+func (c *CaseController) GetTimeline(w http.ResponseWriter, r *http.Request) {
+	caseID := extractPathParam(r.URL.Path, "/cases/", "/timeline")
+	if caseID == "" {
+		http.Error(w, "Case ID is required", http.StatusBadRequest)
+		return
+	}
+	audit.SetArg(r.Context(), "caseId", caseID)
+
+	p, _ := middleware.PrincipalFromContext(r.Context())
+	found, err := c.cases.Get(r.Context(), p.KeyID, caseID)
+	if err != nil {
+		writeCaseError(w, "Failed to read case", caseID, err)
+		return
+	}
+	timeline, err := mcp.BuildCaseTimeline(r.Context(), c.svc, found)
+	if err != nil {
+		writeCaseError(w, "Failed to read remedy sections", caseID, err)
+		return
+	}
+	audit.SetResults(r.Context(), len(timeline.Events))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(timeline); err != nil {
+		logger.Error("Failed to encode timeline response", zap.Error(err))
+	}
+}
+
+func decodeCaseRequest(w http.ResponseWriter, r *http.Request) (model.CaseRequest, bool) {
+	var req model.CaseRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCaseBodyBytes)).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return req, false
+		}
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+// writeCaseError maps store errors to 404, 400 and 409, and anything else to
+// 500 with msg.
+func writeCaseError(w http.ResponseWriter, msg, caseID string, err error) {
+	switch {
+	case errors.Is(err, cases.ErrNotFound):
+		http.Error(w, "Case not found", http.StatusNotFound)
+	case errors.Is(err, cases.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, cases.ErrConflict):
+		http.Error(w, "Case is being changed by another request, try again", http.StatusConflict)
+	default:
+		logger.Error(msg, zap.String("caseId", caseID), zap.Error(err))
+		http.Error(w, msg, http.StatusInternalServerError)
+	}
+}
+
+func writeCase(w http.ResponseWriter, status int, record *db.CaseModel) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(record); err != nil {
+		logger.Error("Failed to encode case response", zap.Error(err))
+	}
+}
+
+func (c *CaseController) Operations() []openapi.Operation {
+	idParam := openapi.Param{Name: "id", In: "path", Description: "Case ID, as returned by SaveCase or ListCases"}
+	return []openapi.Operation{
+		{
+			Method:      http.MethodPost,
+			Pattern:     "/cases",
+			OperationID: "SaveCase",
+			Summary:     "Save a patient case",
+			Description: "Saves the symptoms, remedy passages consulted, chosen remedy and follow-ups of a case, so a later conversation can continue it. Pass the returned id as caseId to Search to personalise searches.",
+			Request:     openapi.Request{Body: model.CaseRequest{}},
+			Response:    openapi.Response{Status: http.StatusCreated, Description: "The saved case", Body: db.CaseModel{}},
+			Errors: map[int]string{
+				http.StatusBadRequest:            "Invalid case",
+				http.StatusRequestEntityTooLarge: "Request body larger than 256 KiB",
+			},
+			Scope:   middleware.ScopeCases,
+			Handler: c.CreateCase,
+		},
+		{
+			Method:      http.MethodGet,
+			Pattern:     "/cases",
+			OperationID: "ListCases",
+			Summary:     "List saved cases",
+			Params:      []openapi.Param{{Name: "limit", In: "query", Description: "At most this many cases (default 50, max 200)"}},
+			Response:    openapi.Response{Description: "The caller's cases, most recently updated first", Body: []cases.Summary(nil)},
+			Errors:      map[int]string{http.StatusBadRequest: "Invalid limit"},
+			Scope:       middleware.ScopeCases,
+			Handler:     c.ListCases,
+		},
+		{
+			Method:      http.MethodGet,
+			Pattern:     "/cases/{id}",
+			OperationID: "GetCase",
+			Summary:     "Get a saved case",
+			Params:      []openapi.Param{idParam},
+			Response:    openapi.Response{Description: "The case", Body: db.CaseModel{}},
+			Errors:      map[int]string{http.StatusNotFound: "Case not found"},
+			Scope:       middleware.ScopeCases,
+			Handler:     c.GetCase,
+		},
+		{
+			Method:      http.MethodPut,
+			Pattern:     "/cases/{id}",
+			OperationID: "UpdateCase",
+			Summary:     "Replace a saved case",
+			Description: "Replaces the whole case; send every symptom, citation and follow-up to keep, e.g. as returned by GetCase plus the new ones.",
+			Params:      []openapi.Param{idParam},
+			Request:     openapi.Request{Body: model.CaseRequest{}},
+			Response:    openapi.Response{Description: "The saved case", Body: db.CaseModel{}},
+			Errors: map[int]string{
+				http.StatusBadRequest:            "Invalid case",
+				http.StatusNotFound:              "Case not found",
+				http.StatusConflict:              "Case changed by a concurrent request; retry",
+				http.StatusRequestEntityTooLarge: "Request body larger than 256 KiB",
+			},
+			Scope:   middleware.ScopeCases,
+			Handler: c.ReplaceCase,
+		},
+		{
+			Method:      http.MethodDelete,
+			Pattern:     "/cases/{id}",
+			OperationID: "DeleteCase",
+			Summary:     "Delete a saved case",
+			Params:      []openapi.Param{idParam},
+			Response:    openapi.Response{Status: http.StatusNoContent, Description: "Case deleted"},
+			Errors:      map[int]string{http.StatusNotFound: "Case not found"},
+			Scope:       middleware.ScopeCases,
+			Handler:     c.DeleteCase,
+		},
+		{
+			Method:      http.MethodPost,
+			Pattern:     "/cases/{id}/follow-ups",
+			OperationID: "AddFollowUp",
+			Summary:     "Record a follow-up",
+			Description: "Adds what a follow-up consultation found (amelioration, aggravation, new symptoms or no change) and, optionally, a second prescription. Earlier prescriptions are kept.",
+			Params:      []openapi.Param{idParam},
+			Request:     openapi.Request{Body: model.FollowUpRequest{}},
+			Response:    openapi.Response{Description: "The saved case", Body: db.CaseModel{}},
+			Errors: map[int]string{
+				http.StatusBadRequest: "Invalid follow-up",
+				http.StatusNotFound:   "Case not found",
+				http.StatusConflict:   "Case changed by a concurrent request; retry",
+			},
+			Scope:   middleware.ScopeCases,
+			Handler: c.AddFollowUp,
+		},
+		{
+			Method:      http.MethodGet,
+			Pattern:     "/cases/{id}/timeline",
+			OperationID: "GetCaseTimeline",
+			Summary:     "Get a case's remedy response timeline",
+			Description: "Returns prescriptions and follow-ups in date order, each follow-up with the remedy in effect, plus the Relationship, Compare and Antidote sections of the prescribed remedy to support a second prescription.",
+			Params:      []openapi.Param{idParam},
+			Response:    openapi.Response{Description: "The timeline", Body: mcp.CaseTimeline{}},
+			Errors:      map[int]string{http.StatusNotFound: "Case not found"},
+			Scope:       middleware.ScopeCases,
+			Handler:     c.GetTimeline,
+		},
+	}
+}
+
+func (c *CaseController) Routes() []server.Route {
+	return routesOf(c.auth, c.Operations())
+}
@@ -0,0 +1,249 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/SaiNageswarS/go-api-boot/logger"
+	"github.com/SaiNageswarS/go-api-boot/server"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/appconfig"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/audit"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/corpus"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/middleware"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/model"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/openapi"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/tenant"
+	"go.uber.org/zap"
+)
+
+// CorpusController lists the corpus versions of a tenant, switches the one the
+// API serves and checks their consistency. All routes require the admin scope.
+type CorpusController struct {
+	corpus  *corpus.Registry
+	tenants *tenant.Registry
+	auth    *middleware.APIKeyAuth
+}
+
+func ProvideCorpusController(corpus *corpus.Registry, tenants *tenant.Registry, auth *middleware.APIKeyAuth) *CorpusController {
+	return &CorpusController{corpus: corpus, tenants: tenants, auth: auth}
+}
+
+// ListVersions returns the tenant's corpus versions and the one served.
+// GET /admin/corpus?tenant=
+func (c *CorpusController) ListVersions(w http.ResponseWriter, r *http.Request) {
+	t, ok := c.tenantOf(r, r.URL.Query().Get("tenant"))
+	if !ok {
+		http.Error(w, "Unknown tenant", http.StatusBadRequest)
+		return
+	}
+	c.writeVersions(w, r, t)
+}
+
+// Promote makes a ready version the one the API serves.
+// POST /admin/corpus/promote
+func (c *CorpusController) Promote(w http.ResponseWriter, r *http.Request) {
+	var req model.PromoteCorpusRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Version == "" {
+		http.Error(w, "version is required", http.StatusBadRequest)
+		return
+	}
+	t, ok := c.tenantOf(r, req.Tenant)
+	if !ok {
+		http.Error(w, "Unknown tenant", http.StatusBadRequest)
+		return
+	}
+	audit.SetArg(r.Context(), "version", req.Version)
+
+	_, err := c.corpus.Promote(r.Context(), t.Database, req.Version, req.Force)
+	switch {
+	case errors.Is(err, corpus.ErrNotFound):
+		http.Error(w, "Corpus version not found", http.StatusNotFound)
+		return
+	case errors.Is(err, corpus.ErrNotReady), errors.Is(err, corpus.ErrIndexesBuilding):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		logger.Error("Failed to promote corpus version", zap.String("tenant", t.ID), zap.String("version", req.Version), zap.Error(err))
+		http.Error(w, "Failed to promote corpus version", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Corpus version promoted", zap.String("tenant", t.ID), zap.String("version", req.Version))
+	c.writeVersions(w, r, t)
+}
+
+// Rollback undoes the last promotion.
+// POST /admin/corpus/rollback
+func (c *CorpusController) Rollback(w http.ResponseWriter, r *http.Request) {
+	var req model.RollbackCorpusRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	t, ok := c.tenantOf(r, req.Tenant)
+	if !ok {
+		http.Error(w, "Unknown tenant", http.StatusBadRequest)
+		return
+	}
+
+	active, err := c.corpus.Rollback(r.Context(), t.Database)
+	switch {
+	case errors.Is(err, corpus.ErrNoRollback), errors.Is(err, corpus.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		logger.Error("Failed to roll back corpus version", zap.String("tenant", t.ID), zap.Error(err))
+		http.Error(w, "Failed to roll back corpus version", http.StatusInternalServerError)
+		return
+	}
+
+	version := ""
+	if active != nil {
+		version = active.Version
+	}
+	logger.Info("Corpus version rolled back", zap.String("tenant", t.ID), zap.String("active", version))
+	c.writeVersions(w, r, t)
+}
+
+// Consistency cross-checks the documents, chunks and vectors of the corpus
+// served, or of a version.
+// GET /admin/consistency?tenant=&version=
+func (c *CorpusController) Consistency(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	t, ok := c.tenantOf(r, q.Get("tenant"))
+	if !ok {
+		http.Error(w, "Unknown tenant", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	database, err := c.databaseOf(ctx, t, q.Get("version"))
+	switch {
+	case errors.Is(err, corpus.ErrNotFound):
+		http.Error(w, "Corpus version not found", http.StatusNotFound)
+		return
+	case err != nil:
+		logger.Error("Failed to find corpus database", zap.String("tenant", t.ID), zap.Error(err))
+		http.Error(w, "Failed to check corpus consistency", http.StatusInternalServerError)
+		return
+	}
+
+	report, err := c.corpus.Verify(ctx, database)
+	if err != nil {
+		logger.Error("Failed to check corpus consistency", zap.String("database", database), zap.Error(err))
+		http.Error(w, "Failed to check corpus consistency", http.StatusInternalServerError)
+		return
+	}
+	audit.SetResults(ctx, report.Problems())
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		logger.Error("Failed to encode consistency report", zap.Error(err))
+	}
+}
+
+// tenantOf returns the tenant named, or the request's if id is empty.
+func (c *CorpusController) tenantOf(r *http.Request, id string) (*appconfig.Tenant, bool) {
+	if id == "" {
+		return tenant.FromContext(r.Context())
+	}
+	return c.tenants.Get(id)
+}
+
+// databaseOf returns the database of a version of t, or of the corpus served
+// if version is empty.
+func (c *CorpusController) databaseOf(ctx context.Context, t *appconfig.Tenant, version string) (string, error) {
+	if version == "" {
+		return c.corpus.ActiveDatabase(ctx, t.Database)
+	}
+	v, err := c.corpus.Get(ctx, t.Database, version)
+	if err != nil {
+		return "", err
+	}
+	return v.Database, nil
+}
+
+func (c *CorpusController) writeVersions(w http.ResponseWriter, r *http.Request, t *appconfig.Tenant) {
+	ctx := r.Context()
+	versions, err := c.corpus.List(ctx, t.Database)
+	if err != nil {
+		logger.Error("Failed to list corpus versions", zap.String("tenant", t.ID), zap.Error(err))
+		http.Error(w, "Failed to list corpus versions", http.StatusInternalServerError)
+		return
+	}
+	active, err := c.corpus.Active(ctx, t.Database)
+	if err != nil {
+		logger.Error("Failed to find active corpus version", zap.String("tenant", t.ID), zap.Error(err))
+		http.Error(w, "Failed to list corpus versions", http.StatusInternalServerError)
+		return
+	}
+
+	resp := model.CorpusResponse{Tenant: t.ID, Database: t.Database, Versions: versions}
+	if active != nil {
+		resp.Active, resp.Database = active.Version, active.Database
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Error("Failed to encode corpus response", zap.Error(err))
+	}
+}
+
+func (c *CorpusController) Operations() []openapi.Operation {
+	return []openapi.Operation{
+		{
+			Method:      http.MethodGet,
+			Pattern:     "/admin/corpus",
+			OperationID: "ListCorpusVersions",
+			Summary:     "List corpus versions",
+			Params:      []openapi.Param{{Name: "tenant", In: "query", Description: "Tenant ID (default: the key's tenant)"}},
+			Response:    openapi.Response{Description: "The tenant's corpus versions, newest first, and the one served", Body: model.CorpusResponse{}},
+			Errors:      map[int]string{http.StatusBadRequest: "Unknown tenant"},
+			Scope:       middleware.ScopeAdmin,
+			Hidden:      true,
+			Handler:     c.ListVersions,
+		},
+		{
+			Method:      http.MethodPost,
+			Pattern:     "/admin/corpus/promote",
+			OperationID: "PromoteCorpusVersion",
+			Summary:     "Serve a corpus version",
+			Description: "Switches every reader of the tenant to a ready corpus version at once. Older versions are dropped, except the one replaced, which rollback returns to.",
+			Request:     openapi.Request{Description: "The version to promote", Body: model.PromoteCorpusRequest{}},
+			Response:    openapi.Response{Description: "The tenant's corpus versions after the switch", Body: model.CorpusResponse{}},
+			Errors: map[int]string{
+				http.StatusBadRequest: "Version missing or unknown tenant",
+				http.StatusNotFound:   "Corpus version not found",
+				http.StatusConflict:   "The version is still building, or its search indexes are",
+			},
+			Scope:   middleware.ScopeAdmin,
+			Hidden:  true,
+			Handler: c.Promote,
+		},
+		{
+			Method:      http.MethodPost,
+			Pattern:     "/admin/corpus/rollback",
+			OperationID: "RollbackCorpusVersion",
+			Summary:     "Undo the last corpus promotion",
+			Request:     openapi.Request{Description: "The tenant, optionally", Body: model.RollbackCorpusRequest{}},
+			Response:    openapi.Response{Description: "The tenant's corpus versions after the switch", Body: model.CorpusResponse{}},
+			Errors: map[int]string{
+				http.StatusBadRequest: "Unknown tenant",
+				http.StatusConflict:   "Nothing to roll back to",
+			},
+			Scope:   middleware.ScopeAdmin,
+			Hidden:  true,
+			Handler: c.Rollback,
+		},
+	}
+}
+
+func (c *CorpusController) Routes() []server.Route {
+	return routesOf(c.auth, c.Operations())
+}
@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/SaiNageswarS/go-api-boot/logger"
+	"github.com/SaiNageswarS/go-api-boot/server"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/mcp"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/middleware"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/model"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/openapi"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/tenant"
+	"go.uber.org/zap"
+)
+
+type InstructionsController struct {
+	store *mcp.InstructionsStore
+	auth  *middleware.APIKeyAuth
+}
+
+func ProvideInstructionsController(store *mcp.InstructionsStore, auth *middleware.APIKeyAuth) *InstructionsController {
+	return &InstructionsController{store: store, auth: auth}
+}
+
+// GetInstructions returns the requested instructions version rendered for a
+// channel, defaulting to the calling key's version, then the tenant's, then the
+// active one.
+// Paste the custom-gpt rendering into the GPT's Instructions field.
+// GET /instructions?version=v1&channel=custom-gpt
+func (c *InstructionsController) GetInstructions(w http.ResponseWriter, r *http.Request) {
+	version := r.URL.Query().Get("version")
+	if p, ok := middleware.PrincipalFromContext(r.Context()); ok && version == "" {
+		version = p.InstructionsVersion
+	}
+	if t, ok := tenant.FromContext(r.Context()); ok && version == "" {
+		version = t.InstructionsVersion
+	}
+	if version == "" {
+		version = c.store.Active()
+	}
+	channel := mcp.Channel(r.URL.Query().Get("channel"))
+	if channel == "" {
+		channel = mcp.ChannelMCP
+	}
+
+	versions, err := c.store.Versions()
+	if err != nil {
+		logger.Error("Failed to list instructions", zap.Error(err))
+		http.Error(w, "Failed to load instructions", http.StatusInternalServerError)
+		return
+	}
+
+	text, err := c.store.Render(version, channel)
+	if err != nil {
+		logger.Error("Failed to render instructions", zap.String("version", version), zap.String("channel", string(channel)), zap.Error(err))
+		http.Error(w, "Unknown instructions version or channel", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	response := model.InstructionsResponse{
+		Version:      version,
+		Active:       c.store.Active(),
+		Channel:      string(channel),
+		Versions:     versions,
+		Instructions: text,
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Error("Failed to encode instructions response", zap.Error(err))
+	}
+}
+
+func (c *InstructionsController) Operations() []openapi.Operation {
+	return []openapi.Operation{
+		{
+			Method:      http.MethodGet,
+			Pattern:     "/instructions",
+			OperationID: "GetInstructions",
+			Summary:     "Get the assistant instructions",
+			Description: "Returns the active (or requested) instructions version rendered for the MCP server or the Custom GPT.",
+			Params: []openapi.Param{
+				{Name: "version", In: "query", Description: "Instructions version (default: the active one)"},
+				{Name: "channel", In: "query", Description: "mcp (default) or custom-gpt"},
+			},
+			Response: openapi.Response{Description: "Rendered instructions", Body: model.InstructionsResponse{}},
+			Errors:   map[int]string{http.StatusNotFound: "Unknown instructions version or channel"},
+			Scope:    middleware.ScopeDocumentsRead,
+			Hidden:   true, // not an action for the GPT itself
+			Handler:  c.GetInstructions,
+		},
+	}
+}
+
+func (c *InstructionsController) Routes() []server.Route {
+	return routesOf(c.auth, c.Operations())
+}
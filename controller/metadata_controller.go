@@ -6,33 +6,48 @@ import (
 
 	"github.com/SaiNageswarS/go-api-boot/odm"
 	"github.com/SaiNageswarS/go-api-boot/server"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/audit"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/corpus"
 	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
 	"github.com/SaiNageswarS/medicine-rag-custom-gpt/middleware"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/model"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/openapi"
 )
 
 type MetadataController struct {
-	mongo *odm.MongoClient
+	mongo  *odm.MongoClient
+	corpus *corpus.Registry
+	auth   *middleware.APIKeyAuth
 }
 
-func ProvideMetadataController(mongo odm.MongoClient) *MetadataController {
+func ProvideMetadataController(mongo odm.MongoClient, corpus *corpus.Registry, auth *middleware.APIKeyAuth) *MetadataController {
 	return &MetadataController{
-		mongo: &mongo,
+		mongo:  &mongo,
+		corpus: corpus,
+		auth:   auth,
 	}
 }
 
 func (mc *MetadataController) ListSources(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
+	database, err := mc.corpus.Database(ctx)
+	if err != nil {
+		http.Error(w, "Failed to fetch sources", http.StatusInternalServerError)
+		return
+	}
+
 	var distinctSources []string
-	err := odm.CollectionOf[db.ChunkModel](*mc.mongo, "devinderhealthcare").DistinctInto(ctx, "sourceUri", nil, &distinctSources)
+	err = odm.CollectionOf[db.ChunkModel](*mc.mongo, database).DistinctInto(ctx, "sourceUri", nil, &distinctSources)
 	if err != nil {
 		http.Error(w, "Failed to fetch sources", http.StatusInternalServerError)
 		return
 	}
+	audit.SetResults(ctx, len(distinctSources))
 
 	// Return the list of distinct sources as JSON
 	w.Header().Set("Content-Type", "application/json")
-	response := map[string][]string{"sources": distinctSources}
+	response := model.SourcesResponse{Sources: distinctSources}
 
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
@@ -40,12 +55,22 @@ func (mc *MetadataController) ListSources(w http.ResponseWriter, r *http.Request
 	}
 }
 
-func (mc *MetadataController) Routes() []server.Route {
-	return []server.Route{
+func (mc *MetadataController) Operations() []openapi.Operation {
+	return []openapi.Operation{
 		{
-			Pattern: "/metadata/sources",
-			Method:  http.MethodGet,
-			Handler: middleware.APIKeyAuthMiddleware(mc.ListSources),
+			Method:      http.MethodGet,
+			Pattern:     "/metadata/sources",
+			OperationID: "ListSources",
+			Summary:     "List indexed sources",
+			Description: "Returns the distinct source URIs of the hybrid search chunks.",
+			Response:    openapi.Response{Description: "Indexed sources", Body: model.SourcesResponse{}},
+			Errors:      map[int]string{http.StatusInternalServerError: "Internal server error"},
+			Scope:       middleware.ScopeDocumentsRead,
+			Handler:     mc.ListSources,
 		},
 	}
 }
+
+func (mc *MetadataController) Routes() []server.Route {
+	return routesOf(mc.auth, mc.Operations())
+}
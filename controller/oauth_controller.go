@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/SaiNageswarS/go-api-boot/server"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/middleware"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/openapi"
+	"github.com/modelcontextprotocol/go-sdk/auth"
+)
+
+// OAuthController serves the OAuth protected resource metadata (RFC 9728) for
+// /mcp. Without oauth_issuer the routes answer 404.
+type OAuthController struct {
+	metadata http.Handler
+}
+
+func ProvideOAuthController(oauth *middleware.OAuthVerifier) *OAuthController {
+	c := &OAuthController{}
+	if oauth != nil {
+		c.metadata = auth.ProtectedResourceMetadataHandler(oauth.Metadata())
+	}
+	return c
+}
+
+// GetMetadata returns the protected resource metadata.
+// GET /.well-known/oauth-protected-resource[/mcp]
+func (c *OAuthController) GetMetadata(w http.ResponseWriter, r *http.Request) {
+	if c.metadata == nil {
+		http.NotFound(w, r)
+		return
+	}
+	c.metadata.ServeHTTP(w, r)
+}
+
+func (c *OAuthController) Operations() []openapi.Operation {
+	return []openapi.Operation{
+		{
+			Method:      http.MethodGet,
+			Pattern:     middleware.ProtectedResourcePath,
+			OperationID: "GetProtectedResourceMetadata",
+			Summary:     "OAuth protected resource metadata",
+			Public:      true,
+			Hidden:      true,
+			Handler:     c.GetMetadata,
+		},
+		// Clients derive the metadata URL from the resource URL, so the MCP
+		// endpoint's path is appended (RFC 9728 section 3.1).
+		{
+			Method:      http.MethodGet,
+			Pattern:     middleware.ProtectedResourcePath + "/mcp",
+			OperationID: "GetMCPProtectedResourceMetadata",
+			Summary:     "OAuth protected resource metadata for /mcp",
+			Public:      true,
+			Hidden:      true,
+			Handler:     c.GetMetadata,
+		},
+	}
+}
+
+func (c *OAuthController) Routes() []server.Route {
+	return routesOf(nil, c.Operations())
+}
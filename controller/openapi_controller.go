@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/SaiNageswarS/go-api-boot/logger"
+	"github.com/SaiNageswarS/go-api-boot/server"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/appconfig"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/openapi"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/tenant"
+	"go.uber.org/zap"
+)
+
+// OpenAPIFile is the committed copy of the document, imported into the Custom GPT.
+const OpenAPIFile = "openapi-schema.json"
+
+var apiInfo = openapi.Info{
+	Title:       "Homeopathy Medicinal Knowledge Base",
+	Description: "Retrieves homeopathy materia medica content. Use ListDocuments to browse medicines, GetDocumentStructure to see section outlines, and GetDocumentContent to read full text.",
+	Version:     "1.0.0",
+}
+
+type OpenAPIController struct {
+	ccfg    *appconfig.AppConfig
+	tenants *tenant.Registry
+}
+
+func ProvideOpenAPIController(ccfg *appconfig.AppConfig, tenants *tenant.Registry) *OpenAPIController {
+	return &OpenAPIController{ccfg: ccfg, tenants: tenants}
+}
+
+// OpenAPIDocument generates the OpenAPI document for every documented controller.
+func OpenAPIDocument(serverURL string) ([]byte, error) {
+	var ops []openapi.Operation
+	for _, c := range documented {
+		ops = append(ops, c.Operations()...)
+	}
+
+	doc, err := openapi.Build(apiInfo, serverURL, ops)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Marshal()
+}
+
+// GetOpenAPI serves the generated document. The server URL is public_url from
+// config, or the URL the request came in on. Fetched as /t/{tenant}/openapi.json,
+// the server URL carries the tenant prefix, so a Custom GPT importing it only
+// ever reads that tenant.
+// GET /openapi.json
+func (c *OpenAPIController) GetOpenAPI(w http.ResponseWriter, r *http.Request) {
+	serverURL := c.ccfg.PublicURL
+	if serverURL == "" {
+		scheme := "http"
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		serverURL = scheme + "://" + r.Host
+	}
+	if id := tenant.Requested(r.Context()); id != "" {
+		if _, ok := c.tenants.Get(id); !ok {
+			http.Error(w, "Unknown tenant", http.StatusNotFound)
+			return
+		}
+		serverURL += tenant.PathPrefix + id
+	}
+
+	body, err := OpenAPIDocument(serverURL)
+	if err != nil {
+		logger.Error("Failed to generate OpenAPI document", zap.Error(err))
+		http.Error(w, "Failed to generate OpenAPI document", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(body); err != nil {
+		logger.Error("Failed to write OpenAPI document", zap.Error(err))
+	}
+}
+
+func (c *OpenAPIController) Operations() []openapi.Operation {
+	return []openapi.Operation{
+		{
+			Method:      http.MethodGet,
+			Pattern:     "/openapi.json",
+			OperationID: "GetOpenAPI",
+			Summary:     "This OpenAPI document",
+			Response:    openapi.Response{Description: "OpenAPI 3.1 document"},
+			Public:      true,
+			Hidden:      true,
+			Handler:     c.GetOpenAPI,
+		},
+	}
+}
+
+func (c *OpenAPIController) Routes() []server.Route {
+	return routesOf(nil, c.Operations()) // public only
+}
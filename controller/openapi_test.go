@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/SaiNageswarS/go-api-boot/config"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/appconfig"
+)
+
+// TestOpenAPIDocumentIsCommitted fails when openapi-schema.json is not the
+// document the controllers generate with the prod public_url.
+func TestOpenAPIDocumentIsCommitted(t *testing.T) {
+	t.Setenv("ENV", "prod")
+	ccfg := &appconfig.AppConfig{}
+	if err := config.LoadConfig("../config.ini", ccfg); err != nil {
+		t.Fatal(err)
+	}
+
+	generated, err := OpenAPIDocument(ccfg.PublicURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	committed, err := os.ReadFile("../" + OpenAPIFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(committed, generated) {
+		t.Errorf("%s is out of date; run: ENV=prod go run . openapi", OpenAPIFile)
+	}
+}
@@ -2,23 +2,31 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/SaiNageswarS/go-api-boot/logger"
-	"github.com/SaiNageswarS/go-api-boot/odm"
 	"github.com/SaiNageswarS/go-api-boot/server"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/appconfig"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/audit"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
 	"github.com/SaiNageswarS/medicine-rag-custom-gpt/mcp"
 	"github.com/SaiNageswarS/medicine-rag-custom-gpt/middleware"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/openapi"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/relations"
 	"go.uber.org/zap"
 )
 
 type PageIndexController struct {
-	svc *mcp.PageIndexService
+	svc   *mcp.PageIndexService
+	graph *relations.Graph
+	files bool // documents served from pageindex_dir; the graph is of those in MongoDB
+	auth  *middleware.APIKeyAuth
 }
 
-func ProvidePageIndexController(mongo odm.MongoClient) *PageIndexController {
-	return &PageIndexController{svc: mcp.ProvidePageIndexService(mongo)}
+func ProvidePageIndexController(svc *mcp.PageIndexService, graph *relations.Graph, ccfg *appconfig.AppConfig, auth *middleware.APIKeyAuth) *PageIndexController {
+	return &PageIndexController{svc: svc, graph: graph, files: ccfg.PageIndexDir != "", auth: auth}
 }
 
 // ListDocuments returns all documents with their descriptions (no tree structure).
@@ -30,6 +38,7 @@ func (c *PageIndexController) ListDocuments(w http.ResponseWriter, r *http.Reque
 		http.Error(w, "Failed to list documents", http.StatusInternalServerError)
 		return
 	}
+	audit.SetResults(r.Context(), len(docs))
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(docs); err != nil {
@@ -46,12 +55,14 @@ func (c *PageIndexController) GetDocumentStructure(w http.ResponseWriter, r *htt
 		return
 	}
 
+	audit.SetDoc(r.Context(), docID)
 	structure, err := c.svc.GetDocumentStructure(r.Context(), docID)
 	if err != nil {
 		logger.Error("Failed to find document", zap.String("docId", docID), zap.Error(err))
 		http.Error(w, "Document not found", http.StatusNotFound)
 		return
 	}
+	audit.SetResults(r.Context(), len(structure))
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(structure); err != nil {
@@ -74,12 +85,22 @@ func (c *PageIndexController) GetDocumentContent(w http.ResponseWriter, r *http.
 		return
 	}
 
+	audit.SetDoc(r.Context(), docID)
 	nodes, err := c.svc.GetDocumentContent(r.Context(), docID, linesParam)
+	if errors.Is(err, mcp.ErrDocumentNotFound) {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, mcp.ErrInvalidLines) {
+		http.Error(w, "Invalid lines parameter (e.g. lines=10-25 or lines=5,12,30)", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		logger.Error("Failed to get document content", zap.String("docId", docID), zap.Error(err))
-		http.Error(w, "Failed to get content", http.StatusBadRequest)
+		http.Error(w, "Failed to get content", http.StatusInternalServerError)
 		return
 	}
+	audit.SetResults(r.Context(), len(nodes))
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(nodes); err != nil {
@@ -87,24 +108,98 @@ func (c *PageIndexController) GetDocumentContent(w http.ResponseWriter, r *http.
 	}
 }
 
-func (c *PageIndexController) Routes() []server.Route {
-	return []server.Route{
+// GetRelationships returns the remedies related to a document by relation
+// type, with the passages that relate them.
+// GET /documents/{id}/relationships
+func (c *PageIndexController) GetRelationships(w http.ResponseWriter, r *http.Request) {
+	docID := extractPathParam(r.URL.Path, "/documents/", "/relationships")
+	if docID == "" {
+		http.Error(w, "Document ID is required", http.StatusBadRequest)
+		return
+	}
+
+	audit.SetDoc(r.Context(), docID)
+	rel, err := c.graph.Neighbours(r.Context(), docID)
+	if errors.Is(err, relations.ErrNotFound) {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to get relationships", zap.String("docId", docID), zap.Error(err))
+		http.Error(w, "Failed to get relationships", http.StatusInternalServerError)
+		return
+	}
+	audit.SetResults(r.Context(), rel.Count())
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(rel); err != nil {
+		logger.Error("Failed to encode relationships response", zap.Error(err))
+	}
+}
+
+func (c *PageIndexController) Operations() []openapi.Operation {
+	docID := openapi.Param{Name: "id", In: "path", Description: "Document ID (e.g. ACONITUM, BRYONIA)"}
+	ops := []openapi.Operation{
 		{
-			Pattern: "/documents",
-			Method:  http.MethodGet,
-			Handler: middleware.APIKeyAuthMiddleware(c.ListDocuments),
+			Method:      http.MethodGet,
+			Pattern:     "/documents",
+			OperationID: "ListDocuments",
+			Summary:     "List all medicine documents with descriptions",
+			Description: "Returns all indexed medicine documents with AI-generated descriptions.",
+			Response:    openapi.Response{Description: "List of documents with descriptions", Body: []mcp.DocSummary(nil)},
+			Errors:      map[int]string{http.StatusInternalServerError: "Internal server error"},
+			Scope:       middleware.ScopeDocumentsRead,
+			Handler:     c.ListDocuments,
 		},
 		{
-			Pattern: "/documents/{id}/structure",
-			Method:  http.MethodGet,
-			Handler: middleware.APIKeyAuthMiddleware(c.GetDocumentStructure),
+			Method:      http.MethodGet,
+			Pattern:     "/documents/{id}/structure",
+			OperationID: "GetDocumentStructure",
+			Summary:     "Get section tree of a medicine document",
+			Description: "Returns the hierarchical section tree of a medicine document with AI-generated summaries.",
+			Params:      []openapi.Param{docID},
+			Response:    openapi.Response{Description: "Tree structure with summaries", Body: []db.PageIndexNode(nil)},
+			Errors:      map[int]string{http.StatusNotFound: "Document not found"},
+			Scope:       middleware.ScopeDocumentsRead,
+			Handler:     c.GetDocumentStructure,
 		},
 		{
-			Pattern: "/documents/{id}/content",
-			Method:  http.MethodGet,
-			Handler: middleware.APIKeyAuthMiddleware(c.GetDocumentContent),
+			Method:      http.MethodGet,
+			Pattern:     "/documents/{id}/content",
+			OperationID: "GetDocumentContent",
+			Summary:     "Get full text for sections by line range",
+			Description: "Returns full text content for tree nodes whose line numbers fall within the requested range.",
+			Params: []openapi.Param{docID, {
+				Name:        "lines",
+				In:          "query",
+				Required:    true,
+				Description: "Line range to fetch. Supports: single range '10-25', comma-separated numbers '5,12,30', or comma-separated ranges '19-34,321-349'",
+			}},
+			Response: openapi.Response{Description: "Content for matching nodes", Body: []mcp.NodeContent(nil)},
+			Errors:   map[int]string{http.StatusBadRequest: "Invalid or missing lines parameter", http.StatusNotFound: "Document not found"},
+			Scope:    middleware.ScopeDocumentsRead,
+			Handler:  c.GetDocumentContent,
 		},
 	}
+	if c.files {
+		return ops
+	}
+	return append(ops, openapi.Operation{
+		Method:      http.MethodGet,
+		Pattern:     "/documents/{id}/relationships",
+		OperationID: "GetRemedyRelationships",
+		Summary:     "Get remedies related to a medicine document",
+		Description: "Returns the complementary, inimical, antidote, follows-well and compare remedies named in the document's relationship sections, and the remedies whose sections name it, each with the passages as citations.",
+		Params:      []openapi.Param{docID},
+		Response:    openapi.Response{Description: "Related remedies by relation type", Body: relations.Relationships{}},
+		Errors:      map[int]string{http.StatusNotFound: "Document not found"},
+		Scope:       middleware.ScopeDocumentsRead,
+		Handler:     c.GetRelationships,
+	})
+}
+
+func (c *PageIndexController) Routes() []server.Route {
+	return routesOf(c.auth, c.Operations())
 }
 
 // --- helpers ---
@@ -7,15 +7,17 @@ import (
 
 	"github.com/SaiNageswarS/go-api-boot/logger"
 	"github.com/SaiNageswarS/go-api-boot/server"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/appconfig"
 	"github.com/SaiNageswarS/medicine-rag-custom-gpt/templates"
 	"go.uber.org/zap"
 )
 
 type PrivacyController struct {
+	ccfg *appconfig.AppConfig
 }
 
-func ProvidePrivacyController() *PrivacyController {
-	return &PrivacyController{}
+func ProvidePrivacyController(ccfg *appconfig.AppConfig) *PrivacyController {
+	return &PrivacyController{ccfg: ccfg}
 }
 
 func (pc *PrivacyController) HandlePrivacyPolicy(w http.ResponseWriter, r *http.Request) {
@@ -28,10 +30,13 @@ func (pc *PrivacyController) HandlePrivacyPolicy(w http.ResponseWriter, r *http.
 	}
 
 	// Prepare template data
+	// The policy states what strip_pii_before_embedding does, not what it should.
 	data := struct {
 		LastUpdated string
+		StripPII    bool
 	}{
 		LastUpdated: time.Now().Format("January 2006"),
+		StripPII:    pc.ccfg.StripPIIBeforeEmbedding,
 	}
 
 	// Set response headers
@@ -1,69 +1,173 @@
 package controller
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/SaiNageswarS/agent-boot/agentboot"
 	"github.com/SaiNageswarS/agent-boot/llm"
-	embedder "github.com/SaiNageswarS/go-api-boot/embed"
 	"github.com/SaiNageswarS/go-api-boot/logger"
 	"github.com/SaiNageswarS/go-api-boot/odm"
 	"github.com/SaiNageswarS/go-api-boot/server"
 	"github.com/SaiNageswarS/medicine-rag-custom-gpt/appconfig"
-	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/audit"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/cases"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/corpus"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/embedding"
 	"github.com/SaiNageswarS/medicine-rag-custom-gpt/mcp"
 	"github.com/SaiNageswarS/medicine-rag-custom-gpt/middleware"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/model"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/openapi"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/redact"
 	"go.uber.org/zap"
 )
 
+const (
+	maxQueryBodyBytes = 64 << 10
+	maxQueryLength    = 8000 // characters, about four pages of case notes
+	maxQuerySources   = 20
+	maxQueryLimit     = 10 // SearchTool returns at most 10 chunks, so sections
+)
+
 // QueryController handles HTTP requests for query operations
 type QueryController struct {
 	ccfg               *appconfig.AppConfig
-	tool               *mcp.SearchTool
+	mongo              odm.MongoClient
+	corpus             *corpus.Registry
+	embedder           *embedding.Model
 	toolResultRenderer *agentboot.ToolResultRenderer
+	cases              *cases.Store
+	auth               *middleware.APIKeyAuth
 }
 
 // ProvideQueryController creates a new QueryController instance
 // Creates a minimal agent with just the tool (no orchestration components)
 // to leverage RunTool's nice wrappers (markdown formatting, summarization, etc.)
-func ProvideQueryController(mongo odm.MongoClient, embedder embedder.Embedder, ccfg *appconfig.AppConfig) *QueryController {
-	chunkRepository := odm.CollectionOf[db.ChunkModel](mongo, "devinderhealthcare")
-	vectorRepository := odm.CollectionOf[db.ChunkAnnModel](mongo, "devinderhealthcare")
-
-	search := mcp.NewSearchTool(chunkRepository, vectorRepository, embedder)
+func ProvideQueryController(mongo odm.MongoClient, corpus *corpus.Registry, embedder *embedding.Model, ccfg *appconfig.AppConfig, store *cases.Store, auth *middleware.APIKeyAuth) *QueryController {
 	llmClient := llm.NewAnthropicClient("claude-3-5-haiku-20241022")
 
 	toolResultRenderer := agentboot.NewToolResultRenderer(agentboot.WithSummarizationModel(llmClient))
 
 	return &QueryController{
-		tool:               search,
+		mongo:              mongo,
+		corpus:             corpus,
+		embedder:           embedder,
 		toolResultRenderer: toolResultRenderer,
 		ccfg:               ccfg,
+		cases:              store,
+		auth:               auth,
 	}
 }
 
+// HandleQuery searches for the query parameter.
+// GET /search?query=...&caseId=...
 func (c *QueryController) HandleQuery(w http.ResponseWriter, r *http.Request) {
-	// Get query from URL parameters
-	query := r.URL.Query().Get("query")
+	c.search(w, r, model.QueryRequest{Query: r.URL.Query().Get("query"), CaseID: r.URL.Query().Get("caseId")})
+}
+
+// HandleQueryPost searches for a JSON body, which keeps long case notes out of
+// URLs and access logs.
+// POST /search
+func (c *QueryController) HandleQueryPost(w http.ResponseWriter, r *http.Request) {
+	var req model.QueryRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxQueryBodyBytes)).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	audit.SetArg(r.Context(), "query", req.Query)
+	audit.SetArg(r.Context(), "sources", strings.Join(req.Sources, ","))
+	audit.SetArg(r.Context(), "caseId", req.CaseID)
+	c.search(w, r, req)
+}
+
+// search validates req and writes the matching passages as markdown.
+func (c *QueryController) search(w http.ResponseWriter, r *http.Request, req model.QueryRequest) {
+	query := req.Query
 
 	// Validate query
-	if query == "" {
+	switch {
+	case query == "":
 		http.Error(w, "Query is required", http.StatusBadRequest)
 		return
+	case utf8.RuneCountInString(query) > maxQueryLength:
+		http.Error(w, fmt.Sprintf("Query is longer than %d characters", maxQueryLength), http.StatusBadRequest)
+		return
+	case len(req.Sources) > maxQuerySources:
+		http.Error(w, fmt.Sprintf("At most %d sources can be given", maxQuerySources), http.StatusBadRequest)
+		return
+	case req.Limit < 0 || req.Limit > maxQueryLimit:
+		http.Error(w, fmt.Sprintf("limit must be between 0 and %d (0: all)", maxQueryLimit), http.StatusBadRequest)
+		return
+	}
+
+	// Patient details do not help retrieval; keep them from the embedding
+	// provider (and the summarization model) when configured.
+	searchQuery := query
+	if c.ccfg.StripPIIBeforeEmbedding {
+		searchQuery = redact.Strip(query)
+		if searchQuery == "" {
+			http.Error(w, "Query contains only personal details", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// A saved case personalises retrieval with its leading symptoms. The
+	// passages are still rendered for the query alone.
+	ctx := r.Context()
+	retrievalQuery := searchQuery
+	if req.CaseID != "" {
+		p, _ := middleware.PrincipalFromContext(ctx)
+		if !p.HasScope(middleware.ScopeCases) {
+			http.Error(w, "API key lacks the cases scope", http.StatusForbidden)
+			return
+		}
+		found, err := c.cases.Get(ctx, p.KeyID, req.CaseID)
+		if errors.Is(err, cases.ErrNotFound) {
+			http.Error(w, "Case not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to read case", zap.String("caseId", req.CaseID), zap.Error(err))
+			http.Error(w, "Failed to run search", http.StatusInternalServerError)
+			return
+		}
+		caseContext := cases.SearchContext(found)
+		if c.ccfg.StripPIIBeforeEmbedding {
+			caseContext = redact.Strip(caseContext)
+		}
+		if caseContext != "" {
+			retrievalQuery += "\n" + caseContext
+		}
 	}
 
 	// Use agent.RunTool which provides nice wrappers (markdown formatting, summarization, etc.)
 	// without needing full agent orchestration
-	ctx := r.Context()
-	toolResultsChan := c.tool.Run(ctx, query)
+	search, err := c.searchTool(ctx)
+	if err != nil {
+		logger.Error("Failed to resolve search collections", zap.Error(err))
+		http.Error(w, "Failed to run search", http.StatusInternalServerError)
+		return
+	}
+	toolResultsChan := search.RunWithOptions(ctx, retrievalQuery, mcp.SearchOptions{Sources: req.Sources, MaxSections: req.Limit})
 
-	formattedPassages, err := c.toolResultRenderer.Render(ctx, query, "", toolResultsChan, c.ccfg.EnableSearchSummarization)
+	formattedPassages, err := c.toolResultRenderer.Render(ctx, searchQuery, "", toolResultsChan, c.ccfg.EnableSearchSummarization)
 	if err != nil {
 		logger.Error("Failed to render tool results", zap.Error(err))
 		http.Error(w, "Failed to render tool results", http.StatusInternalServerError)
 		return
 	}
+	audit.SetResults(ctx, len(formattedPassages))
 
 	// Set response headers for markdown
 	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
@@ -76,15 +180,62 @@ func (c *QueryController) HandleQuery(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	logger.Info("Query processed successfully", zap.String("query", query))
+	logger.Info("Query processed successfully", zap.String("query", redact.Mask(query)))
 }
 
-func (c *QueryController) Routes() []server.Route {
-	return []server.Route{
+// searchTool returns a SearchTool over the chunk collections of the active
+// corpus of the tenant in ctx.
+func (c *QueryController) searchTool(ctx context.Context) (*mcp.SearchTool, error) {
+	return mcp.SearchToolFor(ctx, c.mongo, c.corpus, c.embedder)
+}
+
+func (c *QueryController) Operations() []openapi.Operation {
+	return []openapi.Operation{
+		{
+			Method:      http.MethodGet,
+			Pattern:     "/search",
+			OperationID: "Search",
+			Summary:     "Hybrid vector and keyword search",
+			Description: "Searches materia medica passages with vector and BM25 search fused by Reciprocal Rank Fusion. Returns the passages as markdown with source and section, each with the doc_id, node_id and lines of its section; pass doc_id and lines to GetDocumentContent to read the whole section.",
+			Params: []openapi.Param{{
+				Name:        "query",
+				In:          "query",
+				Required:    true,
+				Description: "Symptoms, remedy names or a question in natural language",
+			}, {
+				Name:        "caseId",
+				In:          "query",
+				Description: "A saved case whose leading symptoms are added to the search (needs the cases scope)",
+			}},
+			Response: openapi.Response{Description: "Matching passages as markdown", ContentType: "text/markdown"},
+			Errors: map[int]string{
+				http.StatusBadRequest:          "Query is required, or contains only personal details",
+				http.StatusNotFound:            "Case not found",
+				http.StatusInternalServerError: "Internal server error",
+			},
+			Scope:   middleware.ScopeSearch,
+			Handler: c.HandleQuery,
+		},
 		{
-			Pattern: "/search",
-			Method:  http.MethodGet,
-			Handler: middleware.APIKeyAuthMiddleware(c.HandleQuery),
+			Method:      http.MethodPost,
+			Pattern:     "/search",
+			OperationID: "SearchCase",
+			Summary:     "Hybrid search for a case description",
+			Description: "Same search as GET /search, for case descriptions too long for a URL. Optionally restricts the search to some sources and limits the passages returned.",
+			Request:     openapi.Request{Description: "The query, with optional filters", Body: model.QueryRequest{}},
+			Response:    openapi.Response{Description: "Matching passages as markdown", ContentType: "text/markdown"},
+			Errors: map[int]string{
+				http.StatusBadRequest:            "Invalid request body or filters, or the query is missing or contains only personal details",
+				http.StatusNotFound:              "Case not found",
+				http.StatusRequestEntityTooLarge: "Request body larger than 64 KiB",
+				http.StatusInternalServerError:   "Internal server error",
+			},
+			Scope:   middleware.ScopeSearch,
+			Handler: c.HandleQueryPost,
 		},
 	}
 }
+
+func (c *QueryController) Routes() []server.Route {
+	return routesOf(c.auth, c.Operations())
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/SaiNageswarS/go-api-boot/server"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/middleware"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/openapi"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/tenant"
+)
+
+// documented lists the controllers whose operations are published in the
+// OpenAPI document. Add new controllers here as well as in main.go. Handlers
+// are never invoked while generating, so zero values suffice.
+var documented = []interface{ Operations() []openapi.Operation }{
+	&PageIndexController{},
+	&QueryController{},
+	&MetadataController{},
+	&InstructionsController{},
+	&OpenAPIController{},
+	&APIKeyController{},
+	&SessionController{},
+	&OAuthController{},
+	&AuditController{},
+	&CaseController{},
+	&CorpusController{},
+}
+
+// routesOf turns operations into routes, requiring an API key with the
+// operation's scope unless it is Public. Except for admin routes, each is also
+// served under /t/{tenant} to select a tenant by URL. go-api-boot registers one
+// handler per pattern, so operations sharing a pattern are dispatched by method.
+func routesOf(auth *middleware.APIKeyAuth, ops []openapi.Operation) []server.Route {
+	var patterns []string
+	byPattern := map[string]map[string]http.HandlerFunc{}
+	add := func(pattern, method string, handler http.HandlerFunc) {
+		if byPattern[pattern] == nil {
+			patterns = append(patterns, pattern)
+			byPattern[pattern] = map[string]http.HandlerFunc{}
+		}
+		byPattern[pattern][method] = handler
+	}
+
+	for _, op := range ops {
+		handler := op.Handler
+		if !op.Public {
+			handler = auth.Require(op.Scope, handler)
+		}
+		add(op.Pattern, op.Method, handler)
+		if op.Scope != middleware.ScopeAdmin {
+			add(tenant.PathPrefix+"{tenant}"+op.Pattern, op.Method, withTenantPrefix(handler))
+		}
+	}
+
+	routes := make([]server.Route, 0, len(patterns))
+	for _, pattern := range patterns {
+		methods := byPattern[pattern]
+		if len(methods) == 1 {
+			for method, handler := range methods {
+				routes = append(routes, server.Route{Pattern: pattern, Method: method, Handler: handler})
+			}
+			continue
+		}
+
+		allowed := make([]string, 0, len(methods))
+		for method := range methods {
+			allowed = append(allowed, method)
+		}
+		slices.Sort(allowed)
+		routes = append(routes, server.Route{
+			Pattern: pattern,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				handler, ok := methods[r.Method]
+				if !ok {
+					w.Header().Set("Allow", strings.Join(allowed, ", "))
+					http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+					return
+				}
+				handler(w, r)
+			},
+		})
+	}
+	return routes
+}
+
+// withTenantPrefix records the tenant named by /t/{tenant} and strips the
+// prefix, so handlers see the same path either way. Require checks the tenant
+// against the caller's key.
+func withTenantPrefix(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("tenant")
+		r = r.WithContext(tenant.WithRequested(r.Context(), id))
+
+		u := *r.URL
+		u.Path = strings.TrimPrefix(u.Path, tenant.PathPrefix+id)
+		u.RawPath = ""
+		r.URL = &u
+		next(w, r)
+	}
+}
@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/SaiNageswarS/go-api-boot/logger"
+	"github.com/SaiNageswarS/go-api-boot/server"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/mcp"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/middleware"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/openapi"
+	"go.uber.org/zap"
+)
+
+// SessionController lists and revokes the MCP sessions open on this instance.
+// All routes require the admin scope.
+type SessionController struct {
+	sessions *mcp.SessionRegistry
+	auth     *middleware.APIKeyAuth
+}
+
+func ProvideSessionController(sessions *mcp.SessionRegistry, auth *middleware.APIKeyAuth) *SessionController {
+	return &SessionController{sessions: sessions, auth: auth}
+}
+
+// ListSessions returns the open MCP sessions and the keys that opened them.
+// GET /admin/sessions
+func (c *SessionController) ListSessions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(c.sessions.List()); err != nil {
+		logger.Error("Failed to encode sessions response", zap.Error(err))
+	}
+}
+
+// RevokeSession closes an MCP session; the client has to initialize again.
+// DELETE /admin/sessions/{id}
+func (c *SessionController) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	sessionID := extractPathParam(r.URL.Path, "/admin/sessions/", "")
+	if sessionID == "" {
+		http.Error(w, "Session ID is required", http.StatusBadRequest)
+		return
+	}
+
+	if !c.sessions.Revoke(sessionID) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	logger.Info("MCP session revoked", zap.String("sessionId", sessionID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *SessionController) Operations() []openapi.Operation {
+	return []openapi.Operation{
+		{
+			Method:      http.MethodGet,
+			Pattern:     "/admin/sessions",
+			OperationID: "ListMCPSessions",
+			Summary:     "List open MCP sessions",
+			Response:    openapi.Response{Description: "Open sessions, most recently active first", Body: []mcp.SessionInfo(nil)},
+			Scope:       middleware.ScopeAdmin,
+			Hidden:      true,
+			Handler:     c.ListSessions,
+		},
+		{
+			Method:      http.MethodDelete,
+			Pattern:     "/admin/sessions/{id}",
+			OperationID: "RevokeMCPSession",
+			Summary:     "Close an MCP session",
+			Params:      []openapi.Param{{Name: "id", In: "path", Description: "Mcp-Session-Id of the session"}},
+			Scope:       middleware.ScopeAdmin,
+			Hidden:      true,
+			Handler:     c.RevokeSession,
+		},
+	}
+}
+
+func (c *SessionController) Routes() []server.Route {
+	return routesOf(c.auth, c.Operations())
+}
@@ -0,0 +1,194 @@
+package corpus
+
+import (
+	"context"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/embedding"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// maxListed caps the items a Finding lists; its count is always complete.
+const maxListed = 100
+
+// Report is what Verify found in the database of a corpus. pageindex_docs and
+// the chunk collections are written separately, by build_pageindex.py and by
+// ingest -chunks, so they can disagree.
+type Report struct {
+	Database  string `json:"database"`
+	Documents int    `json:"documents"` // in pageindex_docs
+	Chunks    int    `json:"chunks"`
+	Model     string `json:"model"`   // embedding model whose vectors were checked
+	Vectors   int    `json:"vectors"` // of Model
+
+	DocumentsWithoutChunks Finding `json:"documentsWithoutChunks"` // remedy IDs with a document but no chunks
+	ChunksWithoutDocuments Finding `json:"chunksWithoutDocuments"` // chunk sources whose remedy has no document
+	DanglingLinks          Finding `json:"danglingLinks"`          // "<chunk> prevChunkId|nextChunkId <missing chunk>"
+	ChunksWithoutVectors   Finding `json:"chunksWithoutVectors"`   // chunk IDs
+	VectorsWithoutChunks   Finding `json:"vectorsWithoutChunks"`   // chunk IDs
+	NodesWithoutText       Finding `json:"nodesWithoutText"`       // "<remedy>/<node ID>"
+}
+
+// Finding is one kind of inconsistency: how often it occurs and, sorted, the
+// first maxListed occurrences.
+type Finding struct {
+	Count int      `json:"count"`
+	Items []string `json:"items,omitempty"`
+}
+
+func (f *Finding) add(item string) {
+	f.Count++
+	f.Items = append(f.Items, item)
+}
+
+func (f *Finding) finish() {
+	slices.Sort(f.Items)
+	if len(f.Items) > maxListed {
+		f.Items = f.Items[:maxListed]
+	}
+}
+
+// Problems returns the number of inconsistencies found.
+func (r *Report) Problems() int {
+	n := 0
+	for _, f := range r.Findings() {
+		n += f.Count
+	}
+	return n
+}
+
+// NamedFinding is a Finding of a Report with the JSON name of its field.
+type NamedFinding struct {
+	Name string
+	*Finding
+}
+
+// Findings returns the findings of r in report order.
+func (r *Report) Findings() []NamedFinding {
+	return []NamedFinding{
+		{"documentsWithoutChunks", &r.DocumentsWithoutChunks},
+		{"chunksWithoutDocuments", &r.ChunksWithoutDocuments},
+		{"danglingLinks", &r.DanglingLinks},
+		{"chunksWithoutVectors", &r.ChunksWithoutVectors},
+		{"vectorsWithoutChunks", &r.VectorsWithoutChunks},
+		{"nodesWithoutText", &r.NodesWithoutText},
+	}
+}
+
+// Verify cross-checks the documents, chunks and vectors of database, those of
+// the active embedding model, the one searched. A
+// chunk's remedy is the base name of its source URI, file://articles/ACONITUM.md
+// being ACONITUM's, as the ingest command names documents after their file.
+// Reading everything, it is meant for the CLI and admins, not for every request.
+func (r *Registry) Verify(ctx context.Context, database string) (*Report, error) {
+	dbh := r.mongo.Database(database)
+	model := r.models.Active()
+	report := &Report{Database: database, Model: model.ID}
+
+	docs, err := findAll[db.PageIndexDocModel](ctx, dbh.Collection(db.PageIndexDocModel{}.CollectionName()), nil)
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := findAll[db.ChunkModel](ctx, dbh.Collection(db.ChunkModel{}.CollectionName()),
+		bson.M{"sourceUri": 1, "prevChunkId": 1, "nextChunkId": 1})
+	if err != nil {
+		return nil, err
+	}
+	vectors, err := findAll[db.ChunkAnnModel](ctx, embedding.Vectors(dbh, model), bson.M{"_id": 1})
+	if err != nil {
+		return nil, err
+	}
+	report.Documents, report.Chunks, report.Vectors = len(docs), len(chunks), len(vectors)
+
+	documented := make(map[string]bool, len(docs))
+	for _, d := range docs {
+		documented[d.DocID] = true
+		walkNodes(d.Structure, func(n db.PageIndexNode) {
+			if strings.TrimSpace(n.Text) == "" {
+				report.NodesWithoutText.add(d.DocID + "/" + n.NodeID)
+			}
+		})
+	}
+
+	chunked := make(map[string]bool, len(chunks))
+	for _, c := range chunks {
+		chunked[c.ChunkID] = true
+	}
+	sources := map[string]bool{}
+	chunkedDocs := map[string]bool{}
+	for _, c := range chunks {
+		for _, link := range []struct{ field, target string }{{"prevChunkId", c.PrevChunkID}, {"nextChunkId", c.NextChunkID}} {
+			if link.target != "" && !chunked[link.target] {
+				report.DanglingLinks.add(c.ChunkID + " " + link.field + " " + link.target)
+			}
+		}
+		if sources[c.SourceURI] {
+			continue
+		}
+		sources[c.SourceURI] = true
+		remedy := SourceDocID(c.SourceURI)
+		chunkedDocs[remedy] = true
+		if !documented[remedy] {
+			report.ChunksWithoutDocuments.add(c.SourceURI)
+		}
+	}
+	for _, d := range docs {
+		if !chunkedDocs[d.DocID] {
+			report.DocumentsWithoutChunks.add(d.DocID)
+		}
+	}
+
+	embedded := make(map[string]bool, len(vectors))
+	for _, v := range vectors {
+		embedded[v.ChunkID] = true
+		if !chunked[v.ChunkID] {
+			report.VectorsWithoutChunks.add(v.ChunkID)
+		}
+	}
+	for _, c := range chunks {
+		if !embedded[c.ChunkID] {
+			report.ChunksWithoutVectors.add(c.ChunkID)
+		}
+	}
+
+	for _, f := range report.Findings() {
+		f.finish()
+	}
+	return report, nil
+}
+
+// SourceDocID returns the ID of the document of a chunk source URI, the base
+// name of the file: ACONITUM for file://articles/ACONITUM.md.
+func SourceDocID(uri string) string {
+	base := path.Base(uri)
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
+func walkNodes(nodes []db.PageIndexNode, visit func(db.PageIndexNode)) {
+	for _, n := range nodes {
+		visit(n)
+		walkNodes(n.Nodes, visit)
+	}
+}
+
+// findAll reads a whole collection, only the fields of projection if not nil.
+func findAll[T any](ctx context.Context, coll *mongo.Collection, projection bson.M) ([]T, error) {
+	opts := options.Find()
+	if projection != nil {
+		opts.SetProjection(projection)
+	}
+	cur, err := coll.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var out []T
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,354 @@
+// Package corpus versions the knowledge base of each tenant, so that the API
+// never serves a half-ingested corpus. Ingestion builds a new version, a copy of
+// the active one brought up to date, in a database of its own; promoting it
+// switches every reader over in one write, and rolling back switches them
+// back. Readers resolve the database to read through Registry on every
+// request.
+package corpus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SaiNageswarS/go-api-boot/logger"
+	"github.com/SaiNageswarS/go-api-boot/odm"
+	"github.com/SaiNageswarS/go-collection-boot/async"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/embedding"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/tenant"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+)
+
+// Statuses of a version.
+const (
+	StatusBuilding = "building" // being written by ingestion; cannot be promoted
+	StatusReady    = "ready"
+)
+
+const indexTimeout = time.Minute
+
+// maxSameSecond bounds the versions Create registers within one second.
+const maxSameSecond = 100
+
+var (
+	// ErrNotFound is returned for versions not in the registry.
+	ErrNotFound = errors.New("corpus version not found")
+
+	// ErrNotReady is returned for promoting a version still being built.
+	ErrNotReady = errors.New("corpus version is still building")
+
+	// ErrIndexesBuilding is returned for promoting a version whose search
+	// indexes cannot be queried yet; /search would find nothing in it.
+	ErrIndexesBuilding = errors.New("search indexes of the corpus version are still building")
+
+	// ErrNoRollback is returned for rolling back when no version is active.
+	ErrNoRollback = errors.New("no promoted corpus version to roll back")
+)
+
+// Registry reads and writes the corpus_versions collection of each tenant
+// database.
+type Registry struct {
+	mongo  odm.MongoClient
+	models *embedding.Registry
+}
+
+func ProvideRegistry(mongo odm.MongoClient, tenants *tenant.Registry, models *embedding.Registry) *Registry {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), indexTimeout)
+		defer cancel()
+		for _, database := range tenants.Databases() {
+			if err := odm.EnsureIndexes[db.CorpusVersionModel](ctx, mongo, database); err != nil {
+				logger.Error("Failed to create corpus version indexes", zap.String("database", database), zap.Error(err))
+			}
+		}
+	}()
+	return &Registry{mongo: mongo, models: models}
+}
+
+// Database returns the database of the corpus the tenant in ctx reads.
+func (r *Registry) Database(ctx context.Context) (string, error) {
+	database, err := tenant.Database(ctx)
+	if err != nil {
+		return "", err
+	}
+	return r.ActiveDatabase(ctx, database)
+}
+
+// ActiveDatabase returns the database of the active version of the tenant
+// database tenantDB, or tenantDB itself if no version is active.
+func (r *Registry) ActiveDatabase(ctx context.Context, tenantDB string) (string, error) {
+	v, err := r.Active(ctx, tenantDB)
+	if err != nil || v == nil {
+		return tenantDB, err
+	}
+	return v.Database, nil
+}
+
+// Active returns the active version of tenantDB, or nil if none is. Should a
+// promotion have been interrupted between its writes, the latest promoted wins.
+func (r *Registry) Active(ctx context.Context, tenantDB string) (*db.CorpusVersionModel, error) {
+	found, err := async.Await(r.repo(tenantDB).Find(ctx, bson.M{"active": true}, bson.D{{Key: "promotedAt", Value: -1}}, 1, 0))
+	if err != nil || len(found) == 0 {
+		return nil, err
+	}
+	return &found[0], nil
+}
+
+// List returns the versions of tenantDB, newest first.
+func (r *Registry) List(ctx context.Context, tenantDB string) ([]db.CorpusVersionModel, error) {
+	return async.Await(r.repo(tenantDB).Find(ctx, bson.M{}, bson.D{{Key: "createdAt", Value: -1}}, 0, 0))
+}
+
+// Get returns a version of tenantDB.
+func (r *Registry) Get(ctx context.Context, tenantDB, version string) (*db.CorpusVersionModel, error) {
+	v, err := async.Await(r.repo(tenantDB).FindOneByID(ctx, version))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	return v, err
+}
+
+// Create registers a new version of tenantDB and fills its database with a
+// copy of the active corpus, for ingestion to bring up to date. Copying keeps
+// the embeddings of unchanged chunks, which are the expensive part.
+func (r *Registry) Create(ctx context.Context, tenantDB string) (*db.CorpusVersionModel, error) {
+	if err := odm.EnsureIndexes[db.CorpusVersionModel](ctx, r.mongo, tenantDB); err != nil {
+		return nil, err
+	}
+	active, err := r.Active(ctx, tenantDB)
+	if err != nil {
+		return nil, err
+	}
+	from := tenantDB
+	v := db.CorpusVersionModel{Status: StatusBuilding, CreatedAt: time.Now().UTC()}
+	if active != nil {
+		from, v.Base = active.Database, active.Version
+	}
+	if err := r.register(ctx, tenantDB, &v); err != nil {
+		return nil, err
+	}
+	names := []string{db.PageIndexDocModel{}.CollectionName(), db.ChunkModel{}.CollectionName()}
+	for _, m := range r.models.Models() {
+		names = append(names, m.Collection)
+	}
+	for _, name := range names {
+		if err := r.copyCollection(ctx, from, v.Database, name); err != nil {
+			return nil, fmt.Errorf("copy %s: %w", name, err)
+		}
+	}
+	// Without Atlas Search the search indexes cannot be created; the version
+	// can still serve documents, and Promote reports the missing indexes.
+	if err := r.ensureIndexes(ctx, v.Database); err != nil {
+		logger.Error("Failed to create corpus version indexes", zap.String("database", v.Database), zap.Error(err))
+	}
+	return &v, nil
+}
+
+// register names v after its creation time and inserts it. Names have
+// one-second resolution; a run started in the same second as another gets the
+// next free suffix, v20261018093000-2 and so on, rather than overwriting it.
+func (r *Registry) register(ctx context.Context, tenantDB string, v *db.CorpusVersionModel) error {
+	coll := r.mongo.Database(tenantDB).Collection(v.CollectionName())
+	name := "v" + v.CreatedAt.Format("20060102150405")
+	for n := 1; n <= maxSameSecond; n++ {
+		v.Version = name
+		if n > 1 {
+			v.Version = fmt.Sprintf("%s-%d", name, n)
+		}
+		v.Database = tenantDB + "_" + v.Version
+		_, err := coll.InsertOne(ctx, v)
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("%d corpus versions named %s already", maxSameSecond, name)
+}
+
+// copyCollection replaces collection name of database to with that of from.
+func (r *Registry) copyCollection(ctx context.Context, from, to, name string) error {
+	out := bson.D{{Key: "$out", Value: bson.D{{Key: "db", Value: to}, {Key: "coll", Value: name}}}}
+	cur, err := r.mongo.Database(from).Collection(name).Aggregate(ctx, mongo.Pipeline{out})
+	if err != nil {
+		return err
+	}
+	return cur.Close(ctx)
+}
+
+// ensureIndexes creates the indexes of a version's collections, and the
+// vector index of every registered embedding model, going on past failures so
+// that one missing index does not cost the others.
+func (r *Registry) ensureIndexes(ctx context.Context, database string) error {
+	var errs []error
+	for _, ensure := range []func(context.Context, odm.MongoClient, string) error{
+		odm.EnsureIndexes[db.PageIndexDocModel],
+		odm.EnsureIndexes[db.RemedyRelationModel],
+		odm.EnsureIndexes[db.ChunkModel],
+	} {
+		errs = append(errs, ensure(ctx, r.mongo, database))
+	}
+	for _, m := range r.models.Models() {
+		errs = append(errs, embedding.EnsureIndex(ctx, r.mongo.Database(database), m))
+	}
+	return errors.Join(errs...)
+}
+
+// MarkReady records that ingestion of a version finished, with the size of
+// its corpus, so that it can be promoted.
+func (r *Registry) MarkReady(ctx context.Context, tenantDB, version string) (*db.CorpusVersionModel, error) {
+	v, err := r.Get(ctx, tenantDB, version)
+	if err != nil {
+		return nil, err
+	}
+	dbh := r.mongo.Database(v.Database)
+	docs, err := dbh.Collection(db.PageIndexDocModel{}.CollectionName()).CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := dbh.Collection(db.ChunkModel{}.CollectionName()).CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	v.Status, v.ReadyAt, v.Documents, v.Chunks = StatusReady, time.Now().UTC(), int(docs), int(chunks)
+	if _, err := async.Await(r.repo(tenantDB).Save(ctx, *v)); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Promote makes version the active version of tenantDB. Unless force is set,
+// it refuses while the version's search indexes cannot be queried. Versions
+// older than it are dropped, except the one it replaces, which is kept for
+// Rollback.
+func (r *Registry) Promote(ctx context.Context, tenantDB, version string, force bool) (*db.CorpusVersionModel, error) {
+	v, err := r.Get(ctx, tenantDB, version)
+	if err != nil {
+		return nil, err
+	}
+	if v.Status != StatusReady {
+		return nil, ErrNotReady
+	}
+	if !force {
+		if err := r.checkSearchIndexes(ctx, v.Database); err != nil {
+			return nil, err
+		}
+	}
+
+	active, err := r.Active(ctx, tenantDB)
+	if err != nil {
+		return nil, err
+	}
+	if active != nil && active.Version == v.Version {
+		return v, nil
+	}
+	v.Previous = ""
+	if active != nil {
+		v.Previous = active.Version
+	}
+	if err := r.activate(ctx, tenantDB, v); err != nil {
+		return nil, err
+	}
+	r.dropOlder(ctx, tenantDB, v)
+	return v, nil
+}
+
+// Rollback undoes the last promotion of tenantDB: the version it replaced is
+// active again, or, if it replaced none, the collections of tenantDB itself.
+// The version rolled back stays ready to be promoted again. It returns the
+// version now active, nil for tenantDB's own.
+func (r *Registry) Rollback(ctx context.Context, tenantDB string) (*db.CorpusVersionModel, error) {
+	active, err := r.Active(ctx, tenantDB)
+	if err != nil {
+		return nil, err
+	}
+	if active == nil {
+		return nil, ErrNoRollback
+	}
+	if active.Previous == "" {
+		_, err := r.mongo.Database(tenantDB).Collection(db.CorpusVersionModel{}.CollectionName()).
+			UpdateMany(ctx, bson.M{"active": true}, bson.M{"$set": bson.M{"active": false}})
+		return nil, err
+	}
+
+	previous, err := r.Get(ctx, tenantDB, active.Previous)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", active.Previous, err)
+	}
+	if err := r.activate(ctx, tenantDB, previous); err != nil {
+		return nil, err
+	}
+	return previous, nil
+}
+
+// activate marks v active. Readers switch on the first write, since the latest
+// promoted active version wins; the second deactivates the one it replaced.
+func (r *Registry) activate(ctx context.Context, tenantDB string, v *db.CorpusVersionModel) error {
+	v.Active, v.PromotedAt = true, time.Now().UTC()
+	if _, err := async.Await(r.repo(tenantDB).Save(ctx, *v)); err != nil {
+		return err
+	}
+	_, err := r.mongo.Database(tenantDB).Collection(db.CorpusVersionModel{}.CollectionName()).
+		UpdateMany(ctx, bson.M{"_id": bson.M{"$ne": v.Version}, "active": true}, bson.M{"$set": bson.M{"active": false}})
+	return err
+}
+
+// dropOlder drops the databases of the ready versions created before v, other
+// than the one v replaced. Failures are logged; the versions stay listed and
+// are dropped by a later promotion.
+func (r *Registry) dropOlder(ctx context.Context, tenantDB string, v *db.CorpusVersionModel) {
+	older, err := async.Await(r.repo(tenantDB).Find(ctx, bson.M{
+		"_id":       bson.M{"$nin": bson.A{v.Version, v.Previous}},
+		"status":    StatusReady,
+		"active":    false,
+		"createdAt": bson.M{"$lt": v.CreatedAt},
+	}, nil, 0, 0))
+	if err != nil {
+		logger.Error("Failed to list old corpus versions", zap.String("database", tenantDB), zap.Error(err))
+		return
+	}
+	for _, old := range older {
+		if err := r.mongo.Database(old.Database).Drop(ctx); err != nil {
+			logger.Error("Failed to drop corpus version", zap.String("version", old.Version), zap.Error(err))
+			continue
+		}
+		if _, err := async.Await(r.repo(tenantDB).DeleteByID(ctx, old.Version)); err != nil {
+			logger.Error("Failed to unregister corpus version", zap.String("version", old.Version), zap.Error(err))
+		}
+	}
+}
+
+// checkSearchIndexes returns ErrIndexesBuilding unless every Atlas Search
+// index of the chunks and of the active embedding model's vectors in database
+// can be queried.
+func (r *Registry) checkSearchIndexes(ctx context.Context, database string) error {
+	for _, name := range []string{db.ChunkModel{}.CollectionName(), r.models.Active().Collection} {
+		cur, err := r.mongo.Database(database).Collection(name).SearchIndexes().List(ctx, nil)
+		if err != nil {
+			return err
+		}
+		var indexes []struct {
+			Name      string `bson:"name"`
+			Queryable bool   `bson:"queryable"`
+		}
+		if err := cur.All(ctx, &indexes); err != nil {
+			return err
+		}
+		if len(indexes) == 0 {
+			return fmt.Errorf("%s has no search index: %w", name, ErrIndexesBuilding)
+		}
+		for _, ix := range indexes {
+			if !ix.Queryable {
+				return fmt.Errorf("%s: %w", ix.Name, ErrIndexesBuilding)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Registry) repo(tenantDB string) odm.OdmCollectionInterface[db.CorpusVersionModel] {
+	return odm.CollectionOf[db.CorpusVersionModel](r.mongo, tenantDB)
+}
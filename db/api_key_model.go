@@ -0,0 +1,21 @@
+package db
+
+import "time"
+
+// APIKeyModel is an API key issued to a clinic or integration.
+// Only a hash of the key is stored; the key itself is shown once, on creation.
+type APIKeyModel struct {
+	KeyID               string    `json:"keyId" bson:"_id"`                              // public part of the key, e.g. "3f9a1c07b2de"
+	SecretHash          string    `json:"-" bson:"secretHash"`                           // hex SHA-256 of the full key
+	Name                string    `json:"name" bson:"name"`                              // e.g. "Devinder Healthcare Custom GPT"
+	Scopes              []string  `json:"scopes" bson:"scopes"`                          // e.g. ["search", "documents:read"]
+	ExpiresAt           time.Time `json:"expiresAt,omitzero" bson:"expiresAt,omitempty"` // zero: never expires
+	Disabled            bool      `json:"disabled" bson:"disabled"`
+	InstructionsVersion string    `json:"instructionsVersion,omitempty" bson:"instructionsVersion,omitempty"` // overrides the active version
+	DailyQuota          int       `json:"dailyQuota,omitempty" bson:"dailyQuota,omitempty"`                   // overrides daily_quota; -1: unlimited
+	Tenant              string    `json:"tenant,omitempty" bson:"tenant,omitempty"`                           // the only tenant the key may read; empty: default_tenant, or any for admin keys
+	CreatedOn           int64     `json:"createdOn" bson:"createdOn,omitempty"`                               // Unix seconds, set by odm on insert
+}
+
+func (m APIKeyModel) Id() string             { return m.KeyID }
+func (m APIKeyModel) CollectionName() string { return "api_keys" }
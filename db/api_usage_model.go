@@ -0,0 +1,13 @@
+package db
+
+// APIUsageModel counts the requests an API key made on one UTC day. It backs
+// the daily quotas, shared by all replicas.
+type APIUsageModel struct {
+	ID    string `json:"id" bson:"_id"`      // "<keyId>:<day>"
+	KeyID string `json:"keyId" bson:"keyId"` // API key ID, or "oauth:<sub>"
+	Day   string `json:"day" bson:"day"`     // UTC, e.g. "2026-10-18"
+	Count int64  `json:"count" bson:"count"`
+}
+
+func (m APIUsageModel) Id() string             { return m.ID }
+func (m APIUsageModel) CollectionName() string { return "api_usage" }
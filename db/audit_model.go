@@ -0,0 +1,42 @@
+package db
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// AuditEventModel records one authenticated REST request or MCP call: who made
+// it, what it asked for and how it went.
+type AuditEventModel struct {
+	ID          string            `json:"id" bson:"_id"`
+	Time        time.Time         `json:"time" bson:"time"`
+	KeyID       string            `json:"keyId" bson:"keyId"`
+	KeyName     string            `json:"keyName" bson:"keyName"`
+	Tenant      string            `json:"tenant,omitempty" bson:"tenant,omitempty"`
+	Channel     string            `json:"channel" bson:"channel"`                   // "rest" or "mcp"
+	Action      string            `json:"action" bson:"action"`                     // e.g. "GET /documents/{id}/content" or "tools/call get_page_content"
+	DocID       string            `json:"docId,omitempty" bson:"docId,omitempty"`   // remedy read, if any
+	Args        map[string]string `json:"args,omitempty" bson:"args,omitempty"`     // e.g. lines, query
+	Status      int               `json:"status,omitempty" bson:"status,omitempty"` // HTTP status (REST only)
+	Error       string            `json:"error,omitempty" bson:"error,omitempty"`   // MCP error, if the call failed
+	ResultCount int               `json:"resultCount" bson:"resultCount"`           // documents, nodes or passages returned
+	LatencyMs   int64             `json:"latencyMs" bson:"latencyMs"`
+	ExpiresAt   time.Time         `json:"-" bson:"expiresAt,omitempty"` // removed by the TTL index after this; zero: kept
+}
+
+func (m AuditEventModel) Id() string             { return m.ID }
+func (m AuditEventModel) CollectionName() string { return "audit_events" }
+
+// IndexModels serves GET /admin/audit, newest first, and expires events at
+// expiresAt.
+func (m AuditEventModel) IndexModels() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{Keys: bson.D{{Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "keyId", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "docId", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	}
+}
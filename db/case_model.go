@@ -0,0 +1,67 @@
+package db
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// CaseModel is a patient case worked up in a consultation, saved so a later
+// conversation can pick it up. Cases belong to the API key that saved them and
+// live in the tenant's database.
+type CaseModel struct {
+	ID               string         `json:"id" bson:"_id"`
+	KeyID            string         `json:"keyId" bson:"keyId"`
+	Title            string         `json:"title" bson:"title"`                               // e.g. "Recurrent tonsillitis, child of 6"
+	PatientRef       string         `json:"patientRef,omitempty" bson:"patientRef,omitempty"` // the practice's own reference, e.g. a file number
+	Symptoms         []CaseSymptom  `json:"symptoms" bson:"symptoms"`
+	Citations        []CaseCitation `json:"citations,omitempty" bson:"citations,omitempty"` // remedy passages consulted
+	ChosenRemedy     *ChosenRemedy  `json:"chosenRemedy,omitempty" bson:"chosenRemedy,omitempty"`
+	PreviousRemedies []ChosenRemedy `json:"previousRemedies,omitempty" bson:"previousRemedies,omitempty"` // earlier prescriptions, oldest first; kept by cases.Store
+	FollowUps        []CaseFollowUp `json:"followUps,omitempty" bson:"followUps,omitempty"`
+	CreatedOn        int64          `json:"createdOn" bson:"createdOn,omitempty"` // Unix seconds, set by odm on insert
+	UpdatedAt        time.Time      `json:"updatedAt" bson:"updatedAt"`
+}
+
+// CaseSymptom is one symptom of a case with its place in the hierarchy of
+// symptoms.
+type CaseSymptom struct {
+	Text     string `json:"text" bson:"text" jsonschema:"The symptom in the patient's words or as a rubric"`
+	Category string `json:"category" bson:"category" jsonschema:"mental, general, particular, modality or concomitant"`
+}
+
+// CaseCitation points at a remedy passage retrieved for the case.
+type CaseCitation struct {
+	DocID string `json:"docId" bson:"docId" jsonschema:"The document ID (e.g. ACONITUM)"`
+	Lines string `json:"lines,omitempty" bson:"lines,omitempty" jsonschema:"Line range of the passage, e.g. 19-34"`
+	Title string `json:"title,omitempty" bson:"title,omitempty" jsonschema:"Section title"`
+	Note  string `json:"note,omitempty" bson:"note,omitempty" jsonschema:"Why the passage matters for the case"`
+}
+
+// ChosenRemedy is the remedy prescribed for the case.
+type ChosenRemedy struct {
+	DocID    string    `json:"docId" bson:"docId" jsonschema:"The document ID (e.g. ACONITUM)"`
+	Potency  string    `json:"potency,omitempty" bson:"potency,omitempty" jsonschema:"e.g. 30C or 200C"`
+	Reason   string    `json:"reason,omitempty" bson:"reason,omitempty" jsonschema:"The keynotes that decided the choice"`
+	ChosenAt time.Time `json:"chosenAt,omitzero" bson:"chosenAt,omitempty" jsonschema:"When it was chosen (default: when saved)"`
+}
+
+// CaseFollowUp is an entry from a follow-up consultation. A consultation that
+// found, say, amelioration of the chief complaint and a new symptom is saved as
+// two entries.
+type CaseFollowUp struct {
+	Date     time.Time `json:"date,omitzero" bson:"date" jsonschema:"Date of the follow-up (default: when saved)"`
+	Response string    `json:"response,omitempty" bson:"response,omitempty" jsonschema:"amelioration, aggravation, new_symptoms or unchanged"`
+	Notes    string    `json:"notes" bson:"notes" jsonschema:"How the patient responded"`
+}
+
+func (m CaseModel) Id() string             { return m.ID }
+func (m CaseModel) CollectionName() string { return "cases" }
+
+// IndexModels serves listing a key's cases, most recently updated first.
+func (m CaseModel) IndexModels() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{Keys: bson.D{{Key: "keyId", Value: 1}, {Key: "updatedAt", Value: -1}}},
+	}
+}
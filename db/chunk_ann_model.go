@@ -1,34 +1,23 @@
 package db
 
 import (
-	"github.com/SaiNageswarS/go-api-boot/odm"
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
-const VectorIndexName = "chunkEmbeddingIndex"
 const VectorPath = "embedding"
 
-const EmbeddingDimensions = 2048 // jina ai 4
-
+// ChunkAnnModel is the vector of a chunk embedded with one model. Each
+// embedding model registered in config.ini keeps its vectors in a collection
+// of its own, with a vector index of its dimensions; see package embedding.
+// CollectionName is that of the model vectors were embedded with before
+// models were registered.
 type ChunkAnnModel struct {
-	ChunkID   string      `json:"chunkId" bson:"_id"` // Unique
-	Embedding bson.Vector `json:"-" bson:"embedding"` // Embedding vector for the chunk, not serialized in JSON
+	ChunkID     string      `json:"chunkId" bson:"_id"`                                 // Unique
+	Embedding   bson.Vector `json:"-" bson:"embedding"`                                 // Embedding vector for the chunk, not serialized in JSON
+	ContentHash string      `json:"contentHash,omitempty" bson:"contentHash,omitempty"` // ChunkModel.ContentHash of the text embedded
+	Model       string      `json:"model,omitempty" bson:"model,omitempty"`             // ID of the embedding model; empty for vectors stored before models were registered
 }
 
 func (m ChunkAnnModel) Id() string { return m.ChunkID }
 
 func (m ChunkAnnModel) CollectionName() string { return "chunk_ann_index" }
-
-// Indexes
-func (m ChunkAnnModel) VectorIndexSpecs() []odm.VectorIndexSpec {
-	return []odm.VectorIndexSpec{
-		{
-			Name:          VectorIndexName,
-			Path:          VectorPath,
-			Type:          "vector",
-			NumDimensions: EmbeddingDimensions,
-			Similarity:    "cosine",
-			Quantization:  "scalar",
-		},
-	}
-}
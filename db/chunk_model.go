@@ -19,8 +19,14 @@ type ChunkModel struct {
 	Sentences    []string          `json:"sentences" bson:"sentences"`       // Sentences in the chunk, used for text search
 	PrevChunkID  string            `json:"prevChunkId" bson:"prevChunkId"`   // ID of the previous chunk in the sequence
 	NextChunkID  string            `json:"nextChunkId" bson:"nextChunkId"`
-	SectionID    string            `bson:"sectionId" json:"sectionId"`     // stable hash for the *section* (same for all windows of that section)
-	WindowIndex  int               `bson:"windowIndex" json:"windowIndex"` // 0-based window order *within* section
+	SectionID    string            `bson:"sectionId" json:"sectionId"`                         // stable hash for the *section* (same for all windows of that section)
+	WindowIndex  int               `bson:"windowIndex" json:"windowIndex"`                     // 0-based window order *within* section
+	SectionHash  string            `bson:"sectionHash,omitempty" json:"sectionHash,omitempty"` // content hash of the whole section
+	ContentHash  string            `bson:"contentHash,omitempty" json:"contentHash,omitempty"` // content hash of the embedded text of this window
+	DocID        string            `bson:"docId,omitempty" json:"docId,omitempty"`             // PageIndex document of the section, e.g. ACONITUM
+	NodeID       string            `bson:"nodeId,omitempty" json:"nodeId,omitempty"`           // PageIndex node of the section
+	LineStart    int               `bson:"lineStart,omitempty" json:"lineStart,omitempty"`     // first line of the section in the source markdown, its heading
+	LineEnd      int               `bson:"lineEnd,omitempty" json:"lineEnd,omitempty"`         // last line of the section's own text
 	IsAnchor     bool              `bson:"-" json:"-"`
 }
 
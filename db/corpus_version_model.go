@@ -0,0 +1,38 @@
+package db
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// CorpusVersionModel is one build of a tenant's knowledge base, registered in
+// the tenant's corpus_versions collection by corpus.Registry. A version's
+// pageindex_docs, remedy_relationships, chunks and vector collections live in a
+// database of their own, since collection names come from the model types.
+// The active version is the one the API reads; with none, it reads the
+// collections of the tenant's database as before versions existed.
+type CorpusVersionModel struct {
+	Version    string    `json:"version" bson:"_id"`                   // e.g. v20261018093000
+	Database   string    `json:"database" bson:"database"`             // holds the version's collections
+	Base       string    `json:"base,omitempty" bson:"base,omitempty"` // version it was copied from; empty for the tenant's database
+	Status     string    `json:"status" bson:"status"`                 // building or ready
+	Active     bool      `json:"active" bson:"active"`                 // served by the API
+	Previous   string    `json:"previous,omitempty" bson:"previous"`   // active before this one was promoted; empty for the tenant's database
+	Documents  int       `json:"documents" bson:"documents"`           // pageindex_docs when it was marked ready
+	Chunks     int       `json:"chunks" bson:"chunks"`                 // chunks when it was marked ready
+	CreatedAt  time.Time `json:"createdAt" bson:"createdAt"`
+	ReadyAt    time.Time `json:"readyAt,omitzero" bson:"readyAt,omitempty"`
+	PromotedAt time.Time `json:"promotedAt,omitzero" bson:"promotedAt,omitempty"`
+}
+
+func (m CorpusVersionModel) Id() string             { return m.Version }
+func (m CorpusVersionModel) CollectionName() string { return "corpus_versions" }
+
+// IndexModels serve finding the active version, the latest promoted first.
+func (m CorpusVersionModel) IndexModels() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{Keys: bson.D{{Key: "active", Value: 1}, {Key: "promotedAt", Value: -1}}},
+	}
+}
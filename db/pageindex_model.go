@@ -8,17 +8,19 @@ type PageIndexDocModel struct {
 	DocDescription string          `json:"docDescription" bson:"docDescription"`
 	LineCount      int             `json:"lineCount" bson:"lineCount"`
 	Structure      []PageIndexNode `json:"structure" bson:"structure"`
+	ContentHash    string          `json:"-" bson:"contentHash,omitempty"` // of the article file; set by the ingest command
 }
 
 // PageIndexNode is a single node in the PageIndex tree.
 type PageIndexNode struct {
-	Title         string          `json:"title" bson:"title"`
-	NodeID        string          `json:"node_id" bson:"node_id"`
-	LineNum       int             `json:"line_num" bson:"line_num"`
-	Summary       string          `json:"summary,omitempty" bson:"summary,omitempty"`
-	PrefixSummary string          `json:"prefix_summary,omitempty" bson:"prefix_summary,omitempty"`
-	Text          string          `json:"text,omitempty" bson:"text,omitempty"`
-	Nodes         []PageIndexNode `json:"nodes,omitempty" bson:"nodes,omitempty"`
+	Title         string          `json:"title" bson:"title" jsonschema:"Section title"`
+	NodeID        string          `json:"node_id" bson:"node_id" jsonschema:"Node ID, unique within the document"`
+	LineNum       int             `json:"line_num" bson:"line_num" jsonschema:"Line number in the source markdown file"`
+	Summary       string          `json:"summary,omitempty" bson:"summary,omitempty" jsonschema:"AI summary of leaf node content"`
+	PrefixSummary string          `json:"prefix_summary,omitempty" bson:"prefix_summary,omitempty" jsonschema:"AI summary of parent node content"`
+	Text          string          `json:"text,omitempty" bson:"text,omitempty" jsonschema:"Full text (omitted from structure responses)"`
+	Nodes         []PageIndexNode `json:"nodes,omitempty" bson:"nodes,omitempty" jsonschema:"Child nodes"`
+	ContentHash   string          `json:"-" bson:"contentHash,omitempty"` // of Text; set by the ingest command
 }
 
 func (m PageIndexDocModel) Id() string             { return m.DocID }
@@ -0,0 +1,33 @@
+package db
+
+import (
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// RemedyRelationModel is a link from one remedy to another named in its
+// relationship sections, e.g. "Complementary: Sulph." in ACONITUM. Built from
+// pageindex_docs by relations.Graph; one edge per mention, so each carries its
+// citation.
+type RemedyRelationModel struct {
+	ID       string `json:"id" bson:"_id"`            // from|relation|name|nodeId
+	From     string `json:"from" bson:"from"`         // document whose text names the remedy
+	To       string `json:"to,omitempty" bson:"to"`   // document of the named remedy; empty when none matched
+	Name     string `json:"name" bson:"name"`         // as written, e.g. "Calc. carb"
+	Relation string `json:"relation" bson:"relation"` // complementary, inimical, antidote, follows_well or compare
+	NodeID   string `json:"nodeId" bson:"nodeId"`
+	Title    string `json:"title" bson:"title"`
+	LineNum  int    `json:"lineNum" bson:"lineNum"`
+	Excerpt  string `json:"excerpt" bson:"excerpt"` // the labelled list the name was found in
+}
+
+func (m RemedyRelationModel) Id() string             { return m.ID }
+func (m RemedyRelationModel) CollectionName() string { return "remedy_relationships" }
+
+// IndexModels serve looking up a remedy's edges in either direction.
+func (m RemedyRelationModel) IndexModels() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{Keys: bson.D{{Key: "from", Value: 1}, {Key: "relation", Value: 1}}},
+		{Keys: bson.D{{Key: "to", Value: 1}}},
+	}
+}
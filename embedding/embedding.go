@@ -0,0 +1,137 @@
+// Package embedding runs the embedding models registered in config.ini and
+// keeps the collection and vector index of each. Search embeds queries with
+// the active model and reads only its vectors; ingestion embeds chunks with
+// the active model, or another to prepare a switch.
+package embedding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/SaiNageswarS/go-api-boot/embed"
+	"github.com/SaiNageswarS/go-api-boot/logger"
+	"github.com/SaiNageswarS/go-collection-boot/async"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/appconfig"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrUnknownModel is returned for a model ID not registered in config.ini.
+	ErrUnknownModel = errors.New("unknown embedding model")
+
+	// ErrIndexMismatch is returned for searching a vector index built for
+	// another model than the one the query was embedded with; the nearest
+	// vectors would be meaningless.
+	ErrIndexMismatch = errors.New("vector index was not built for the embedding model")
+)
+
+// Registry holds the embedding models registered in config.ini.
+type Registry struct {
+	models   map[string]appconfig.EmbeddingModel
+	ids      []string
+	activeID string
+}
+
+func ProvideRegistry(ccfg *appconfig.AppConfig) *Registry {
+	models := ccfg.EmbeddingModels
+	if len(models) == 0 {
+		models = []appconfig.EmbeddingModel{appconfig.DefaultEmbeddingModel}
+	}
+
+	r := &Registry{models: map[string]appconfig.EmbeddingModel{}}
+	for _, m := range models {
+		r.models[m.ID] = m
+		r.ids = append(r.ids, m.ID)
+	}
+	slices.Sort(r.ids)
+
+	r.activeID = ccfg.EmbeddingModel
+	if r.activeID == "" {
+		if len(r.ids) > 1 {
+			logger.Fatal("embedding_model must name one of the registered embedding models", zap.Strings("models", r.ids))
+		}
+		r.activeID = r.ids[0]
+	}
+	if _, ok := r.models[r.activeID]; !ok {
+		logger.Fatal("embedding_model is not registered", zap.String("model", r.activeID), zap.Strings("models", r.ids))
+	}
+	return r
+}
+
+// Get returns the model with the given ID.
+func (r *Registry) Get(id string) (appconfig.EmbeddingModel, bool) {
+	m, ok := r.models[id]
+	return m, ok
+}
+
+// Active returns the model of embedding_model.
+func (r *Registry) Active() appconfig.EmbeddingModel {
+	return r.models[r.activeID]
+}
+
+// Models returns every registered model, by ID.
+func (r *Registry) Models() []appconfig.EmbeddingModel {
+	out := make([]appconfig.EmbeddingModel, 0, len(r.ids))
+	for _, id := range r.ids {
+		out = append(out, r.models[id])
+	}
+	return out
+}
+
+// Model is a registered model with the client that runs it.
+type Model struct {
+	appconfig.EmbeddingModel
+	embedder embed.Embedder
+
+	checked sync.Map // databases whose vector index was found to be this model's
+}
+
+// ProvideModel runs the active model.
+func ProvideModel(r *Registry) *Model {
+	m, err := NewModel(r.Active())
+	if err != nil {
+		logger.Fatal("Failed to create embedding client", zap.Error(err))
+	}
+	return m
+}
+
+// NewModel creates the client of m's provider: jina (JINA_AI_API_KEY), ollama
+// (a local Ollama server at OLLAMA_HOST) or hashing (in process, no network).
+func NewModel(m appconfig.EmbeddingModel) (*Model, error) {
+	var embedder embed.Embedder
+	switch m.Provider {
+	case "jina":
+		embedder = embed.ProvideJinaAIEmbeddingClient()
+	case "ollama":
+		embedder = embed.ProvideOllamaEmbeddingClient()
+	case "hashing":
+		embedder = newHashingEmbedder(m.Dimensions)
+	default:
+		return nil, fmt.Errorf("embedding model %s: unsupported provider %q", m.ID, m.Provider)
+	}
+	return &Model{EmbeddingModel: m, embedder: embedder}, nil
+}
+
+// Query embeds a search query.
+func (m *Model) Query(ctx context.Context, text string) ([]float32, error) {
+	return m.embed(ctx, text, m.QueryTask)
+}
+
+// Passage embeds the text of a chunk.
+func (m *Model) Passage(ctx context.Context, text string) ([]float32, error) {
+	return m.embed(ctx, text, m.PassageTask)
+}
+
+func (m *Model) embed(ctx context.Context, text, task string) ([]float32, error) {
+	emb, err := async.Await(m.embedder.GetEmbedding(ctx, text, embed.WithModel(m.Model), embed.WithTask(task)))
+	if err != nil {
+		return nil, err
+	}
+	if len(emb) != m.Dimensions {
+		return nil, fmt.Errorf("embedding model %s returned %d dimensions, registered with %d", m.ID, len(emb), m.Dimensions)
+	}
+	return emb, nil
+}
@@ -0,0 +1,66 @@
+package embedding
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/SaiNageswarS/go-api-boot/embed"
+	"github.com/SaiNageswarS/go-collection-boot/async"
+)
+
+// hashingEmbedder embeds text without a model or network: the words of the
+// text and its pairs of adjacent words are hashed into a vector of fixed
+// dimensions, weighted by 1+log of their frequency and normalized to unit
+// length. Texts sharing words are near each other, which is keyword rather
+// than semantic similarity, but lets hybrid search run offline. It ignores
+// the model and task options.
+type hashingEmbedder struct {
+	dimensions int
+}
+
+func newHashingEmbedder(dimensions int) embed.Embedder {
+	return &hashingEmbedder{dimensions: dimensions}
+}
+
+func (e *hashingEmbedder) GetEmbedding(ctx context.Context, text string, opts ...embed.EmbedOption) <-chan async.Result[[]float32] {
+	return async.Go(func() ([]float32, error) {
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+
+		counts := map[string]int{}
+		for i, w := range words {
+			counts[w]++
+			if i > 0 {
+				counts[words[i-1]+" "+w]++
+			}
+		}
+
+		vec := make([]float32, e.dimensions)
+		for feature, n := range counts {
+			h := fnv.New64a()
+			h.Write([]byte(feature))
+			sum := h.Sum64()
+			weight := float32(1 + math.Log(float64(n)))
+			if sum>>63 == 1 { // the sign bit spreads collisions around zero
+				weight = -weight
+			}
+			vec[sum%uint64(e.dimensions)] += weight
+		}
+
+		var norm float64
+		for _, v := range vec {
+			norm += float64(v) * float64(v)
+		}
+		if norm > 0 {
+			scale := float32(1 / math.Sqrt(norm))
+			for i := range vec {
+				vec[i] *= scale
+			}
+		}
+		return vec, nil
+	})
+}
@@ -0,0 +1,150 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/SaiNageswarS/go-api-boot/odm"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/appconfig"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Vectors returns the collection of m's vectors in database.
+func Vectors(database *mongo.Database, m appconfig.EmbeddingModel) *mongo.Collection {
+	return database.Collection(m.Collection)
+}
+
+// indexSpec is the vector index of m's collection.
+func indexSpec(m appconfig.EmbeddingModel) odm.VectorIndexSpec {
+	return odm.VectorIndexSpec{
+		Name:          m.Index,
+		Type:          "vector",
+		Path:          db.VectorPath,
+		NumDimensions: m.Dimensions,
+		Similarity:    "cosine",
+		Quantization:  "scalar",
+	}
+}
+
+// EnsureIndex creates m's collection in database and its vector index, unless
+// they exist. An existing index of other dimensions is ErrIndexMismatch.
+func EnsureIndex(ctx context.Context, database *mongo.Database, m appconfig.EmbeddingModel) error {
+	if err := database.CreateCollection(ctx, m.Collection); err != nil {
+		var cmdErr mongo.CommandError
+		if !errors.As(err, &cmdErr) || cmdErr.Code != 48 { // 48 = NamespaceExists
+			return err
+		}
+	}
+
+	dims, found, err := indexDimensions(ctx, Vectors(database, m), m.Index)
+	switch {
+	case err != nil:
+		return err
+	case !found:
+		_, err = Vectors(database, m).SearchIndexes().CreateOne(ctx, indexSpec(m).Model())
+		return err
+	case dims != m.Dimensions:
+		return fmt.Errorf("%s.%s has %d dimensions, %s %d: %w", m.Collection, m.Index, dims, m.ID, m.Dimensions, ErrIndexMismatch)
+	}
+	return nil
+}
+
+// CheckIndex returns ErrIndexMismatch unless the vector index of m's
+// collection in database has m's dimensions and its vectors are m's. Vectors
+// stored before models were registered carry no model and are taken to be
+// the model's whose collection they are in.
+func CheckIndex(ctx context.Context, database *mongo.Database, m appconfig.EmbeddingModel) error {
+	coll := Vectors(database, m)
+	dims, found, err := indexDimensions(ctx, coll, m.Index)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%s has no vector index %s: %w", m.Collection, m.Index, ErrIndexMismatch)
+	}
+	if dims != m.Dimensions {
+		return fmt.Errorf("%s.%s has %d dimensions, %s %d: %w", m.Collection, m.Index, dims, m.ID, m.Dimensions, ErrIndexMismatch)
+	}
+
+	var other struct {
+		Model string `bson:"model"`
+	}
+	err = coll.FindOne(ctx, bson.M{"model": bson.M{"$nin": bson.A{m.ID, "", nil}}}, options.FindOne().SetProjection(bson.M{"model": 1})).Decode(&other)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return nil
+	case err != nil:
+		return err
+	}
+	return fmt.Errorf("%s holds vectors of %s, not %s: %w", m.Collection, other.Model, m.ID, ErrIndexMismatch)
+}
+
+// indexDimensions returns the dimensions of the vector index name of coll.
+func indexDimensions(ctx context.Context, coll *mongo.Collection, name string) (int, bool, error) {
+	cur, err := coll.SearchIndexes().List(ctx, options.SearchIndexes().SetName(name))
+	if err != nil {
+		return 0, false, err
+	}
+	var indexes []struct {
+		LatestDefinition struct {
+			Fields []struct {
+				Type          string `bson:"type"`
+				NumDimensions int    `bson:"numDimensions"`
+			} `bson:"fields"`
+		} `bson:"latestDefinition"`
+	}
+	if err := cur.All(ctx, &indexes); err != nil {
+		return 0, false, err
+	}
+	if len(indexes) == 0 {
+		return 0, false, nil
+	}
+	for _, f := range indexes[0].LatestDefinition.Fields {
+		if f.Type == "vector" {
+			return f.NumDimensions, true, nil
+		}
+	}
+	return 0, true, nil
+}
+
+// Search returns the k vectors of database nearest to vector, a query
+// embedded with m, without their embeddings. It refuses with ErrIndexMismatch
+// to search an index built for another model.
+func (m *Model) Search(ctx context.Context, database *mongo.Database, vector []float32, k, numCandidates int) ([]odm.SearchHit[db.ChunkAnnModel], error) {
+	if len(vector) != m.Dimensions {
+		return nil, fmt.Errorf("query has %d dimensions, %s %d: %w", len(vector), m.ID, m.Dimensions, ErrIndexMismatch)
+	}
+	if _, ok := m.checked.Load(database.Name()); !ok {
+		if err := CheckIndex(ctx, database, m.EmbeddingModel); err != nil {
+			return nil, err
+		}
+		m.checked.Store(database.Name(), true)
+	}
+
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$vectorSearch", Value: bson.D{
+			{Key: "index", Value: m.Index},
+			{Key: "path", Value: db.VectorPath},
+			{Key: "queryVector", Value: bson.NewVector(vector).Binary()},
+			{Key: "numCandidates", Value: numCandidates},
+			{Key: "limit", Value: k},
+		}}},
+		bson.D{{Key: "$project", Value: bson.D{
+			{Key: "score", Value: bson.D{{Key: "$meta", Value: "vectorSearchScore"}}},
+			{Key: "doc", Value: bson.D{{Key: "_id", Value: "$_id"}, {Key: "model", Value: "$model"}, {Key: "contentHash", Value: "$contentHash"}}},
+		}}},
+	}
+	cur, err := Vectors(database, m.EmbeddingModel).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var hits []odm.SearchHit[db.ChunkAnnModel]
+	if err := cur.All(ctx, &hits); err != nil {
+		return nil, err
+	}
+	return hits, nil
+}
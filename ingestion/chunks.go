@@ -0,0 +1,212 @@
+package ingestion
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/relations"
+)
+
+// Window sizes. A window ends at whichever limit it reaches first; a single
+// longer sentence is a window of its own.
+const (
+	windowSentences = 6
+	windowChars     = 1200
+
+	sectionPathSeparator = " > "
+)
+
+var (
+	// sentenceBreak ends a sentence at terminal punctuation followed by a
+	// capital, or at a line break; materia medica lists run one symptom a line.
+	sentenceBreak = regexp.MustCompile(`([.!?])\s+([A-Z"“(])|\n+`)
+
+	// abbreviated matches remedy abbreviations such as Bell., Calc. carb. or
+	// Nat-m.
+	abbreviated = regexp.MustCompile(`\b[A-Z][a-z]{2,}(?:[.-]\s?[a-z]+)*\.`)
+)
+
+// termAbbreviations are the clinical abbreviations of the materia medica.
+var termAbbreviations = map[string]string{
+	"agg.":   "aggravation",
+	"aggr.":  "aggravation",
+	"amel.":  "amelioration",
+	"sens.":  "sensation",
+	"sympt.": "symptom",
+	"esp.":   "especially",
+}
+
+// SourceURI is the source of the chunks of an article, as listed by
+// /metadata/sources and accepted by the search's sources filter.
+func SourceURI(a Article) string {
+	return "file://" + filepath.ToSlash(a.Path)
+}
+
+// SourcePrefix begins the source URI of every article in dir.
+func SourcePrefix(dir string) string {
+	return "file://" + filepath.ToSlash(filepath.Clean(dir)) + "/"
+}
+
+// Chunk splits each section of doc into windows of consecutive sentences. A
+// section is a node's own text, without its heading or sub-sections. IDs are
+// derived from the document, the section path and, for a path repeated by
+// sibling headings of the same title, its occurrence, so chunking the same
+// article again gives the same IDs. Each chunk names the node of its section and the
+// node's line range, for get_page_content. Abbreviated remedy names are
+// expanded through r.
+func Chunk(doc *db.PageIndexDocModel, sourceURI string, r *relations.Resolver) []db.ChunkModel {
+	var chunks []db.ChunkModel
+	sectionIndex := 0
+	occurrences := map[string]int{}
+
+	var walk func(nodes []db.PageIndexNode, path []string)
+	walk = func(nodes []db.PageIndexNode, path []string) {
+		for _, n := range nodes {
+			p := append(path[:len(path):len(path)], n.Title)
+			sectionPath := strings.Join(p, sectionPathSeparator)
+			occurrence := occurrences[sectionPath]
+			occurrences[sectionPath]++
+
+			sentences := splitSentences(sectionBody(n.Text))
+			if len(sentences) > 0 {
+				chunks = append(chunks, sectionChunks(doc, n, p, occurrence, sectionIndex, sentences, sourceURI, r)...)
+				sectionIndex++
+			}
+			walk(n.Nodes, p)
+		}
+	}
+	walk(doc.Structure, nil)
+	return chunks
+}
+
+func sectionChunks(doc *db.PageIndexDocModel, n db.PageIndexNode, path []string, occurrence, index int, sentences []string, sourceURI string, r *relations.Resolver) []db.ChunkModel {
+	sectionPath := strings.Join(path, sectionPathSeparator)
+	sectionID := sectionIDOf(doc.DocID, sectionPath, occurrence)
+	sectionHash := n.ContentHash
+	if sectionHash == "" {
+		sectionHash = contentHash(n.Text)
+	}
+
+	tags := []string{doc.DocID}
+	for _, t := range path {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" && !strings.EqualFold(t, doc.DocID) {
+			tags = append(tags, t)
+		}
+	}
+
+	var chunks []db.ChunkModel
+	for _, window := range windows(sentences) {
+		chunks = append(chunks, db.ChunkModel{
+			ChunkID:      fmt.Sprintf("%s-%03d", sectionID, len(chunks)),
+			Title:        doc.DocName,
+			SectionPath:  sectionPath,
+			SectionIndex: index,
+			SourceURI:    sourceURI,
+			Tags:         tags,
+			Abbrevations: abbreviations(window, r),
+			Sentences:    window,
+			SectionID:    sectionID,
+			WindowIndex:  len(chunks),
+			SectionHash:  sectionHash,
+			DocID:        doc.DocID,
+			NodeID:       n.NodeID,
+			LineStart:    n.LineNum,
+			LineEnd:      n.LineNum + strings.Count(n.Text, "\n"),
+		})
+	}
+	for i := range chunks {
+		chunks[i].ContentHash = contentHash(EmbeddingText(chunks[i]))
+		if i > 0 {
+			chunks[i].PrevChunkID = chunks[i-1].ChunkID
+		}
+		if i+1 < len(chunks) {
+			chunks[i].NextChunkID = chunks[i+1].ChunkID
+		}
+	}
+	return chunks
+}
+
+// sectionIDOf identifies the occurrence-th section (from 0) with the path in
+// the document. The first keeps the ID it had before repeated paths were told
+// apart, so existing chunks are not written and embedded again.
+func sectionIDOf(docID, sectionPath string, occurrence int) string {
+	key := docID + "\x00" + sectionPath
+	if occurrence > 0 {
+		key += fmt.Sprintf("\x00%d", occurrence)
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// sectionBody drops the heading line ParseMarkdown keeps at the top of a
+// node's text.
+func sectionBody(text string) string {
+	if strings.HasPrefix(text, "#") {
+		_, body, _ := strings.Cut(text, "\n")
+		return body
+	}
+	return text
+}
+
+func splitSentences(text string) []string {
+	text = sentenceBreak.ReplaceAllString(text, "$1\x00$2")
+	var out []string
+	for _, s := range strings.Split(text, "\x00") {
+		if s = strings.Join(strings.Fields(s), " "); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func windows(sentences []string) [][]string {
+	var out [][]string
+	var cur []string
+	size := 0
+	for _, s := range sentences {
+		if len(cur) > 0 && (len(cur) == windowSentences || size+len(s) > windowChars) {
+			out = append(out, cur)
+			cur, size = nil, 0
+		}
+		cur = append(cur, s)
+		size += len(s)
+	}
+	if len(cur) > 0 {
+		out = append(out, cur)
+	}
+	return out
+}
+
+// abbreviations returns the expansions of the abbreviations in sentences:
+// clinical terms, and remedy names r resolves to a document. Keys are the
+// abbreviations without their dots, which field names should not contain.
+func abbreviations(sentences []string, r *relations.Resolver) map[string]string {
+	found := map[string]string{}
+	for _, s := range sentences {
+		for _, word := range strings.Fields(strings.ToLower(s)) {
+			if full, ok := termAbbreviations[strings.TrimRight(word, ",;:")]; ok {
+				found[strings.ReplaceAll(strings.TrimRight(word, ",;:"), ".", "")] = full
+			}
+		}
+		for _, abbr := range abbreviated.FindAllString(s, -1) {
+			if id := r.Resolve(abbr); id != "" {
+				found[strings.ReplaceAll(abbr, ".", "")] = strings.ReplaceAll(id, "_", " ")
+			}
+		}
+	}
+	if len(found) == 0 {
+		return nil
+	}
+	return found
+}
+
+// EmbeddingText is what is embedded for a chunk: its section path, for
+// context, then its sentences.
+func EmbeddingText(c db.ChunkModel) string {
+	return c.SectionPath + "\n" + strings.Join(c.Sentences, " ")
+}
@@ -0,0 +1,125 @@
+package ingestion
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/relations"
+)
+
+func TestChunkRepeatedHeadings(t *testing.T) {
+	md := "# ACONITUM\n\n## Dose\nSixth potency.\n\n## Mind\nGreat fear.\n\n## Dose\nTincture for fever.\n"
+	chunks := Chunk(ParseMarkdown("ACONITUM", []byte(md)), "file://articles/ACONITUM.md", relations.NewResolver(nil))
+	if len(chunks) != 3 {
+		t.Fatalf("%d chunks, want 3", len(chunks))
+	}
+
+	first, second := chunks[0], chunks[2]
+	if first.SectionPath != second.SectionPath {
+		t.Fatalf("section paths %q and %q, want the same", first.SectionPath, second.SectionPath)
+	}
+	if first.ChunkID == second.ChunkID || first.SectionID == second.SectionID {
+		t.Errorf("both Dose sections are %s", first.ChunkID)
+	}
+	if first.NodeID == second.NodeID || first.PrevChunkID != "" || second.PrevChunkID != "" {
+		t.Errorf("sections linked across: %+v, %+v", first, second)
+	}
+
+	// The first occurrence keeps the ID it had before repeats were told apart.
+	if want := sectionIDOf("ACONITUM", "ACONITUM > Dose", 0); first.SectionID != want {
+		t.Errorf("first Dose section = %s, want %s", first.SectionID, want)
+	}
+
+	again := Chunk(ParseMarkdown("ACONITUM", []byte(md)), "file://articles/ACONITUM.md", relations.NewResolver(nil))
+	for i := range chunks {
+		if again[i].ChunkID != chunks[i].ChunkID {
+			t.Errorf("chunk %d is %s on the second run, was %s", i, again[i].ChunkID, chunks[i].ChunkID)
+		}
+	}
+}
+
+func TestSplitSentences(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Great fear. Restless.", []string{"Great fear.", "Restless."}},
+		{"Worse at night? Better in open air!", []string{"Worse at night?", "Better in open air!"}},
+		{"Burning pains\nThirst for cold water", []string{"Burning pains", "Thirst for cold water"}},
+		{"Compare Calc. carb. and Bell. here.", []string{"Compare Calc. carb. and Bell. here."}}, // lower case after the dot
+		{"Fear. \"As if he would die.\"", []string{"Fear.", "\"As if he would die.\""}},
+		{"Pains agg. by motion. (See also Bry.)", []string{"Pains agg. by motion.", "(See also Bry.)"}},
+		{"  spaced   out\n\n\nlines  ", []string{"spaced out", "lines"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := splitSentences(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("splitSentences(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestWindows(t *testing.T) {
+	sentences := func(n, size int) []string {
+		out := make([]string, n)
+		for i := range out {
+			out[i] = strings.Repeat("x", size)
+		}
+		return out
+	}
+	lengths := func(ws [][]string) []int {
+		var out []int
+		for _, w := range ws {
+			out = append(out, len(w))
+		}
+		return out
+	}
+
+	tests := []struct {
+		name      string
+		sentences []string
+		want      []int // sentences per window
+	}{
+		{"empty", nil, nil},
+		{"one", sentences(1, 10), []int{1}},
+		{"sentence limit", sentences(13, 10), []int{6, 6, 1}},
+		{"character limit", sentences(5, 500), []int{2, 2, 1}},
+		{"at the character limit", sentences(3, 400), []int{3}},
+		{"long sentence alone", append(sentences(1, 10), strings.Repeat("y", 2000)), []int{1, 1}},
+	}
+	for _, tt := range tests {
+		if got := lengths(windows(tt.sentences)); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: windows = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAbbreviations(t *testing.T) {
+	r := relations.NewResolver([]relations.Remedy{
+		{ID: "BELLADONNA", Name: "Belladonna"},
+		{ID: "CALCAREA_CARBONICA", Name: "Calcarea Carbonica"},
+		{ID: "NATRUM_MURIATICUM", Name: "Natrum Muriaticum"},
+	})
+	got := abbreviations([]string{
+		"Headache agg. from light, amel. lying; sens. of a band.",
+		"Follows Bell. well; compare Calc. carb. and Nat-m.",
+		"Worse in Summer.", // a capitalised word naming no remedy
+	}, r)
+	want := map[string]string{
+		"agg":       "aggravation",
+		"amel":      "amelioration",
+		"sens":      "sensation",
+		"Bell":      "BELLADONNA",
+		"Calc carb": "CALCAREA CARBONICA",
+		"Nat-m":     "NATRUM MURIATICUM",
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("abbreviations =\n%v\nwant\n%v", got, want)
+	}
+
+	if got := abbreviations([]string{"Great fear of death."}, r); got != nil {
+		t.Errorf("abbreviations without any = %v, want nil", got)
+	}
+}
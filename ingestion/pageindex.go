@@ -0,0 +1,300 @@
+// Package ingestion builds the knowledge base from the markdown articles in
+// articles/, for the ingest command. It is the Go counterpart of
+// build_pageindex.py: the trees it builds have the same shape, but no LLM
+// summaries or descriptions.
+package ingestion
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Outcomes of upserting a document.
+const (
+	Added     = "added"
+	Updated   = "updated"
+	Unchanged = "unchanged"
+)
+
+// Counts tally ingested items by outcome.
+type Counts struct {
+	Added, Updated, Unchanged, Removed int
+}
+
+// Count adds one item with the given outcome.
+func (c *Counts) Count(outcome string) {
+	switch outcome {
+	case Added:
+		c.Added++
+	case Updated:
+		c.Updated++
+	case Unchanged:
+		c.Unchanged++
+	}
+}
+
+func (c Counts) String() string {
+	return fmt.Sprintf("%d added, %d updated, %d unchanged, %d removed", c.Added, c.Updated, c.Unchanged, c.Removed)
+}
+
+var (
+	heading = regexp.MustCompile(`^(#{1,6})\s+(.+?)\s*$`)
+	fence   = regexp.MustCompile("^\\s*(```|~~~)")
+)
+
+// Article is a markdown file to ingest; its file name without .md is the
+// document ID.
+type Article struct {
+	DocID string
+	Path  string
+}
+
+// Articles returns the .md files in dir, sorted, or only single (a plain file
+// name such as ACONITUM.md) if given.
+func Articles(dir, single string) ([]Article, error) {
+	var paths []string
+	if single != "" {
+		if strings.ContainsAny(single, `/\`) || strings.Contains(single, "..") {
+			return nil, fmt.Errorf("%q: give a plain file name, e.g. ACONITUM.md", single)
+		}
+		path := filepath.Join(dir, single)
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+		paths = []string{path}
+	} else {
+		var err error
+		if paths, err = filepath.Glob(filepath.Join(dir, "*.md")); err != nil {
+			return nil, err
+		}
+		sort.Strings(paths)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no markdown files in %s", dir)
+	}
+
+	articles := make([]Article, 0, len(paths))
+	for _, p := range paths {
+		articles = append(articles, Article{DocID: strings.TrimSuffix(filepath.Base(p), filepath.Ext(p)), Path: p})
+	}
+	return articles, nil
+}
+
+// ParseMarkdown builds the PageIndex tree of an article as PageIndex's
+// md_to_tree does: each heading outside code blocks is a node, nested by level,
+// whose text runs from its heading to the next heading of any level. Node IDs
+// number the nodes in document order from 0000, so the same file always gives
+// the same IDs. Text before the first heading is not part of any node.
+func ParseMarkdown(docID string, content []byte) *db.PageIndexDocModel {
+	text := strings.ReplaceAll(string(content), "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+
+	type flat struct {
+		level int
+		node  db.PageIndexNode
+	}
+	var nodes []flat
+	inFence := false
+	for i, line := range lines {
+		if fence.MatchString(line) {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		if m := heading.FindStringSubmatch(line); m != nil {
+			nodes = append(nodes, flat{level: len(m[1]), node: db.PageIndexNode{
+				Title:   m[2],
+				NodeID:  fmt.Sprintf("%04d", len(nodes)),
+				LineNum: i + 1,
+			}})
+		}
+	}
+	for i := range nodes {
+		end := len(lines)
+		if i+1 < len(nodes) {
+			end = nodes[i+1].node.LineNum - 1
+		}
+		nodes[i].node.Text = strings.TrimSpace(strings.Join(lines[nodes[i].node.LineNum-1:end], "\n"))
+		nodes[i].node.ContentHash = contentHash(nodes[i].node.Text)
+	}
+
+	// Nest by level: a node's children are the following nodes of a deeper
+	// level, up to the next node of its level or higher.
+	var build func(from, level int) ([]db.PageIndexNode, int)
+	build = func(from, level int) ([]db.PageIndexNode, int) {
+		var out []db.PageIndexNode
+		i := from
+		for i < len(nodes) && nodes[i].level > level {
+			n := nodes[i].node
+			n.Nodes, i = build(i+1, nodes[i].level)
+			out = append(out, n)
+		}
+		return out, i
+	}
+	structure, _ := build(0, 0)
+	if structure == nil {
+		structure = []db.PageIndexNode{}
+	}
+
+	return &db.PageIndexDocModel{
+		DocID:       docID,
+		DocName:     docID,
+		LineCount:   len(lines),
+		Structure:   structure,
+		ContentHash: contentHash(string(content)),
+	}
+}
+
+// contentHash is the hex SHA-256 of s.
+func contentHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// Upsert writes doc to coll, replacing any stored copy, unless the stored copy
+// has the same content hash and doc brings no summaries, or is otherwise the
+// same. Summaries doc lacks, of nodes whose ID, title and text are unchanged,
+// and the description, are kept from the stored copy, so ingesting again does
+// not lose the ones build_pageindex.py generated.
+func Upsert(ctx context.Context, coll *mongo.Collection, doc *db.PageIndexDocModel) (string, error) {
+	var stored db.PageIndexDocModel
+	err := coll.FindOne(ctx, bson.M{"_id": doc.DocID}).Decode(&stored)
+	outcome := Updated
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		outcome = Added
+	case err != nil:
+		return "", err
+	case stored.ContentHash == doc.ContentHash && !hasSummaries(doc):
+		return Unchanged, nil
+	default:
+		keepSummaries(doc, &stored)
+		same, err := equal(doc, &stored)
+		if err != nil {
+			return "", err
+		}
+		if same {
+			return Unchanged, nil
+		}
+	}
+
+	if _, err := coll.ReplaceOne(ctx, bson.M{"_id": doc.DocID}, doc, options.Replace().SetUpsert(true)); err != nil {
+		return "", err
+	}
+	return outcome, nil
+}
+
+// PruneDocs removes the documents of coll whose IDs are not in keep, i.e. whose
+// article was deleted, and returns how many it removed.
+func PruneDocs(ctx context.Context, coll *mongo.Collection, keep []string) (int, error) {
+	res, err := coll.DeleteMany(ctx, bson.M{"_id": bson.M{"$nin": keep}})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
+
+// CarrySummaries copies the description of tree, as build_pageindex.py saved
+// it, and the summaries of its nodes to the nodes of doc with the same ID and
+// title, for Upsert to store with doc. Text is not compared, since trees built
+// without --with-text have none; the titles guard against a tree of an older
+// revision of the article.
+func CarrySummaries(doc, tree *db.PageIndexDocModel) {
+	if tree.DocDescription != "" {
+		doc.DocDescription = tree.DocDescription
+	}
+	old := nodesByID(tree.Structure)
+
+	var carry func([]db.PageIndexNode)
+	carry = func(ns []db.PageIndexNode) {
+		for i := range ns {
+			n := &ns[i]
+			if o, ok := old[n.NodeID]; ok && o.Title == n.Title {
+				n.Summary, n.PrefixSummary = o.Summary, o.PrefixSummary
+			}
+			carry(n.Nodes)
+		}
+	}
+	carry(doc.Structure)
+}
+
+// hasSummaries reports whether doc has a description or any node summary.
+func hasSummaries(doc *db.PageIndexDocModel) bool {
+	if doc.DocDescription != "" {
+		return true
+	}
+	var found func([]db.PageIndexNode) bool
+	found = func(ns []db.PageIndexNode) bool {
+		for _, n := range ns {
+			if n.Summary != "" || n.PrefixSummary != "" || found(n.Nodes) {
+				return true
+			}
+		}
+		return false
+	}
+	return found(doc.Structure)
+}
+
+func nodesByID(nodes []db.PageIndexNode) map[string]*db.PageIndexNode {
+	out := map[string]*db.PageIndexNode{}
+	var index func([]db.PageIndexNode)
+	index = func(ns []db.PageIndexNode) {
+		for i := range ns {
+			out[ns[i].NodeID] = &ns[i]
+			index(ns[i].Nodes)
+		}
+	}
+	index(nodes)
+	return out
+}
+
+// keepSummaries fills the description and node summaries doc lacks from the
+// stored copy.
+func keepSummaries(doc, stored *db.PageIndexDocModel) {
+	if doc.DocDescription == "" {
+		doc.DocDescription = stored.DocDescription
+	}
+
+	old := nodesByID(stored.Structure)
+
+	var carry func([]db.PageIndexNode)
+	carry = func(ns []db.PageIndexNode) {
+		for i := range ns {
+			n := &ns[i]
+			if o, ok := old[n.NodeID]; ok && o.Title == n.Title && o.Text == n.Text && n.Summary == "" && n.PrefixSummary == "" {
+				n.Summary, n.PrefixSummary = o.Summary, o.PrefixSummary
+			}
+			carry(n.Nodes)
+		}
+	}
+	carry(doc.Structure)
+}
+
+// equal compares documents by their BSON encoding, as they would be stored.
+func equal(a, b *db.PageIndexDocModel) (bool, error) {
+	ab, err := bson.Marshal(a)
+	if err != nil {
+		return false, err
+	}
+	bb, err := bson.Marshal(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(ab, bb), nil
+}
@@ -0,0 +1,228 @@
+package ingestion
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+)
+
+const aconitum = `Monkshood, from Hering.
+
+# ACONITUM NAPELLUS
+
+## Mind
+Great fear and anxiety.
+
+### Fear of death
+Predicts the day he will die.
+
+## Head
+` + "```" + `
+# not a heading inside a fence
+` + "```" + `
+Fullness, as if the brain would burst.
+
+# RELATIONSHIP
+Complementary: Coffea; Sulphur.
+`
+
+// outline flattens a tree to "<node ID> <level> <title> <line>" lines.
+func outline(nodes []db.PageIndexNode) []string {
+	var out []string
+	var walk func([]db.PageIndexNode, int)
+	walk = func(ns []db.PageIndexNode, level int) {
+		for _, n := range ns {
+			out = append(out, fmt.Sprintf("%s %s %s %d", n.NodeID, strings.Repeat(">", level), n.Title, n.LineNum))
+			walk(n.Nodes, level+1)
+		}
+	}
+	walk(nodes, 1)
+	return out
+}
+
+func TestParseMarkdown(t *testing.T) {
+	doc := ParseMarkdown("ACONITUM", []byte(aconitum))
+
+	got := outline(doc.Structure)
+	want := []string{
+		"0000 > ACONITUM NAPELLUS 3",
+		"0001 >> Mind 5",
+		"0002 >>> Fear of death 8",
+		"0003 >> Head 11",
+		"0004 > RELATIONSHIP 17",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("tree =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if doc.DocID != "ACONITUM" || doc.DocName != "ACONITUM" || doc.LineCount != 19 || doc.ContentHash == "" {
+		t.Errorf("document = %+v", doc)
+	}
+
+	tests := []struct {
+		node string
+		text string
+	}{
+		{"0000", "# ACONITUM NAPELLUS"}, // up to the next heading of any level
+		{"0001", "## Mind\nGreat fear and anxiety."},
+		{"0003", "## Head\n```\n# not a heading inside a fence\n```\nFullness, as if the brain would burst."},
+		{"0004", "# RELATIONSHIP\nComplementary: Coffea; Sulphur."},
+	}
+	for _, tt := range tests {
+		n := findNode(doc.Structure, tt.node)
+		if n == nil {
+			t.Errorf("node %s missing", tt.node)
+			continue
+		}
+		if n.Text != tt.text {
+			t.Errorf("node %s text = %q, want %q", tt.node, n.Text, tt.text)
+		}
+		if n.ContentHash != contentHash(tt.text) {
+			t.Errorf("node %s hash is not of its text", tt.node)
+		}
+	}
+}
+
+func TestParseMarkdownEdgeCases(t *testing.T) {
+	tests := []struct {
+		name string
+		md   string
+		want []string
+	}{
+		{"no headings", "Just prose.\n", nil},
+		{"skipped level", "# A\n### B\n## C\n", []string{"0000 > A 1", "0001 >> B 2", "0002 >> C 3"}},
+		{"deeper first", "## A\n# B\n", []string{"0000 > A 1", "0001 > B 2"}},
+		{"tilde fence", "~~~\n# code\n~~~\n# A\n", []string{"0000 > A 4"}},
+		{"unclosed fence", "# A\n```\n# B\n", []string{"0000 > A 1"}},
+		{"hash without space", "#hashtag\n# A\n", []string{"0000 > A 2"}},
+		{"crlf", "# A\r\n## B\r\ntext\r\n", []string{"0000 > A 1", "0001 >> B 2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := ParseMarkdown("DOC", []byte(tt.md))
+			if doc.Structure == nil {
+				t.Fatal("structure is nil, want empty")
+			}
+			if got := outline(doc.Structure); !slices.Equal(got, tt.want) {
+				t.Errorf("tree = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMarkdownStableIDs(t *testing.T) {
+	before := ParseMarkdown("ACONITUM", []byte(aconitum))
+	edited := ParseMarkdown("ACONITUM", []byte(strings.Replace(aconitum, "Great fear", "Great fear, restlessness", 1)))
+
+	if !slices.Equal(outline(before.Structure), outline(edited.Structure)) {
+		t.Errorf("editing a section's text changed the tree:\n%q\n%q", outline(before.Structure), outline(edited.Structure))
+	}
+	if before.ContentHash == edited.ContentHash {
+		t.Error("document hash unchanged by an edit")
+	}
+	if findNode(before.Structure, "0001").ContentHash == findNode(edited.Structure, "0001").ContentHash {
+		t.Error("hash of the edited section unchanged")
+	}
+	if findNode(before.Structure, "0003").ContentHash != findNode(edited.Structure, "0003").ContentHash {
+		t.Error("hash of an untouched section changed")
+	}
+}
+
+// summarised returns the tree of aconitum with a description and summaries.
+func summarised() *db.PageIndexDocModel {
+	doc := ParseMarkdown("ACONITUM", []byte(aconitum))
+	doc.DocDescription = "Monkshood: sudden, violent complaints."
+	for _, id := range []string{"0000", "0001", "0003"} {
+		findNode(doc.Structure, id).Summary = "summary of " + id
+	}
+	findNode(doc.Structure, "0000").PrefixSummary = "prefix of 0000"
+	return doc
+}
+
+func TestKeepSummaries(t *testing.T) {
+	stored := summarised()
+
+	tests := []struct {
+		name    string
+		md      string
+		want    map[string]string // node ID to summary
+		ownDesc string
+	}{
+		{"unchanged", aconitum, map[string]string{"0000": "summary of 0000", "0001": "summary of 0001", "0003": "summary of 0003"}, ""},
+		{"edited section", strings.Replace(aconitum, "Great fear", "Great fear, restlessness", 1),
+			map[string]string{"0000": "summary of 0000", "0001": "", "0003": "summary of 0003"}, ""},
+		{"renamed section", strings.Replace(aconitum, "## Head", "## Head and scalp", 1),
+			map[string]string{"0000": "summary of 0000", "0001": "summary of 0001", "0003": ""}, ""},
+		{"inserted section shifts IDs", strings.Replace(aconitum, "## Head", "## Eyes\nRed.\n\n## Head", 1),
+			map[string]string{"0000": "summary of 0000", "0001": "summary of 0001", "0003": "", "0004": ""}, ""},
+		{"own description kept", aconitum, map[string]string{"0001": "summary of 0001"}, "A new description."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := ParseMarkdown("ACONITUM", []byte(tt.md))
+			doc.DocDescription = tt.ownDesc
+			keepSummaries(doc, stored)
+
+			for id, want := range tt.want {
+				if got := findNode(doc.Structure, id).Summary; got != want {
+					t.Errorf("node %s summary = %q, want %q", id, got, want)
+				}
+			}
+			if want := cmp.Or(tt.ownDesc, stored.DocDescription); doc.DocDescription != want {
+				t.Errorf("description = %q, want %q", doc.DocDescription, want)
+			}
+		})
+	}
+
+	// Summaries the new copy brings are not overwritten by the stored ones.
+	doc := ParseMarkdown("ACONITUM", []byte(aconitum))
+	findNode(doc.Structure, "0001").Summary = "newer summary"
+	keepSummaries(doc, stored)
+	if got := findNode(doc.Structure, "0001").Summary; got != "newer summary" {
+		t.Errorf("summary brought by the new copy = %q, want it kept", got)
+	}
+	if got := findNode(doc.Structure, "0000").PrefixSummary; got != "prefix of 0000" {
+		t.Errorf("prefix summary = %q, want it carried over", got)
+	}
+}
+
+func TestCarrySummaries(t *testing.T) {
+	// A tree as build_pageindex.py saves it without --with-text.
+	tree := summarised()
+	var strip func([]db.PageIndexNode)
+	strip = func(ns []db.PageIndexNode) {
+		for i := range ns {
+			ns[i].Text, ns[i].ContentHash = "", ""
+			strip(ns[i].Nodes)
+		}
+	}
+	strip(tree.Structure)
+
+	doc := ParseMarkdown("ACONITUM", []byte(strings.Replace(aconitum, "## Head", "## Head and scalp", 1)))
+	if hasSummaries(doc) {
+		t.Fatal("a parsed document has summaries")
+	}
+	CarrySummaries(doc, tree)
+
+	if doc.DocDescription != tree.DocDescription {
+		t.Errorf("description = %q", doc.DocDescription)
+	}
+	for id, want := range map[string]string{"0000": "summary of 0000", "0001": "summary of 0001", "0002": "", "0003": ""} {
+		if got := findNode(doc.Structure, id).Summary; got != want {
+			t.Errorf("node %s summary = %q, want %q", id, got, want)
+		}
+	}
+	if findNode(doc.Structure, "0001").Text == "" {
+		t.Error("carrying summaries dropped the text")
+	}
+	if !hasSummaries(doc) {
+		t.Error("hasSummaries = false after carrying summaries")
+	}
+}
+
+func findNode(nodes []db.PageIndexNode, id string) *db.PageIndexNode {
+	return nodesByID(nodes)[id]
+}
@@ -0,0 +1,292 @@
+package ingestion
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sync"
+
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/embedding"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const writeBatch = 200
+
+// ChunkReport counts what ChunkWriter did to the sections and chunks of the
+// articles it synced.
+type ChunkReport struct {
+	Sections Counts
+	Chunks   Counts
+	Embedded int // vectors written
+}
+
+// Add adds the counts of o to r.
+func (r *ChunkReport) Add(o ChunkReport) {
+	r.Sections = r.Sections.plus(o.Sections)
+	r.Chunks = r.Chunks.plus(o.Chunks)
+	r.Embedded += o.Embedded
+}
+
+func (c Counts) plus(o Counts) Counts {
+	return Counts{c.Added + o.Added, c.Updated + o.Updated, c.Unchanged + o.Unchanged, c.Removed + o.Removed}
+}
+
+// ChunkWriter writes chunks to the chunks collection of one database, and
+// their passage embeddings to the vector collection of one embedding model.
+type ChunkWriter struct {
+	Model   *embedding.Model
+	Chunks  *mongo.Collection
+	Vectors *mongo.Collection   // of Model
+	Others  []*mongo.Collection // vectors of the other registered models, removed with their chunks
+	Workers int                 // concurrent embedding requests
+	Reembed bool                // embed every chunk, not only those whose text changed
+}
+
+// Sync makes the stored chunks of one source those given. Only chunks that
+// differ from their stored copy are written, only windows whose embedded text
+// changed are embedded again, and chunks no longer produced are removed with
+// their vectors. Vectors embedded before a failure are kept, so running again
+// resumes where it stopped.
+func (w *ChunkWriter) Sync(ctx context.Context, sourceURI string, chunks []db.ChunkModel) (ChunkReport, error) {
+	var report ChunkReport
+
+	cur, err := w.Chunks.Find(ctx, bson.M{"sourceUri": sourceURI})
+	if err != nil {
+		return report, err
+	}
+	var stored []db.ChunkModel
+	if err := cur.All(ctx, &stored); err != nil {
+		return report, err
+	}
+	old := make(map[string]db.ChunkModel, len(stored))
+	for _, c := range stored {
+		old[c.ChunkID] = c
+	}
+
+	// A section is unchanged only if all its windows are.
+	sections := map[string]string{}
+	var changed []db.ChunkModel
+	for _, c := range chunks {
+		o, ok := old[c.ChunkID]
+		outcome := Added
+		if ok {
+			outcome = Updated
+			if reflect.DeepEqual(c, o) {
+				outcome = Unchanged
+			}
+		}
+		report.Chunks.Count(outcome)
+		if outcome != Unchanged {
+			changed = append(changed, c)
+		}
+		delete(old, c.ChunkID)
+
+		switch prev, seen := sections[c.SectionID]; {
+		case !seen:
+			sections[c.SectionID] = outcome
+		case prev == Unchanged && outcome != Unchanged:
+			sections[c.SectionID] = Updated
+		}
+	}
+
+	var orphans []string
+	orphanSections := map[string]bool{}
+	for id, c := range old {
+		orphans = append(orphans, id)
+		report.Chunks.Removed++
+		if outcome, ok := sections[c.SectionID]; !ok {
+			orphanSections[c.SectionID] = true
+		} else if outcome == Unchanged {
+			sections[c.SectionID] = Updated // it lost a window
+		}
+	}
+	for _, outcome := range sections {
+		report.Sections.Count(outcome)
+	}
+	report.Sections.Removed = len(orphanSections)
+
+	for start := 0; start < len(changed); start += writeBatch {
+		batch := changed[start:min(start+writeBatch, len(changed))]
+		models := make([]mongo.WriteModel, 0, len(batch))
+		for _, c := range batch {
+			models = append(models, mongo.NewReplaceOneModel().SetFilter(bson.M{"_id": c.ChunkID}).SetReplacement(c).SetUpsert(true))
+		}
+		if _, err := w.Chunks.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+			return report, err
+		}
+	}
+	if err := w.remove(ctx, orphans); err != nil {
+		return report, err
+	}
+
+	for start := 0; start < len(chunks); start += writeBatch {
+		n, err := w.embedStale(ctx, chunks[start:min(start+writeBatch, len(chunks))], stored)
+		report.Embedded += n
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// Prune removes the chunks, and their vectors, of the sources under prefix
+// that are not in keep, i.e. of deleted articles, and returns how many chunks
+// it removed. Sources elsewhere, ingested by other means, are left alone.
+func (w *ChunkWriter) Prune(ctx context.Context, prefix string, keep []string) (int, error) {
+	filter := bson.M{"sourceUri": bson.M{"$regex": "^" + regexp.QuoteMeta(prefix), "$nin": keep}}
+	cur, err := w.Chunks.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+	var found []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cur.All(ctx, &found); err != nil {
+		return 0, err
+	}
+	ids := make([]string, 0, len(found))
+	for _, f := range found {
+		ids = append(ids, f.ID)
+	}
+	return len(ids), w.remove(ctx, ids)
+}
+
+// remove deletes chunks and their vectors of every model, vectors first so no
+// vector is left without its chunk if this fails half way.
+func (w *ChunkWriter) remove(ctx context.Context, ids []string) error {
+	for start := 0; start < len(ids); start += writeBatch {
+		batch := ids[start:min(start+writeBatch, len(ids))]
+		for _, vectors := range append([]*mongo.Collection{w.Vectors}, w.Others...) {
+			if _, err := vectors.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": batch}}); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Chunks.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": batch}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// embedStale embeds the chunks whose vector is missing, of other text or of
+// another model, and returns how many vectors it wrote. Vectors stored before
+// content hashes or models were kept are stamped with them instead, if they
+// are of the same text: their hash matches, or the stored chunk's text did.
+func (w *ChunkWriter) embedStale(ctx context.Context, chunks []db.ChunkModel, stored []db.ChunkModel) (int, error) {
+	found := map[string]storedVector{}
+	if !w.Reembed {
+		ids := make([]string, 0, len(chunks))
+		for _, c := range chunks {
+			ids = append(ids, c.ChunkID)
+		}
+		var err error
+		if found, err = w.storedVectors(ctx, ids); err != nil {
+			return 0, err
+		}
+	}
+	storedText := make(map[string]string, len(stored))
+	for _, c := range stored {
+		storedText[c.ChunkID] = contentHash(EmbeddingText(c))
+	}
+
+	var pending []db.ChunkModel
+	var stamps []mongo.WriteModel
+	for _, c := range chunks {
+		v, ok := found[c.ChunkID]
+		legacy := ok && v.Model == "" && (v.ContentHash == c.ContentHash || v.ContentHash == "" && storedText[c.ChunkID] == c.ContentHash)
+		switch {
+		case ok && v.Model == w.Model.ID && v.ContentHash == c.ContentHash:
+		case legacy:
+			stamps = append(stamps, mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": c.ChunkID}).
+				SetUpdate(bson.M{"$set": bson.M{"contentHash": c.ContentHash, "model": w.Model.ID}}))
+		default:
+			pending = append(pending, c)
+		}
+	}
+	if len(stamps) > 0 {
+		if _, err := w.Vectors.BulkWrite(ctx, stamps, options.BulkWrite().SetOrdered(false)); err != nil {
+			return 0, err
+		}
+	}
+
+	vectors, embedErr := w.embed(ctx, pending)
+	if len(vectors) > 0 {
+		if _, err := w.Vectors.BulkWrite(ctx, replaceVectors(vectors), options.BulkWrite().SetOrdered(false)); err != nil {
+			return 0, err
+		}
+	}
+	return len(vectors), embedErr
+}
+
+// storedVector is what embedStale needs of a stored vector.
+type storedVector struct {
+	ID          string `bson:"_id"`
+	ContentHash string `bson:"contentHash"`
+	Model       string `bson:"model"`
+}
+
+// storedVectors returns the content hash and model of the stored vector of
+// each of ids that has one.
+func (w *ChunkWriter) storedVectors(ctx context.Context, ids []string) (map[string]storedVector, error) {
+	cur, err := w.Vectors.Find(ctx, bson.M{"_id": bson.M{"$in": ids}}, options.Find().SetProjection(bson.M{"contentHash": 1, "model": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var found []storedVector
+	if err := cur.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	out := make(map[string]storedVector, len(found))
+	for _, f := range found {
+		out[f.ID] = f
+	}
+	return out, nil
+}
+
+// embed gets the passage embeddings of chunks from Model, Workers at a time. On failure
+// it returns the vectors it got along with the first error.
+func (w *ChunkWriter) embed(ctx context.Context, chunks []db.ChunkModel) ([]db.ChunkAnnModel, error) {
+	vectors := make([]db.ChunkAnnModel, len(chunks))
+	errs := make([]error, len(chunks))
+	sem := make(chan struct{}, max(w.Workers, 1))
+	var wg sync.WaitGroup
+	for i, c := range chunks {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			emb, err := w.Model.Passage(ctx, EmbeddingText(c))
+			if err != nil {
+				errs[i] = fmt.Errorf("chunk %s: %w", c.ChunkID, err)
+				return
+			}
+			vectors[i] = db.ChunkAnnModel{ChunkID: c.ChunkID, Embedding: bson.NewVector(emb), ContentHash: c.ContentHash, Model: w.Model.ID}
+		}()
+	}
+	wg.Wait()
+
+	out := vectors[:0]
+	var firstErr error
+	for i, v := range vectors {
+		if errs[i] != nil {
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+			continue
+		}
+		out = append(out, v)
+	}
+	return out, firstErr
+}
+
+func replaceVectors(vectors []db.ChunkAnnModel) []mongo.WriteModel {
+	models := make([]mongo.WriteModel, 0, len(vectors))
+	for _, v := range vectors {
+		models = append(models, mongo.NewReplaceOneModel().SetFilter(bson.M{"_id": v.ChunkID}).SetReplacement(v).SetUpsert(true))
+	}
+	return models
+}
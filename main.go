@@ -5,54 +5,32 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/SaiNageswarS/go-api-boot/config"
 	"github.com/SaiNageswarS/go-api-boot/dotenv"
-	"github.com/SaiNageswarS/go-api-boot/embed"
 	"github.com/SaiNageswarS/go-api-boot/logger"
 	"github.com/SaiNageswarS/go-api-boot/odm"
 	"github.com/SaiNageswarS/go-api-boot/server"
 	"github.com/SaiNageswarS/medicine-rag-custom-gpt/appconfig"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/audit"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/cases"
 	"github.com/SaiNageswarS/medicine-rag-custom-gpt/controller"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/corpus"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/embedding"
 	mcptools "github.com/SaiNageswarS/medicine-rag-custom-gpt/mcp"
 	"github.com/SaiNageswarS/medicine-rag-custom-gpt/middleware"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/relations"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/tenant"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"go.uber.org/zap"
 )
 
-const ASSISTANT_INSTRUCTIONS = `You are a homeopathy assistant to Qualified Homeopathic Physicians. You have access to a curated materia medica knowledge base. You MUST use the provided tools to look up remedy information before responding. Do NOT answer from memory or training data. Do not use web browsing.
+// defaultMCPSessionTimeout applies when mcp_session_timeout is not configured.
+const defaultMCPSessionTimeout = 30 * time.Minute
 
-## Workflow
-
-1. Call get_current_date to obtain today's date.
-2. Call list_documents to see all available medicines — do this on every new question about remedies, symptoms, or medicines.
-3. Call get_document_structure on relevant medicines to review their section tree and summaries.
-4. Call get_page_content to read full text of matching sections.
-5. Synthesize your answer strictly from the retrieved content. If the knowledge base does not contain relevant information, say so explicitly.
-
-You may call get_document_structure and get_page_content multiple times for different medicines or sections. Give small/rare remedies equal weight as polychrests. Deprioritize Carcinosin unless clear keynotes are present.
-
-## Clinical Reasoning
-
-- Hierarchy: Mentals > Generals > Particulars > Modalities.
-- Reasoning per Hahnemann, Vithoulkas, Ghegas.
-- Show step-by-step reasoning. Extract Ghegas practical tips when present. Note miasmatic stage.
-- General medical knowledge is acceptable for medical terms and case framing only.
-
-## Case-Taking
-
-- Use open neutral questions, Ghegas style (free anamnesis, contradiction flagging, essence hints).
-- If patient mentions overthinking/anxiety/stress: explore thought themes, fears, triggers with bilingual follow-up before suggesting remedies.
-- Use your tools in parallel while asking questions.
-
-## Output Format
-
-- Date every interaction: "Date: DD-MM-YYYY" (IST) — use get_current_date for this.
-- Output order: symptom summary → remedies + indications → most probable remedy ✅ → differentials 🧩 table → Ghegas notes 💬 → citations 📚.
-- Cite every claim: medicine name and section title (e.g. "ALUMINA — Mind").
-- When comparing remedies, use a table or side-by-side format.
-- End with a concise summary and differential considerations.
-- Suggest potency only if explicitly asked.`
+// auditCloseTimeout bounds writing the queued audit events on shutdown.
+const auditCloseTimeout = 30 * time.Second
 
 func main() {
 	dotenv.LoadEnv()
@@ -60,33 +38,100 @@ func main() {
 	// load config file
 	ccfgg := &appconfig.AppConfig{}
 	err := config.LoadConfig("config.ini", ccfgg)
+	if ccfgg.Tenants, err = appconfig.LoadTenants("config.ini"); err != nil {
+		logger.Fatal("Failed to load tenants", zap.Error(err))
+	}
+	if ccfgg.EmbeddingModels, err = appconfig.LoadEmbeddingModels("config.ini"); err != nil {
+		logger.Fatal("Failed to load embedding models", zap.Error(err))
+	}
+
+	if len(os.Args) > 1 {
+		runCommand(ccfgg, os.Args[1], os.Args[2:])
+	}
+
+	// The MCP middleware is a plain function, so the key store, OAuth verifier,
+	// tenants and audit log it needs are built here rather than by the container.
+	mongo := odm.ProvideMongoClient()
+	tenants := tenant.ProvideRegistry(ccfgg)
+	auditLog := audit.ProvideLog(ccfgg, mongo)
+	apiKeys := middleware.ProvideAPIKeyStore(mongo, ccfgg)
+	oauth, err := middleware.ProvideOAuthVerifier(ccfgg)
+	if err != nil {
+		logger.Fatal("Failed to configure OAuth", zap.Error(err))
+	}
+	limiter := middleware.ProvideRateLimiter(ccfgg, mongo)
+	apiKeyAuth := middleware.ProvideAPIKeyAuth(apiKeys, oauth, limiter, tenants, auditLog)
+
+	sessionTimeout := ccfgg.MCPSessionTimeout
+	if sessionTimeout <= 0 {
+		sessionTimeout = defaultMCPSessionTimeout
+	}
+
+	// Canceled on SIGINT or SIGTERM; stops the server and the MCP change
+	// stream watchers.
+	ctx := getCancellableContext()
 
 	boot, err := server.New().
 		GRPCPort(":50051").
 		HTTPPort(":8081").
 		Provide(ccfgg).
-		ProvideFunc(odm.ProvideMongoClient).
-		ProvideFunc(embed.ProvideJinaAIEmbeddingClient).
+		ProvideAs(ctx, (*context.Context)(nil)).
+		ProvideAs(mongo, (*odm.MongoClient)(nil)).
+		Provide(tenants).
+		Provide(auditLog).
+		Provide(apiKeys).
+		Provide(oauth).
+		Provide(limiter).
+		Provide(apiKeyAuth).
+		ProvideFunc(embedding.ProvideRegistry).
+		ProvideFunc(embedding.ProvideModel).
+		ProvideFunc(mcptools.ProvideInstructionsStore).
+		ProvideFunc(mcptools.ProvideSessionRegistry).
+		ProvideFunc(cases.ProvideStore).
+		ProvideFunc(corpus.ProvideRegistry).
+		ProvideFunc(mcptools.ProvidePageIndexStore).
+		ProvideFunc(mcptools.ProvidePageIndexService).
+		ProvideFunc(relations.ProvideGraph).
 		AddRestController(controller.ProvideQueryController).
 		AddRestController(controller.ProvidePrivacyController).
 		AddRestController(controller.ProvideMetadataController).
 		AddRestController(controller.ProvidePageIndexController).
+		AddRestController(controller.ProvideInstructionsController).
+		AddRestController(controller.ProvideOpenAPIController).
+		AddRestController(controller.ProvideAPIKeyController).
+		AddRestController(controller.ProvideSessionController).
+		AddRestController(controller.ProvideOAuthController).
+		AddRestController(controller.ProvideAuditController).
+		AddRestController(controller.ProvideCaseController).
+		AddRestController(controller.ProvideCorpusController).
 		WithMCP(&mcp.Implementation{
 			Name:    "medicine-rag-pageindex",
 			Version: "1.0.0",
 		}, &mcp.ServerOptions{
-			Instructions: ASSISTANT_INSTRUCTIONS,
+			SubscribeHandler:   mcptools.HandleResourceSubscribe,
+			UnsubscribeHandler: mcptools.HandleResourceUnsubscribe,
 		}).
-		WithMCPMiddleware(middleware.APIKeyAuthHandler).
+		WithMCPMiddleware(apiKeyAuth.MCPHandler).
+		MCPHTTPOptions(&mcp.StreamableHTTPOptions{SessionTimeout: sessionTimeout}).
 		AddMCPConfigurator(mcptools.ProvidePageIndexMcp).
+		AddMCPConfigurator(mcptools.ProvidePromptMcp).
+		AddMCPConfigurator(mcptools.ProvideInstructionsMcp).
+		AddMCPConfigurator(mcptools.ProvideSessionMcp).
+		AddMCPConfigurator(mcptools.ProvideCaseMcp).
 		Build()
 
 	if err != nil {
 		logger.Fatal("Dependency Injection Failed", zap.Error(err))
 	}
 
-	ctx := getCancellableContext()
 	boot.Serve(ctx)
+
+	// Write the audit events of the last requests before exiting.
+	closeCtx, cancel := context.WithTimeout(context.Background(), auditCloseTimeout)
+	defer cancel()
+	if err := auditLog.Close(closeCtx); err != nil {
+		logger.Error("Failed to write queued audit events", zap.Error(err))
+	}
 }
 
 func getCancellableContext() context.Context {
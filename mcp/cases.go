@@ -0,0 +1,217 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/audit"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/cases"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/middleware"
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// CaseMcp exposes the caller's saved cases as MCP tools, so an assistant can
+// continue a case in a later conversation. The tools need the cases scope on
+// top of the documents:read scope /mcp requires.
+// It implements server.MCPConfigurator.
+type CaseMcp struct {
+	cases *cases.Store
+	svc   *PageIndexService
+}
+
+func ProvideCaseMcp(store *cases.Store, svc *PageIndexService) *CaseMcp {
+	return &CaseMcp{cases: store, svc: svc}
+}
+
+type saveCaseInput struct {
+	CaseID       string            `json:"case_id,omitempty" jsonschema:"The case to add to; omit to start a new case"`
+	Title        string            `json:"title,omitempty" jsonschema:"Short description of the case, e.g. Recurrent tonsillitis, child of 6. Required for a new case"`
+	PatientRef   string            `json:"patient_ref,omitempty" jsonschema:"The practice's own patient reference, e.g. a file number. Avoid names"`
+	Symptoms     []db.CaseSymptom  `json:"symptoms,omitempty" jsonschema:"Symptoms to add"`
+	Citations    []db.CaseCitation `json:"citations,omitempty" jsonschema:"Remedy passages consulted, to add"`
+	ChosenRemedy *db.ChosenRemedy  `json:"chosen_remedy,omitempty" jsonschema:"The remedy prescribed; replaces any earlier choice"`
+	FollowUps    []db.CaseFollowUp `json:"follow_ups,omitempty" jsonschema:"Follow-up entries to add: amelioration, aggravation, new symptoms or no change since the last prescription"`
+}
+
+type getCaseInput struct {
+	CaseID string `json:"case_id" jsonschema:"The case ID, as returned by save_case or list_cases"`
+}
+
+type listCasesInput struct {
+	Limit int `json:"limit,omitempty" jsonschema:"At most this many cases (default 50, max 200)"`
+}
+
+type listCasesOutput struct {
+	Cases []cases.Summary `json:"cases"`
+}
+
+// CaseTimeline is a case's prescriptions and follow-ups in date order, with the
+// sections of the prescribed remedy that guide a second prescription.
+type CaseTimeline struct {
+	CaseID         string                `json:"case_id"`
+	Title          string                `json:"title"`
+	PatientRef     string                `json:"patient_ref,omitempty"`
+	Remedy         *db.ChosenRemedy      `json:"remedy,omitempty" jsonschema:"The remedy currently prescribed"`
+	Events         []cases.TimelineEvent `json:"events" jsonschema:"Prescriptions and follow-ups, oldest first"`
+	RemedySections []NodeContent         `json:"remedy_sections" jsonschema:"Relationship, Compare, Antidote and similar sections of the prescribed remedy"`
+}
+
+// BuildCaseTimeline assembles the timeline of c. The remedy sections are
+// empty when no remedy is prescribed or its document is not in the knowledge
+// base.
+func BuildCaseTimeline(ctx context.Context, svc *PageIndexService, c *db.CaseModel) (*CaseTimeline, error) {
+	t := &CaseTimeline{
+		CaseID:         c.ID,
+		Title:          c.Title,
+		PatientRef:     c.PatientRef,
+		Remedy:         c.ChosenRemedy,
+		Events:         cases.Timeline(c),
+		RemedySections: []NodeContent{},
+	}
+	if c.ChosenRemedy == nil {
+		return t, nil
+	}
+
+	audit.SetDoc(ctx, c.ChosenRemedy.DocID)
+	sections, err := svc.RelationshipSections(ctx, c.ChosenRemedy.DocID)
+	if errors.Is(err, ErrDocumentNotFound) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.RemedySections = sections
+	return t, nil
+}
+
+// ConfigureMCP registers the case tools.
+func (m *CaseMcp) ConfigureMCP(s *gomcp.Server) {
+	gomcp.AddTool(s, &gomcp.Tool{
+		Name:        "save_case",
+		Description: "Save a patient case: symptoms with their category, the remedy passages consulted, the chosen remedy and follow-up notes. Without case_id a new case is started; with case_id the symptoms, citations and follow-ups given are added to the case. Returns the case; pass its id to get_case in later conversations.",
+	}, m.handleSaveCase)
+
+	gomcp.AddTool(s, &gomcp.Tool{
+		Name:        "get_case",
+		Description: "Get a saved case with its symptoms, remedy citations, chosen remedy and follow-ups. Call this to continue a case from an earlier conversation.",
+		Annotations: &gomcp.ToolAnnotations{ReadOnlyHint: true},
+	}, m.handleGetCase)
+
+	gomcp.AddTool(s, &gomcp.Tool{
+		Name:        "list_cases",
+		Description: "List the saved cases, most recently updated first.",
+		Annotations: &gomcp.ToolAnnotations{ReadOnlyHint: true},
+	}, m.handleListCases)
+
+	gomcp.AddTool(s, &gomcp.Tool{
+		Name:        "get_case_timeline",
+		Description: "Get the prescriptions and follow-ups of a saved case in date order, each follow-up with the remedy in effect, plus the Relationship, Compare and Antidote sections of the prescribed remedy. Use this at a follow-up to judge the response and decide on a second prescription.",
+		Annotations: &gomcp.ToolAnnotations{ReadOnlyHint: true},
+	}, m.handleGetCaseTimeline)
+}
+
+// casesKey returns the key ID of a caller granted the cases scope.
+func casesKey(req *gomcp.CallToolRequest) (string, error) {
+	if extra := req.GetExtra(); extra != nil {
+		if p, ok := middleware.PrincipalFromTokenInfo(extra.TokenInfo); ok {
+			if !p.HasScope(middleware.ScopeCases) {
+				return "", errors.New("API key lacks the cases scope")
+			}
+			return p.KeyID, nil
+		}
+	}
+	return "", errors.New("unauthenticated")
+}
+
+func (m *CaseMcp) handleSaveCase(ctx context.Context, req *gomcp.CallToolRequest, input saveCaseInput) (*gomcp.CallToolResult, *db.CaseModel, error) {
+	keyID, err := casesKey(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if input.CaseID == "" {
+		created, err := m.cases.Create(ctx, keyID, db.CaseModel{
+			Title:        input.Title,
+			PatientRef:   input.PatientRef,
+			Symptoms:     input.Symptoms,
+			Citations:    input.Citations,
+			ChosenRemedy: input.ChosenRemedy,
+			FollowUps:    input.FollowUps,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		audit.SetArg(ctx, "case_id", created.ID)
+		return nil, created, nil
+	}
+
+	updated, err := m.cases.Update(ctx, keyID, input.CaseID, func(c *db.CaseModel) {
+		if input.Title != "" {
+			c.Title = input.Title
+		}
+		if input.PatientRef != "" {
+			c.PatientRef = input.PatientRef
+		}
+		if input.ChosenRemedy != nil {
+			c.ChosenRemedy = input.ChosenRemedy
+		}
+		c.Symptoms = append(c.Symptoms, input.Symptoms...)
+		c.Citations = append(c.Citations, input.Citations...)
+		c.FollowUps = append(c.FollowUps, input.FollowUps...)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return nil, updated, nil
+}
+
+func (m *CaseMcp) handleGetCase(ctx context.Context, req *gomcp.CallToolRequest, input getCaseInput) (*gomcp.CallToolResult, *db.CaseModel, error) {
+	keyID, err := casesKey(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	found, err := m.cases.Get(ctx, keyID, input.CaseID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nil, found, nil
+}
+
+func (m *CaseMcp) handleListCases(ctx context.Context, req *gomcp.CallToolRequest, input listCasesInput) (*gomcp.CallToolResult, listCasesOutput, error) {
+	keyID, err := casesKey(req)
+	if err != nil {
+		return nil, listCasesOutput{}, err
+	}
+
+	limit := input.Limit
+	if limit <= 0 {
+		limit = cases.DefaultListLimit
+	}
+	limit = min(limit, cases.MaxListLimit)
+	list, err := m.cases.List(ctx, keyID, int64(limit))
+	if err != nil {
+		return nil, listCasesOutput{}, err
+	}
+	audit.SetResults(ctx, len(list))
+	return nil, listCasesOutput{Cases: list}, nil
+}
+
+func (m *CaseMcp) handleGetCaseTimeline(ctx context.Context, req *gomcp.CallToolRequest, input getCaseInput) (*gomcp.CallToolResult, *CaseTimeline, error) {
+	keyID, err := casesKey(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	found, err := m.cases.Get(ctx, keyID, input.CaseID)
+	if err != nil {
+		return nil, nil, err
+	}
+	timeline, err := BuildCaseTimeline(ctx, m.svc, found)
+	if err != nil {
+		return nil, nil, err
+	}
+	audit.SetResults(ctx, len(timeline.Events))
+	return nil, timeline, nil
+}
@@ -0,0 +1,226 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/SaiNageswarS/go-api-boot/logger"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/appconfig"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/middleware"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/tenant"
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultInstructionsDir     = "instructions"
+	defaultInstructionsVersion = "v1"
+
+	// InstructionsVersionHeader selects an instructions version for one MCP
+	// session. It is read from the initialize request only.
+	InstructionsVersionHeader = "X-Instructions-Version"
+)
+
+// Channel is the client the instructions are rendered for. Both channels share
+// one template; only the names of the tools/actions differ.
+type Channel string
+
+const (
+	ChannelMCP       Channel = "mcp"
+	ChannelCustomGPT Channel = "custom-gpt"
+)
+
+type instructionTools struct {
+	CurrentDate          string // empty when the channel has no date tool
+	ListDocuments        string
+	GetDocumentStructure string
+	GetPageContent       string
+	RemedyRelationships  string // empty when documents are served from pageindex_dir
+	SaveCase             string
+	GetCase              string
+	GetCaseTimeline      string
+	RecordFollowUp       string
+}
+
+type instructionsData struct {
+	Channel Channel
+	Noun    string // "tool" or "action"
+	Tools   instructionTools
+}
+
+var channelData = map[Channel]instructionsData{
+	ChannelMCP: {
+		Channel: ChannelMCP,
+		Noun:    "tool",
+		Tools: instructionTools{
+			CurrentDate:          "get_current_date",
+			ListDocuments:        "list_documents",
+			GetDocumentStructure: "get_document_structure",
+			GetPageContent:       "get_page_content",
+			RemedyRelationships:  "get_remedy_relationships",
+			SaveCase:             "save_case",
+			GetCase:              "get_case",
+			GetCaseTimeline:      "get_case_timeline",
+			RecordFollowUp:       "save_case",
+		},
+	},
+	// Operation IDs from openapi-schema.json.
+	ChannelCustomGPT: {
+		Channel: ChannelCustomGPT,
+		Noun:    "action",
+		Tools: instructionTools{
+			ListDocuments:        "ListDocuments",
+			GetDocumentStructure: "GetDocumentStructure",
+			GetPageContent:       "GetDocumentContent",
+			RemedyRelationships:  "GetRemedyRelationships",
+			SaveCase:             "SaveCase",
+			GetCase:              "GetCase",
+			GetCaseTimeline:      "GetCaseTimeline",
+			RecordFollowUp:       "AddFollowUp",
+		},
+	},
+}
+
+var versionPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// InstructionsStore serves the assistant instructions from
+// <instructions_dir>/<version>.md, a text/template rendered per channel so the
+// MCP server and the Custom GPT share a single source. Files are read on every
+// call, so a new version can be dropped in and activated without a rebuild.
+type InstructionsStore struct {
+	dir    string
+	active string
+	files  bool // documents served from pageindex_dir, without relationships
+}
+
+func ProvideInstructionsStore(ccfg *appconfig.AppConfig) *InstructionsStore {
+	dir := ccfg.InstructionsDir
+	if dir == "" {
+		dir = defaultInstructionsDir
+	}
+	active := ccfg.InstructionsVersion
+	if active == "" {
+		active = defaultInstructionsVersion
+	}
+	return &InstructionsStore{dir: dir, active: active, files: ccfg.PageIndexDir != ""}
+}
+
+// Active returns the version served when none is requested.
+func (s *InstructionsStore) Active() string {
+	return s.active
+}
+
+// Versions lists the available versions, sorted by name.
+func (s *InstructionsStore) Versions() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("list instructions: %w", err)
+	}
+
+	versions := []string{}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".md")
+		if e.IsDir() || !ok || !versionPattern.MatchString(name) {
+			continue
+		}
+		versions = append(versions, name)
+	}
+	slices.Sort(versions)
+	return versions, nil
+}
+
+// Render returns the instructions of version for channel. An empty version
+// means the active one.
+func (s *InstructionsStore) Render(version string, channel Channel) (string, error) {
+	if version == "" {
+		version = s.active
+	}
+	if !versionPattern.MatchString(version) {
+		return "", fmt.Errorf("invalid instructions version %q", version)
+	}
+	data, ok := channelData[channel]
+	if !ok {
+		return "", fmt.Errorf("unknown channel %q", channel)
+	}
+	if s.files {
+		data.Tools.RemedyRelationships = ""
+	}
+
+	path := filepath.Join(s.dir, version+".md")
+	tmpl, err := template.New(filepath.Base(path)).Option("missingkey=error").ParseFiles(path)
+	if err != nil {
+		return "", fmt.Errorf("load instructions %s: %w", version, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("render instructions %s: %w", version, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// InstructionsMcp sets the instructions returned from initialize. Clients get
+// the version sent in X-Instructions-Version, else the one their API key names,
+// else their tenant's, else the active one, for the whole session.
+// It implements server.MCPConfigurator.
+type InstructionsMcp struct {
+	store   *InstructionsStore
+	tenants *tenant.Registry
+}
+
+func ProvideInstructionsMcp(store *InstructionsStore, tenants *tenant.Registry) *InstructionsMcp {
+	return &InstructionsMcp{store: store, tenants: tenants}
+}
+
+// ConfigureMCP installs the initialize middleware.
+func (m *InstructionsMcp) ConfigureMCP(s *gomcp.Server) {
+	s.AddReceivingMiddleware(m.initializeMiddleware)
+}
+
+func (m *InstructionsMcp) initializeMiddleware(next gomcp.MethodHandler) gomcp.MethodHandler {
+	return func(ctx context.Context, method string, req gomcp.Request) (gomcp.Result, error) {
+		res, err := next(ctx, method, req)
+		if err != nil || method != "initialize" {
+			return res, err
+		}
+		init, ok := res.(*gomcp.InitializeResult)
+		if !ok {
+			return res, err
+		}
+
+		// Header, then the API key's version, then the tenant's, then the active one.
+		version := m.store.Active()
+		if extra := req.GetExtra(); extra != nil {
+			if p, ok := middleware.PrincipalFromTokenInfo(extra.TokenInfo); ok {
+				if t, err := m.tenants.Resolve("", p.Tenant, false); err == nil && t.InstructionsVersion != "" {
+					version = t.InstructionsVersion
+				}
+				if p.InstructionsVersion != "" {
+					version = p.InstructionsVersion
+				}
+			}
+			if v := extra.Header.Get(InstructionsVersionHeader); v != "" {
+				version = v
+			}
+		}
+
+		text, renderErr := m.store.Render(version, ChannelMCP)
+		if renderErr != nil {
+			// Failing initialize would lock the client out; fall back to the
+			// active version and leave a trace of the bad request.
+			logger.Error("Failed to render MCP instructions", zap.String("version", version), zap.Error(renderErr))
+			if text, renderErr = m.store.Render("", ChannelMCP); renderErr != nil {
+				return res, nil
+			}
+		}
+		init.Instructions = text
+		return init, nil
+	}
+}
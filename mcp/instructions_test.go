@@ -0,0 +1,43 @@
+package mcp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/appconfig"
+)
+
+func TestRenderInstructions(t *testing.T) {
+	tests := []struct {
+		channel   Channel
+		pageIndex string
+		want      []string
+		absent    []string
+	}{
+		{ChannelMCP, "", []string{"get_current_date", "get_remedy_relationships", "save_case", "get_case with", "get_case_timeline"}, []string{"{{", "AddFollowUp"}},
+		{ChannelCustomGPT, "", []string{"GetRemedyRelationships", "SaveCase", "GetCase with", "GetCaseTimeline", "AddFollowUp", "Note today's date"}, []string{"{{", "get_"}},
+		{ChannelMCP, "results", []string{"save_case"}, []string{"get_remedy_relationships", "inimical"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.channel)+" "+tt.pageIndex, func(t *testing.T) {
+			store := ProvideInstructionsStore(&appconfig.AppConfig{InstructionsDir: "../instructions", PageIndexDir: tt.pageIndex})
+			text, err := store.Render("v1", tt.channel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(text, s) {
+					t.Errorf("instructions lack %q", s)
+				}
+			}
+			for _, s := range tt.absent {
+				if strings.Contains(text, s) {
+					t.Errorf("instructions contain %q", s)
+				}
+			}
+			if strings.Contains(text, "\n\n\n") {
+				t.Error("instructions contain blank lines in a row")
+			}
+		})
+	}
+}
@@ -2,44 +2,52 @@ package mcp
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 
-	"github.com/SaiNageswarS/go-api-boot/odm"
-	"github.com/SaiNageswarS/go-collection-boot/async"
 	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
-	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
+// relationshipTitle matches the titles of the sections on a remedy's relations
+// to other remedies: Relationship, Compare, Antidotes, Complementary, Inimical,
+// Follows well.
+var relationshipTitle = regexp.MustCompile(`(?i)\b(relationship|relations|compare|comparisons?|antidot|complementary|inimical|follows?\s+well)`)
+
+// ErrInvalidLines is returned for a line range ParseLineRange cannot read.
+var ErrInvalidLines = errors.New("invalid lines format")
+
 // DocSummary is a lightweight representation of a PageIndex document.
 type DocSummary struct {
-	DocID          string `json:"doc_id"`
-	DocName        string `json:"doc_name"`
-	DocDescription string `json:"doc_description"`
-	LineCount      int    `json:"line_count"`
+	DocID          string `json:"doc_id" jsonschema:"Unique document identifier, e.g. ACONITUM"`
+	DocName        string `json:"doc_name" jsonschema:"Medicine name"`
+	DocDescription string `json:"doc_description" jsonschema:"AI-generated description of the document"`
+	LineCount      int    `json:"line_count" jsonschema:"Total line count of the source document"`
 }
 
 // NodeContent is a single section's text extracted by line range.
 type NodeContent struct {
-	Title   string `json:"title"`
-	LineNum int    `json:"line_num"`
-	Text    string `json:"text"`
+	Title   string `json:"title" jsonschema:"Section title"`
+	LineNum int    `json:"line_num" jsonschema:"Line number of the section heading in the source markdown"`
+	Text    string `json:"text" jsonschema:"Full text content of the section"`
 }
 
 // PageIndexService holds the shared data-access logic used by both the
-// REST controller and the MCP configurator.
+// REST controller and the MCP configurator. Every call reads the documents
+// of the tenant in ctx from the store.
 type PageIndexService struct {
-	Repo odm.OdmCollectionInterface[db.PageIndexDocModel]
+	store PageIndexStore
 }
 
-func ProvidePageIndexService(mongo odm.MongoClient) *PageIndexService {
-	repo := odm.CollectionOf[db.PageIndexDocModel](mongo, "devinderhealthcare")
-	return &PageIndexService{Repo: repo}
+func ProvidePageIndexService(store PageIndexStore) *PageIndexService {
+	return &PageIndexService{store: store}
 }
 
-// ListDocuments returns summaries for every document in the collection.
+// ListDocuments returns summaries for every document in the store.
 func (s *PageIndexService) ListDocuments(ctx context.Context) ([]DocSummary, error) {
-	docs, err := async.Await(s.Repo.Find(ctx, bson.M{}, nil, 0, 0))
+	docs, err := s.store.Documents(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -58,22 +66,29 @@ func (s *PageIndexService) ListDocuments(ctx context.Context) ([]DocSummary, err
 
 // GetDocumentStructure returns the tree for a document with text stripped.
 func (s *PageIndexService) GetDocumentStructure(ctx context.Context, docID string) ([]db.PageIndexNode, error) {
-	doc, err := async.Await(s.Repo.FindOneByID(ctx, docID))
+	doc, err := s.GetDocument(ctx, docID)
 	if err != nil {
 		return nil, err
 	}
 	return StripText(doc.Structure), nil
 }
 
+// GetDocument returns the full document, including node text, or
+// ErrDocumentNotFound.
+func (s *PageIndexService) GetDocument(ctx context.Context, docID string) (*db.PageIndexDocModel, error) {
+	return s.store.Document(ctx, docID)
+}
+
 // GetDocumentContent returns text nodes whose line numbers fall within the
-// given range specification (e.g. "10-25" or "5,12,30").
+// given range specification (e.g. "10-25" or "5,12,30"). It returns
+// ErrInvalidLines or ErrDocumentNotFound for bad requests.
 func (s *PageIndexService) GetDocumentContent(ctx context.Context, docID, lines string) ([]NodeContent, error) {
 	minLine, maxLine, err := ParseLineRange(lines)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %v", ErrInvalidLines, err)
 	}
 
-	doc, err := async.Await(s.Repo.FindOneByID(ctx, docID))
+	doc, err := s.GetDocument(ctx, docID)
 	if err != nil {
 		return nil, err
 	}
@@ -81,6 +96,17 @@ func (s *PageIndexService) GetDocumentContent(ctx context.Context, docID, lines
 	return CollectNodes(doc.Structure, minLine, maxLine), nil
 }
 
+// RelationshipSections returns the sections of a document on the remedy's
+// relations to others, with their subsections, for deciding what to prescribe
+// next.
+func (s *PageIndexService) RelationshipSections(ctx context.Context, docID string) ([]NodeContent, error) {
+	doc, err := s.GetDocument(ctx, docID)
+	if err != nil {
+		return nil, err
+	}
+	return CollectMatching(doc.Structure, relationshipTitle), nil
+}
+
 // --- Shared helpers ---
 
 // StripText returns a copy of the tree with Text fields removed.
@@ -103,7 +129,7 @@ func StripText(nodes []db.PageIndexNode) []db.PageIndexNode {
 
 // CollectNodes traverses the tree and returns nodes whose LineNum is in [min, max].
 func CollectNodes(nodes []db.PageIndexNode, minLine, maxLine int) []NodeContent {
-	var results []NodeContent
+	results := []NodeContent{}
 	var traverse func([]db.PageIndexNode)
 	traverse = func(ns []db.PageIndexNode) {
 		for _, n := range ns {
@@ -123,6 +149,37 @@ func CollectNodes(nodes []db.PageIndexNode, minLine, maxLine int) []NodeContent
 	return results
 }
 
+// CollectMatching returns the nodes whose title matches re, each followed by
+// all of its descendants.
+func CollectMatching(nodes []db.PageIndexNode, re *regexp.Regexp) []NodeContent {
+	results := []NodeContent{}
+	var traverse func(ns []db.PageIndexNode, matched bool)
+	traverse = func(ns []db.PageIndexNode, matched bool) {
+		for _, n := range ns {
+			m := matched || re.MatchString(n.Title)
+			if m {
+				results = append(results, NodeContent{Title: n.Title, LineNum: n.LineNum, Text: n.Text})
+			}
+			traverse(n.Nodes, m)
+		}
+	}
+	traverse(nodes, false)
+	return results
+}
+
+// FindNode returns the node with the given NodeID, searching the whole tree.
+func FindNode(nodes []db.PageIndexNode, nodeID string) *db.PageIndexNode {
+	for i := range nodes {
+		if nodes[i].NodeID == nodeID {
+			return &nodes[i]
+		}
+		if found := FindNode(nodes[i].Nodes, nodeID); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
 // ParseLineRange parses line specifications into min and max line numbers.
 // Supported formats: "10-25", "5,12,30", "19-34,321-349".
 func ParseLineRange(s string) (int, int, error) {
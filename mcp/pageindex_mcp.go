@@ -3,20 +3,40 @@ package mcp
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
 	"time"
 
 	"github.com/SaiNageswarS/go-api-boot/odm"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/appconfig"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/audit"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/corpus"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/middleware"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/relations"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/tenant"
+	"github.com/google/jsonschema-go/jsonschema"
 	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
-// PageIndexMcp exposes PageIndex data as MCP tools.
+// PageIndexMcp exposes PageIndex data as MCP tools and resources.
+// Each request reads the knowledge base of the caller's tenant.
 // It implements server.MCPConfigurator.
 type PageIndexMcp struct {
-	svc *PageIndexService
+	ctx     context.Context // the server's; change streams are followed until it is done
+	svc     *PageIndexService
+	graph   *relations.Graph
+	files   bool            // documents served from pageindex_dir; the graph is of those in MongoDB
+	mongo   odm.MongoClient // for the pageindex_docs and corpus_versions change streams
+	corpus  *corpus.Registry
+	tenants *tenant.Registry
+	audit   *audit.Log
+	limiter *middleware.RateLimiter // nil: no limits
 }
 
-func ProvidePageIndexMcp(mongo odm.MongoClient) *PageIndexMcp {
-	return &PageIndexMcp{svc: ProvidePageIndexService(mongo)}
+func ProvidePageIndexMcp(ctx context.Context, ccfg *appconfig.AppConfig, svc *PageIndexService, mongo odm.MongoClient, corpus *corpus.Registry, graph *relations.Graph, tenants *tenant.Registry, auditLog *audit.Log, limiter *middleware.RateLimiter) *PageIndexMcp {
+	return &PageIndexMcp{ctx: ctx, svc: svc, graph: graph, files: ccfg.PageIndexDir != "", mongo: mongo, corpus: corpus, tenants: tenants, audit: auditLog, limiter: limiter}
 }
 
 // --- MCP input types ---
@@ -33,7 +53,61 @@ type getPageContentInput struct {
 	Lines string `json:"lines" jsonschema:"required" jsonschema_description:"Line range to fetch. Examples: 10-25 or 5,12,30 or 19-34,321-349"`
 }
 
-// ConfigureMCP registers the PageIndex tools and utility tools on the MCP server.
+type getRemedyRelationshipsInput struct {
+	DocID string `json:"doc_id" jsonschema:"required" jsonschema_description:"The document ID (e.g. ACONITUM)"`
+}
+
+// --- MCP output types ---
+// Returned as structuredContent; the SDK also mirrors them as JSON text content
+// for clients without structured tool result support.
+
+type currentDateOutput struct {
+	Date      string `json:"date"`      // e.g. "2026-10-18"
+	Formatted string `json:"formatted"` // e.g. "18 October 2026, Sunday, 3:04 PM IST"
+}
+
+type listDocumentsOutput struct {
+	Documents []DocSummary `json:"documents"`
+}
+
+type getDocumentStructureOutput struct {
+	DocID     string             `json:"doc_id"`
+	Structure []db.PageIndexNode `json:"structure"`
+}
+
+type getPageContentOutput struct {
+	DocID string        `json:"doc_id"`
+	Lines string        `json:"lines"`
+	Nodes []NodeContent `json:"nodes"`
+}
+
+// documentStructureSchema builds the output schema for get_document_structure.
+// PageIndexNode is recursive, which schema inference rejects as a cycle, so
+// the node schema is declared once under $defs and referenced from the tree.
+func documentStructureSchema() *jsonschema.Schema {
+	opts := &jsonschema.ForOptions{
+		TypeSchemas: map[reflect.Type]*jsonschema.Schema{
+			reflect.TypeFor[[]db.PageIndexNode](): {
+				Type:  "array",
+				Items: &jsonschema.Schema{Ref: "#/$defs/PageIndexNode"},
+			},
+		},
+	}
+
+	schema, err := jsonschema.For[getDocumentStructureOutput](opts)
+	if err != nil {
+		panic(err)
+	}
+	node, err := jsonschema.For[db.PageIndexNode](opts)
+	if err != nil {
+		panic(err)
+	}
+	schema.Defs = map[string]*jsonschema.Schema{"PageIndexNode": node}
+	return schema
+}
+
+// ConfigureMCP registers the PageIndex tools, utility tools and remedy
+// resources on the MCP server.
 func (m *PageIndexMcp) ConfigureMCP(s *gomcp.Server) {
 	gomcp.AddTool(s, &gomcp.Tool{
 		Name:        "get_current_date",
@@ -48,9 +122,10 @@ func (m *PageIndexMcp) ConfigureMCP(s *gomcp.Server) {
 	}, m.handleListDocuments)
 
 	gomcp.AddTool(s, &gomcp.Tool{
-		Name:        "get_document_structure",
-		Description: "Get the hierarchical table of contents of a medicine document, with section titles, summaries, and line numbers. Text content is stripped to save tokens. Use the line numbers to fetch specific sections with get_page_content.",
-		Annotations: &gomcp.ToolAnnotations{ReadOnlyHint: true},
+		Name:         "get_document_structure",
+		Description:  "Get the hierarchical table of contents of a medicine document, with section titles, summaries, and line numbers. Text content is stripped to save tokens. Use the line numbers to fetch specific sections with get_page_content.",
+		Annotations:  &gomcp.ToolAnnotations{ReadOnlyHint: true},
+		OutputSchema: documentStructureSchema(),
 	}, m.handleGetDocumentStructure)
 
 	gomcp.AddTool(s, &gomcp.Tool{
@@ -58,65 +133,197 @@ func (m *PageIndexMcp) ConfigureMCP(s *gomcp.Server) {
 		Description: "Get the full text content for specific line ranges of a medicine document. Use line numbers from get_document_structure to specify which sections to read.",
 		Annotations: &gomcp.ToolAnnotations{ReadOnlyHint: true},
 	}, m.handleGetPageContent)
+
+	// The relationship graph is extracted from the documents in MongoDB, so
+	// it would not match the documents of pageindex_dir.
+	if !m.files {
+		gomcp.AddTool(s, &gomcp.Tool{
+			Name:        "get_remedy_relationships",
+			Description: "Get the remedies related to a medicine document, by relation type: complementary, inimical, antidote, follows_well and compare. Direction out means the related remedy is named in this document's relationship sections; in means this remedy is named in the other's. Each neighbour cites the passages; fetch the full sections with get_page_content.",
+			Annotations: &gomcp.ToolAnnotations{ReadOnlyHint: true},
+		}, m.handleGetRemedyRelationships)
+	}
+
+	m.configureResources(s)
+
+	// Added last so they wrap the handlers above, the tenant is resolved
+	// before the call is audited, and refused calls are audited too.
+	s.AddReceivingMiddleware(m.rateLimitMiddleware)
+	s.AddReceivingMiddleware(m.auditMiddleware)
+	s.AddReceivingMiddleware(m.tenantMiddleware)
 }
 
-// --- Tool handlers ---
+// auditMiddleware records tool calls and resource reads in the audit log. The
+// handlers add the remedy read and the result count.
+func (m *PageIndexMcp) auditMiddleware(next gomcp.MethodHandler) gomcp.MethodHandler {
+	return func(ctx context.Context, method string, req gomcp.Request) (gomcp.Result, error) {
+		action := method
+		args := map[string]string{}
+		switch r := req.(type) {
+		case *gomcp.CallToolRequest:
+			action += " " + r.Params.Name
+			var raw map[string]any
+			if err := json.Unmarshal(r.Params.Arguments, &raw); err == nil {
+				for name, v := range raw {
+					args[name] = fmt.Sprint(v)
+				}
+			}
+		case *gomcp.ReadResourceRequest:
+			args["uri"] = r.Params.URI
+		default:
+			return next(ctx, method, req)
+		}
 
-func (m *PageIndexMcp) handleListDocuments(ctx context.Context, req *gomcp.CallToolRequest, _ listDocumentsInput) (*gomcp.CallToolResult, any, error) {
-	docs, err := m.svc.ListDocuments(ctx)
-	if err != nil {
-		return nil, nil, err
+		extra := req.GetExtra()
+		if extra == nil {
+			return next(ctx, method, req)
+		}
+		p, ok := middleware.PrincipalFromTokenInfo(extra.TokenInfo)
+		if !ok {
+			return next(ctx, method, req)
+		}
+
+		ctx, call := m.audit.Start(ctx, audit.ChannelMCP, action, p.KeyID, p.Name)
+		if t, ok := tenant.FromContext(ctx); ok {
+			call.SetTenant(t.ID)
+		}
+		for name, v := range args {
+			call.SetArg(name, v)
+		}
+
+		res, err := next(ctx, method, req)
+		callErr := err
+		if tr, ok := res.(*gomcp.CallToolResult); ok && tr.IsError && callErr == nil {
+			callErr = errors.New("tool error")
+			if len(tr.Content) > 0 {
+				if text, ok := tr.Content[0].(*gomcp.TextContent); ok {
+					callErr = errors.New(text.Text)
+				}
+			}
+		}
+		call.Finish(0, callErr)
+		return res, err
 	}
+}
 
-	jsonBytes, err := json.Marshal(docs)
-	if err != nil {
-		return nil, nil, err
+// toolClasses is the rate limit class of the tools that do not read documents,
+// the scope their data needs. Other tools are limited as document reads.
+var toolClasses = map[string]string{
+	"save_case":         middleware.ScopeCases,
+	"get_case":          middleware.ScopeCases,
+	"list_cases":        middleware.ScopeCases,
+	"get_case_timeline": middleware.ScopeCases,
+}
+
+// rateLimitMiddleware charges tool calls, of every server tool, to the key's
+// bucket for the tool's class and to its daily quota. Other requests, such as
+// notifications and listings, are not limited.
+func (m *PageIndexMcp) rateLimitMiddleware(next gomcp.MethodHandler) gomcp.MethodHandler {
+	return func(ctx context.Context, method string, req gomcp.Request) (gomcp.Result, error) {
+		call, ok := req.(*gomcp.CallToolRequest)
+		if !ok || req.GetExtra() == nil {
+			return next(ctx, method, req)
+		}
+		p, ok := middleware.PrincipalFromTokenInfo(req.GetExtra().TokenInfo)
+		if !ok {
+			return next(ctx, method, req)
+		}
+
+		class, ok := toolClasses[call.Params.Name]
+		if !ok {
+			class = middleware.ScopeDocumentsRead
+		}
+		if err := m.limiter.LimitTool(ctx, p, call.Params.Name, class); err != nil {
+			res := &gomcp.CallToolResult{}
+			res.SetError(err)
+			return res, nil
+		}
+		return next(ctx, method, req)
 	}
+}
 
-	return &gomcp.CallToolResult{
-		Content: []gomcp.Content{&gomcp.TextContent{Text: string(jsonBytes)}},
-	}, nil, nil
+// tenantMiddleware puts the tenant of the request's API key in the context.
+// Requests without a principal (none reach here through MCPHandler) get no
+// tenant, so data access fails with tenant.ErrNoTenant.
+func (m *PageIndexMcp) tenantMiddleware(next gomcp.MethodHandler) gomcp.MethodHandler {
+	return func(ctx context.Context, method string, req gomcp.Request) (gomcp.Result, error) {
+		extra := req.GetExtra()
+		if extra == nil {
+			return next(ctx, method, req)
+		}
+		p, ok := middleware.PrincipalFromTokenInfo(extra.TokenInfo)
+		if !ok {
+			return next(ctx, method, req)
+		}
+
+		t, err := m.tenants.Resolve("", p.Tenant, false)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %q: %w", p.Tenant, err)
+		}
+		return next(tenant.WithTenant(ctx, t), method, req)
+	}
 }
 
-func (m *PageIndexMcp) handleGetDocumentStructure(ctx context.Context, req *gomcp.CallToolRequest, input getDocumentStructureInput) (*gomcp.CallToolResult, any, error) {
-	structure, err := m.svc.GetDocumentStructure(ctx, input.DocID)
+// --- Tool handlers ---
+
+func (m *PageIndexMcp) handleListDocuments(ctx context.Context, req *gomcp.CallToolRequest, _ listDocumentsInput) (*gomcp.CallToolResult, listDocumentsOutput, error) {
+	docs, err := m.svc.ListDocuments(ctx)
 	if err != nil {
-		return nil, nil, err
+		return nil, listDocumentsOutput{}, err
 	}
 
-	jsonBytes, err := json.Marshal(structure)
+	audit.SetResults(ctx, len(docs))
+	return nil, listDocumentsOutput{Documents: docs}, nil
+}
+
+func (m *PageIndexMcp) handleGetDocumentStructure(ctx context.Context, req *gomcp.CallToolRequest, input getDocumentStructureInput) (*gomcp.CallToolResult, getDocumentStructureOutput, error) {
+	audit.SetDoc(ctx, input.DocID)
+	structure, err := m.svc.GetDocumentStructure(ctx, input.DocID)
 	if err != nil {
-		return nil, nil, err
+		return nil, getDocumentStructureOutput{}, err
+	}
+	if structure == nil {
+		// The output schema declares an array; nil would be sent as null.
+		structure = []db.PageIndexNode{}
 	}
 
-	return &gomcp.CallToolResult{
-		Content: []gomcp.Content{&gomcp.TextContent{Text: string(jsonBytes)}},
-	}, nil, nil
+	audit.SetResults(ctx, len(structure))
+	return nil, getDocumentStructureOutput{DocID: input.DocID, Structure: structure}, nil
 }
 
-func (m *PageIndexMcp) handleGetPageContent(ctx context.Context, req *gomcp.CallToolRequest, input getPageContentInput) (*gomcp.CallToolResult, any, error) {
+func (m *PageIndexMcp) handleGetPageContent(ctx context.Context, req *gomcp.CallToolRequest, input getPageContentInput) (*gomcp.CallToolResult, getPageContentOutput, error) {
+	audit.SetDoc(ctx, input.DocID)
 	nodes, err := m.svc.GetDocumentContent(ctx, input.DocID, input.Lines)
-	if err != nil {
-		res := &gomcp.CallToolResult{
-			Content: []gomcp.Content{&gomcp.TextContent{Text: "Invalid lines format. Use 10-25 or 5,12,30"}},
-			IsError: true,
-		}
-		return res, nil, nil
+	// Returned errors become IsError tool results, skipping output validation.
+	switch {
+	case errors.Is(err, ErrDocumentNotFound):
+		return nil, getPageContentOutput{}, fmt.Errorf("Document %s not found. Use list_documents for the document IDs", input.DocID)
+	case errors.Is(err, ErrInvalidLines):
+		return nil, getPageContentOutput{}, errors.New("Invalid lines format. Use 10-25 or 5,12,30")
+	case err != nil:
+		return nil, getPageContentOutput{}, err
 	}
+	audit.SetResults(ctx, len(nodes))
+	return nil, getPageContentOutput{DocID: input.DocID, Lines: input.Lines, Nodes: nodes}, nil
+}
 
-	jsonBytes, err := json.Marshal(nodes)
+func (m *PageIndexMcp) handleGetRemedyRelationships(ctx context.Context, req *gomcp.CallToolRequest, input getRemedyRelationshipsInput) (*gomcp.CallToolResult, *relations.Relationships, error) {
+	audit.SetDoc(ctx, input.DocID)
+	rel, err := m.graph.Neighbours(ctx, input.DocID)
 	if err != nil {
 		return nil, nil, err
 	}
-
-	return &gomcp.CallToolResult{
-		Content: []gomcp.Content{&gomcp.TextContent{Text: string(jsonBytes)}},
-	}, nil, nil
+	audit.SetResults(ctx, rel.Count())
+	return nil, rel, nil
 }
 
-func (m *PageIndexMcp) handleGetCurrentDate(_ context.Context, _ *gomcp.CallToolRequest, _ getCurrentDateInput) (*gomcp.CallToolResult, any, error) {
-	now := time.Now().Format("2 January 2006, Monday, 3:04 PM MST")
+func (m *PageIndexMcp) handleGetCurrentDate(_ context.Context, _ *gomcp.CallToolRequest, _ getCurrentDateInput) (*gomcp.CallToolResult, currentDateOutput, error) {
+	now := time.Now()
+	out := currentDateOutput{
+		Date:      now.Format(time.DateOnly),
+		Formatted: now.Format("2 January 2006, Monday, 3:04 PM MST"),
+	}
 	return &gomcp.CallToolResult{
-		Content: []gomcp.Content{&gomcp.TextContent{Text: now}},
-	}, nil, nil
+		Content: []gomcp.Content{&gomcp.TextContent{Text: out.Formatted}},
+	}, out, nil
 }
@@ -0,0 +1,354 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/SaiNageswarS/go-api-boot/logger"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/audit"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.uber.org/zap"
+)
+
+// Resource URIs:
+//
+//	materia-medica://ACONITUM            whole remedy as markdown
+//	materia-medica://ACONITUM/node/0007  one section (and its sub-sections)
+//
+// Every remedy of the caller's tenant is listed by resources/list. Sections are
+// only reachable through the template, to keep the list to one entry per remedy.
+const (
+	resourceScheme      = "materia-medica://"
+	resourceMIMEType    = "text/markdown"
+	docTemplateURI      = resourceScheme + "{doc_id}"
+	nodeTemplateURI     = resourceScheme + "{doc_id}/node/{node_id}"
+	watchRetryInterval  = 30 * time.Second
+	resourceListTimeout = 30 * time.Second
+)
+
+// DocURI returns the resource URI of a remedy.
+func DocURI(docID string) string {
+	return resourceScheme + url.PathEscape(docID)
+}
+
+// NodeURI returns the resource URI of a section within a remedy.
+func NodeURI(docID, nodeID string) string {
+	return DocURI(docID) + "/node/" + url.PathEscape(nodeID)
+}
+
+// parseResourceURI splits a materia-medica URI into doc and (optional) node ID.
+func parseResourceURI(uri string) (docID, nodeID string, ok bool) {
+	rest, found := strings.CutPrefix(uri, resourceScheme)
+	if !found || rest == "" {
+		return "", "", false
+	}
+
+	docPart, nodePart, hasNode := strings.Cut(rest, "/node/")
+	docID, err := url.PathUnescape(docPart)
+	if err != nil || docID == "" || strings.Contains(docID, "/") {
+		return "", "", false
+	}
+	if !hasNode {
+		return docID, "", true
+	}
+
+	nodeID, err = url.PathUnescape(nodePart)
+	if err != nil || nodeID == "" {
+		return "", "", false
+	}
+	return docID, nodeID, true
+}
+
+// HandleResourceSubscribe accepts subscriptions to materia-medica resources.
+// Set it as ServerOptions.SubscribeHandler; update notifications are sent by
+// the change stream watcher started in ConfigureMCP.
+func HandleResourceSubscribe(_ context.Context, req *gomcp.SubscribeRequest) error {
+	if _, _, ok := parseResourceURI(req.Params.URI); !ok {
+		return gomcp.ResourceNotFoundError(req.Params.URI)
+	}
+	return nil
+}
+
+// HandleResourceUnsubscribe is the ServerOptions.UnsubscribeHandler counterpart.
+func HandleResourceUnsubscribe(_ context.Context, _ *gomcp.UnsubscribeRequest) error {
+	return nil
+}
+
+// configureResources registers the remedy and section templates, answers
+// resources/list with the caller's tenant's remedies, and starts watching
+// pageindex_docs and corpus_versions for changes.
+func (m *PageIndexMcp) configureResources(s *gomcp.Server) {
+	s.AddResourceTemplate(&gomcp.ResourceTemplate{
+		Name:        "remedy",
+		Title:       "Materia medica remedy",
+		Description: "Full text of a remedy from the materia medica knowledge base.",
+		MIMEType:    resourceMIMEType,
+		URITemplate: docTemplateURI,
+	}, m.readResource)
+
+	s.AddResourceTemplate(&gomcp.ResourceTemplate{
+		Name:        "remedy_section",
+		Title:       "Materia medica remedy section",
+		Description: "Text of one section of a remedy, by node ID from get_document_structure.",
+		MIMEType:    resourceMIMEType,
+		URITemplate: nodeTemplateURI,
+	}, m.readResource)
+
+	s.AddReceivingMiddleware(m.listResourcesMiddleware)
+
+	// Only documents read from MongoDB change while the server runs.
+	if _, ok := m.svc.store.(*mongoPageIndexStore); ok && m.mongo != nil {
+		for _, database := range m.tenants.Databases() {
+			go m.watchDocuments(m.ctx, s, database)
+			go m.watchVersions(m.ctx, s, database)
+		}
+	}
+}
+
+// listResourcesMiddleware answers resources/list from the tenant's database.
+// Resources registered on the server are shared by every session, so remedies
+// are listed per request instead; reads go through the templates.
+func (m *PageIndexMcp) listResourcesMiddleware(next gomcp.MethodHandler) gomcp.MethodHandler {
+	return func(ctx context.Context, method string, req gomcp.Request) (gomcp.Result, error) {
+		if method != "resources/list" {
+			return next(ctx, method, req)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, resourceListTimeout)
+		defer cancel()
+
+		docs, err := m.svc.ListDocuments(ctx)
+		if err != nil {
+			logger.Error("Failed to list documents for MCP resources", zap.Error(err))
+			return nil, err
+		}
+
+		res := &gomcp.ListResourcesResult{Resources: make([]*gomcp.Resource, 0, len(docs))}
+		for _, d := range docs {
+			res.Resources = append(res.Resources, &gomcp.Resource{
+				Name:        d.DocID,
+				Title:       d.DocName,
+				Description: d.DocDescription,
+				MIMEType:    resourceMIMEType,
+				URI:         DocURI(d.DocID),
+			})
+		}
+		return res, nil
+	}
+}
+
+// readResource serves both remedy and section URIs.
+func (m *PageIndexMcp) readResource(ctx context.Context, req *gomcp.ReadResourceRequest) (*gomcp.ReadResourceResult, error) {
+	uri := req.Params.URI
+	docID, nodeID, ok := parseResourceURI(uri)
+	if !ok {
+		return nil, gomcp.ResourceNotFoundError(uri)
+	}
+
+	audit.SetDoc(ctx, docID)
+	audit.SetArg(ctx, "node", nodeID)
+	doc, err := m.svc.GetDocument(ctx, docID)
+	if errors.Is(err, ErrDocumentNotFound) {
+		return nil, gomcp.ResourceNotFoundError(uri)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	if nodeID == "" {
+		renderNodes(&b, doc.Structure, 1)
+	} else {
+		node := FindNode(doc.Structure, nodeID)
+		if node == nil {
+			return nil, gomcp.ResourceNotFoundError(uri)
+		}
+		renderNodes(&b, []db.PageIndexNode{*node}, 1)
+	}
+
+	audit.SetResults(ctx, 1)
+	return &gomcp.ReadResourceResult{
+		Contents: []*gomcp.ResourceContents{{URI: uri, MIMEType: resourceMIMEType, Text: b.String()}},
+	}, nil
+}
+
+// renderNodes writes the subtree as markdown. Node text already starts with its
+// own heading line; a heading is synthesised only for nodes without text.
+func renderNodes(b *strings.Builder, nodes []db.PageIndexNode, depth int) {
+	for _, n := range nodes {
+		if text := strings.TrimSpace(n.Text); text != "" {
+			b.WriteString(text)
+		} else {
+			fmt.Fprintf(b, "%s %s", strings.Repeat("#", min(depth, 6)), n.Title)
+		}
+		b.WriteString("\n\n")
+		renderNodes(b, n.Nodes, depth+1)
+	}
+}
+
+// --- change notifications ---
+
+// pageIndexChange is the subset of a change stream event we act on.
+type pageIndexChange struct {
+	OperationType string `bson:"operationType"`
+	DocumentKey   struct {
+		ID string `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument *db.PageIndexDocModel `bson:"fullDocument"`
+}
+
+// watchDocuments follows the pageindex_docs change stream of a tenant database
+// so that subscribers are notified of remedies re-ingested in place. Changes
+// are ignored while a corpus version is active, since the API does not read
+// them then.
+func (m *PageIndexMcp) watchDocuments(ctx context.Context, s *gomcp.Server, database string) {
+	coll := m.mongo.Database(database).Collection(db.PageIndexDocModel{}.CollectionName())
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	follow(ctx, coll, mongo.Pipeline{}, opts, func(ctx context.Context, stream *mongo.ChangeStream) {
+		var change pageIndexChange
+		if err := stream.Decode(&change); err != nil {
+			logger.Error("Failed to decode PageIndex change", zap.Error(err))
+			return
+		}
+		if served, err := m.corpus.ActiveDatabase(ctx, database); err != nil || served != database {
+			return
+		}
+		applyChange(ctx, s, change)
+	})
+}
+
+// corpusChange is the subset of a corpus_versions change stream event we act
+// on.
+type corpusChange struct {
+	DocumentKey struct {
+		ID string `bson:"_id"`
+	} `bson:"documentKey"`
+	UpdateDescription struct {
+		UpdatedFields bson.M `bson:"updatedFields"`
+	} `bson:"updateDescription"`
+}
+
+// watchVersions follows the corpus_versions change stream of a tenant
+// database, so that subscribers are notified of every remedy when another
+// corpus version is promoted or rolled back.
+func (m *PageIndexMcp) watchVersions(ctx context.Context, s *gomcp.Server, database string) {
+	coll := m.mongo.Database(database).Collection(db.CorpusVersionModel{}.CollectionName())
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{"updateDescription.updatedFields.active": bson.M{"$exists": true}}}}}
+	follow(ctx, coll, pipeline, options.ChangeStream(), func(ctx context.Context, stream *mongo.ChangeStream) {
+		var change corpusChange
+		if err := stream.Decode(&change); err != nil {
+			logger.Error("Failed to decode corpus version change", zap.Error(err))
+			return
+		}
+		// A switch deactivates the version it replaces after activating the
+		// new one; only a deactivation that leaves none active is a switch of
+		// its own, back to the tenant's database.
+		if active, _ := change.UpdateDescription.UpdatedFields["active"].(bool); !active {
+			if v, err := m.corpus.Active(ctx, database); err != nil || v != nil {
+				return
+			}
+		}
+
+		served, err := m.corpus.ActiveDatabase(ctx, database)
+		if err != nil {
+			logger.Error("Failed to resolve active corpus", zap.String("database", database), zap.Error(err))
+			return
+		}
+		cur, err := m.mongo.Database(served).Collection(db.PageIndexDocModel{}.CollectionName()).
+			Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"structure.text": 0}))
+		if err != nil {
+			logger.Error("Failed to list documents of the active corpus", zap.String("database", served), zap.Error(err))
+			return
+		}
+		defer cur.Close(ctx)
+		for cur.Next(ctx) {
+			var doc db.PageIndexDocModel
+			if err := cur.Decode(&doc); err != nil {
+				continue
+			}
+			notifyDocument(ctx, s, &doc)
+		}
+		logger.Info("Corpus version switched", zap.String("database", database), zap.String("served", served), zap.String("version", change.DocumentKey.ID))
+	})
+}
+
+// follow calls handle for each event of coll's change stream, reopening the
+// stream when it closes, until ctx is done. Change streams need a replica set
+// (Atlas always is one); on a standalone server this logs and returns.
+func follow(ctx context.Context, coll *mongo.Collection, pipeline mongo.Pipeline, opts options.Lister[options.ChangeStreamOptions], handle func(context.Context, *mongo.ChangeStream)) {
+	for {
+		stream, err := coll.Watch(ctx, pipeline, opts)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Error("Change stream unavailable; resource update notifications disabled", zap.String("collection", coll.Name()), zap.String("database", coll.Database().Name()), zap.Error(err))
+			return
+		}
+
+		for stream.Next(ctx) {
+			handle(ctx, stream)
+		}
+
+		err = stream.Err()
+		_ = stream.Close(context.Background())
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Error("Change stream closed, retrying", zap.String("collection", coll.Name()), zap.String("database", coll.Database().Name()), zap.Error(err), zap.Duration("retryIn", watchRetryInterval))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(watchRetryInterval):
+		}
+	}
+}
+
+// applyChange notifies subscribers of the changed remedy. URIs do not name the
+// tenant, so subscribers of a remedy with the same ID in another tenant are
+// notified too; they re-read their own tenant's copy.
+func applyChange(ctx context.Context, s *gomcp.Server, change pageIndexChange) {
+	docID := change.DocumentKey.ID
+
+	switch change.OperationType {
+	case "delete":
+		notifyUpdated(ctx, s, DocURI(docID))
+	case "insert", "update", "replace":
+		if change.FullDocument == nil {
+			return
+		}
+		notifyDocument(ctx, s, change.FullDocument)
+	default:
+		return
+	}
+
+	logger.Info("PageIndex document changed", zap.String("docId", docID), zap.String("op", change.OperationType))
+}
+
+// notifyDocument notifies subscribers of a remedy, who may hold the remedy or
+// any of its sections.
+func notifyDocument(ctx context.Context, s *gomcp.Server, doc *db.PageIndexDocModel) {
+	notifyUpdated(ctx, s, DocURI(doc.DocID))
+	var walk func([]db.PageIndexNode)
+	walk = func(nodes []db.PageIndexNode) {
+		for _, n := range nodes {
+			notifyUpdated(ctx, s, NodeURI(doc.DocID, n.NodeID))
+			walk(n.Nodes)
+		}
+	}
+	walk(doc.Structure)
+}
+
+func notifyUpdated(ctx context.Context, s *gomcp.Server, uri string) {
+	if err := s.ResourceUpdated(ctx, &gomcp.ResourceUpdatedNotificationParams{URI: uri}); err != nil {
+		logger.Error("Failed to send resource update", zap.String("uri", uri), zap.Error(err))
+	}
+}
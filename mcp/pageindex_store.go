@@ -0,0 +1,158 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/SaiNageswarS/go-api-boot/logger"
+	"github.com/SaiNageswarS/go-api-boot/odm"
+	"github.com/SaiNageswarS/go-collection-boot/async"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/appconfig"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/corpus"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+)
+
+// ErrDocumentNotFound is returned for a document ID the store does not hold.
+var ErrDocumentNotFound = errors.New("document not found")
+
+// PageIndexStore is where PageIndexService reads the PageIndex documents of
+// the tenant in ctx from.
+type PageIndexStore interface {
+	// Documents returns every document, with node text.
+	Documents(ctx context.Context) ([]db.PageIndexDocModel, error)
+	// Document returns one document, or ErrDocumentNotFound.
+	Document(ctx context.Context, docID string) (*db.PageIndexDocModel, error)
+}
+
+// ProvidePageIndexStore reads the documents from the files in pageindex_dir
+// if it is set, and otherwise from the active corpus in MongoDB.
+func ProvidePageIndexStore(ccfg *appconfig.AppConfig, mongo odm.MongoClient, corpus *corpus.Registry) PageIndexStore {
+	if ccfg.PageIndexDir == "" {
+		return &mongoPageIndexStore{mongo: mongo, corpus: corpus}
+	}
+	store, err := NewFilePageIndexStore(ccfg.PageIndexDir)
+	if err != nil {
+		logger.Fatal("Failed to load PageIndex documents", zap.String("dir", ccfg.PageIndexDir), zap.Error(err))
+	}
+	logger.Info("Serving PageIndex documents from files", zap.String("dir", ccfg.PageIndexDir), zap.Int("documents", len(store.ids)))
+	return store
+}
+
+// mongoPageIndexStore reads the pageindex_docs collection of the active
+// corpus of the tenant in ctx.
+type mongoPageIndexStore struct {
+	mongo  odm.MongoClient
+	corpus *corpus.Registry
+}
+
+func (s *mongoPageIndexStore) repo(ctx context.Context) (odm.OdmCollectionInterface[db.PageIndexDocModel], error) {
+	database, err := s.corpus.Database(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return odm.CollectionOf[db.PageIndexDocModel](s.mongo, database), nil
+}
+
+func (s *mongoPageIndexStore) Documents(ctx context.Context) ([]db.PageIndexDocModel, error) {
+	repo, err := s.repo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return async.Await(repo.Find(ctx, bson.M{}, nil, 0, 0))
+}
+
+func (s *mongoPageIndexStore) Document(ctx context.Context, docID string) (*db.PageIndexDocModel, error) {
+	repo, err := s.repo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := async.Await(repo.FindOneByID(ctx, docID))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrDocumentNotFound
+	}
+	return doc, err
+}
+
+// structureFileSuffix ends the name of the file build_pageindex.py saves the
+// tree of an article in, <DOC_ID>_structure.json.
+const structureFileSuffix = "_structure.json"
+
+// FilePageIndexStore serves the trees build_pageindex.py --json-only saved in
+// a directory, results/ by default, without a database. The files are read
+// once, when the store is created, and every tenant gets the same documents.
+type FilePageIndexStore struct {
+	docs map[string]*db.PageIndexDocModel
+	ids  []string
+}
+
+// pageIndexFile is a tree as build_pageindex.py saves it.
+type pageIndexFile struct {
+	DocName        string             `json:"doc_name"`
+	DocDescription string             `json:"doc_description"`
+	LineCount      int                `json:"line_count"`
+	Structure      []db.PageIndexNode `json:"structure"`
+}
+
+// NewFilePageIndexStore reads the <DOC_ID>_structure.json files of dir.
+func NewFilePageIndexStore(dir string) (*FilePageIndexStore, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+structureFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no *%s files in %s", structureFileSuffix, dir)
+	}
+
+	s := &FilePageIndexStore{docs: make(map[string]*db.PageIndexDocModel, len(paths))}
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		var f pageIndexFile
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+
+		docID := strings.TrimSuffix(filepath.Base(p), structureFileSuffix)
+		if f.DocName == "" {
+			f.DocName = docID
+		}
+		s.docs[docID] = &db.PageIndexDocModel{
+			DocID:          docID,
+			DocName:        f.DocName,
+			DocDescription: f.DocDescription,
+			LineCount:      f.LineCount,
+			Structure:      f.Structure,
+		}
+		s.ids = append(s.ids, docID)
+	}
+	slices.Sort(s.ids)
+	return s, nil
+}
+
+// Documents returns the documents by ID.
+func (s *FilePageIndexStore) Documents(ctx context.Context) ([]db.PageIndexDocModel, error) {
+	out := make([]db.PageIndexDocModel, 0, len(s.ids))
+	for _, id := range s.ids {
+		out = append(out, *s.docs[id])
+	}
+	return out, nil
+}
+
+func (s *FilePageIndexStore) Document(ctx context.Context, docID string) (*db.PageIndexDocModel, error) {
+	doc, ok := s.docs[docID]
+	if !ok {
+		return nil, ErrDocumentNotFound
+	}
+	return doc, nil
+}
@@ -0,0 +1,183 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// newTestService serves the trees in testdata, as pageindex_dir would.
+func newTestService(t *testing.T) *PageIndexService {
+	t.Helper()
+	store, err := NewFilePageIndexStore("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ProvidePageIndexService(store)
+}
+
+func TestNewFilePageIndexStoreEmptyDir(t *testing.T) {
+	if _, err := NewFilePageIndexStore(t.TempDir()); err == nil {
+		t.Error("a directory without trees was accepted")
+	}
+}
+
+func TestListDocuments(t *testing.T) {
+	docs, err := newTestService(t).ListDocuments(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DocSummary{
+		{DocID: "ACONITUM", DocName: "ACONITUM NAPELLUS", DocDescription: "Monkshood. Sudden, violent complaints after exposure to dry cold wind or fright, with great fear and restlessness.", LineCount: 140},
+		// Without doc_name, the document is named by its ID.
+		{DocID: "BELLADONNA", DocName: "BELLADONNA", DocDescription: "Deadly nightshade. Hot, red, throbbing inflammation of sudden onset.", LineCount: 60},
+	}
+	if !slices.Equal(docs, want) {
+		t.Errorf("ListDocuments =\n%+v\nwant\n%+v", docs, want)
+	}
+}
+
+func TestGetDocumentStructure(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	structure, err := svc.GetDocumentStructure(ctx, "ACONITUM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(structure) != 1 || len(structure[0].Nodes) != 4 {
+		t.Fatalf("structure = %+v", structure)
+	}
+	mind := structure[0].Nodes[0]
+	if mind.Title != "Mind" || mind.NodeID != "0001" || mind.LineNum != 10 || mind.Summary == "" {
+		t.Errorf("Mind node = %+v", mind)
+	}
+	for _, n := range append(structure, structure[0].Nodes...) {
+		if n.Text != "" {
+			t.Errorf("node %s has text in the structure", n.NodeID)
+		}
+	}
+	if rel := structure[0].Nodes[3]; len(rel.Nodes) != 1 || rel.Nodes[0].Text != "" {
+		t.Errorf("Relationship subsections = %+v, want one without text", rel.Nodes)
+	}
+
+	// The store's own tree keeps its text.
+	doc, err := svc.GetDocument(ctx, "ACONITUM")
+	if err != nil || doc.Structure[0].Nodes[0].Text == "" {
+		t.Errorf("GetDocument after GetDocumentStructure = %+v, %v; want the text intact", doc, err)
+	}
+
+	if _, err := svc.GetDocumentStructure(ctx, "NUX_VOMICA"); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("GetDocumentStructure of an unknown document = %v, want ErrDocumentNotFound", err)
+	}
+}
+
+func TestGetDocumentContent(t *testing.T) {
+	svc := newTestService(t)
+
+	tests := []struct {
+		docID   string
+		lines   string
+		want    []string // titles
+		wantErr error
+	}{
+		{"ACONITUM", "10-25", []string{"Mind", "Head"}, nil},
+		{"ACONITUM", "5,12,30", []string{"Mind", "Head"}, nil}, // from the lowest to the highest line
+		{"ACONITUM", "19-34,321-349", []string{"Head", "Fever", "Relationship", "Complementary"}, nil},
+		{"ACONITUM", "124", []string{"Complementary"}, nil},
+		{"ACONITUM", "1000-2000", []string{}, nil},
+		{"BELLADONNA", "1-60", []string{"BELLADONNA"}, nil},
+		{"ACONITUM", "ten-25", nil, ErrInvalidLines},
+		{"ACONITUM", "10-", nil, ErrInvalidLines},
+		{"NUX_VOMICA", "10-25", nil, ErrDocumentNotFound},
+		{"NUX_VOMICA", "abc", nil, ErrInvalidLines}, // lines are checked first
+	}
+	for _, tt := range tests {
+		t.Run(tt.docID+" "+tt.lines, func(t *testing.T) {
+			nodes, err := svc.GetDocumentContent(context.Background(), tt.docID, tt.lines)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetDocumentContent = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			titles := []string{}
+			for _, n := range nodes {
+				if n.Text == "" {
+					t.Errorf("node %q without text", n.Title)
+				}
+				titles = append(titles, n.Title)
+			}
+			if !slices.Equal(titles, tt.want) {
+				t.Errorf("titles = %q, want %q", titles, tt.want)
+			}
+		})
+	}
+}
+
+func TestRelationshipSections(t *testing.T) {
+	sections, err := newTestService(t).RelationshipSections(context.Background(), "ACONITUM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sections) != 2 || sections[0].Title != "Relationship" || !strings.Contains(sections[1].Text, "Coffea; Sulphur.") {
+		t.Errorf("RelationshipSections = %+v", sections)
+	}
+}
+
+func TestHandleGetPageContentErrors(t *testing.T) {
+	m := &PageIndexMcp{svc: newTestService(t)}
+	tests := []struct {
+		input getPageContentInput
+		want  string
+	}{
+		{getPageContentInput{DocID: "NUX_VOMICA", Lines: "10-25"}, "Document NUX_VOMICA not found"},
+		{getPageContentInput{DocID: "ACONITUM", Lines: "ten"}, "Invalid lines format"},
+	}
+	for _, tt := range tests {
+		_, _, err := m.handleGetPageContent(context.Background(), nil, tt.input)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("handleGetPageContent(%+v) = %v, want %q", tt.input, err, tt.want)
+		}
+	}
+
+	_, out, err := m.handleGetPageContent(context.Background(), nil, getPageContentInput{DocID: "ACONITUM", Lines: "90"})
+	if err != nil || len(out.Nodes) != 1 || out.Nodes[0].Title != "Fever" {
+		t.Errorf("handleGetPageContent = %+v, %v", out, err)
+	}
+}
+
+// failingStore fails every read, as MongoDB does when it cannot be reached.
+type failingStore struct{ err error }
+
+func (s failingStore) Documents(context.Context) ([]db.PageIndexDocModel, error) { return nil, s.err }
+func (s failingStore) Document(context.Context, string) (*db.PageIndexDocModel, error) {
+	return nil, s.err
+}
+
+func TestReadResourceErrors(t *testing.T) {
+	read := func(m *PageIndexMcp, uri string) error {
+		_, err := m.readResource(context.Background(), &gomcp.ReadResourceRequest{Params: &gomcp.ReadResourceParams{URI: uri}})
+		return err
+	}
+	m := &PageIndexMcp{svc: newTestService(t)}
+	for _, uri := range []string{DocURI("NUX_VOMICA"), NodeURI("ACONITUM", "9999"), "materia-medica://"} {
+		if err := read(m, uri); err == nil || !strings.Contains(err.Error(), "Resource not found") {
+			t.Errorf("read %s = %v, want resource not found", uri, err)
+		}
+	}
+	if err := read(m, NodeURI("ACONITUM", "0001")); err != nil {
+		t.Errorf("read Mind section = %v", err)
+	}
+
+	down := errors.New("server selection timeout")
+	m = &PageIndexMcp{svc: ProvidePageIndexService(failingStore{down})}
+	if err := read(m, DocURI("ACONITUM")); !errors.Is(err, down) {
+		t.Errorf("read with the store down = %v, want the store's error", err)
+	}
+}
@@ -0,0 +1,153 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"text/template"
+
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/appconfig"
+	"github.com/google/jsonschema-go/jsonschema"
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const defaultPromptsDir = "prompts"
+
+// PromptMcp exposes the clinical workflows as MCP prompts.
+// Prompt text lives in <prompts_dir>/<name>.md as a text/template and is read
+// on every prompts/get, so wording can change without a rebuild or restart.
+// It implements server.MCPConfigurator.
+type PromptMcp struct {
+	dir string
+}
+
+func ProvidePromptMcp(ccfg *appconfig.AppConfig) *PromptMcp {
+	dir := ccfg.PromptsDir
+	if dir == "" {
+		dir = defaultPromptsDir
+	}
+	return &PromptMcp{dir: dir}
+}
+
+// --- Prompt argument types ---
+// Arguments are declared as structs; names, descriptions and required flags are
+// inferred from them the same way tool input schemas are. Fields without
+// omitempty are required.
+
+type caseTakingArgs struct {
+	PresentingComplaint string `json:"presenting_complaint" jsonschema:"The patient's chief complaint in their own words"`
+	PatientDetails      string `json:"patient_details,omitempty" jsonschema:"Age, sex, occupation or other framing details (no identifying information)"`
+	Language            string `json:"language,omitempty" jsonschema:"Language for follow-up questions, e.g. Punjabi (default English)"`
+}
+
+type differentialDiagnosisArgs struct {
+	Symptoms   string `json:"symptoms" jsonschema:"Case symptoms: mentals, generals, particulars and modalities"`
+	Candidates string `json:"candidates,omitempty" jsonschema:"Comma-separated remedies already under consideration"`
+}
+
+type compareRemediesArgs struct {
+	Remedies string `json:"remedies" jsonschema:"Comma-separated remedy document IDs to compare, e.g. ACONITUM,BELLADONNA"`
+	Focus    string `json:"focus,omitempty" jsonschema:"Aspect to focus the comparison on, e.g. fever or anxiety"`
+}
+
+type summarizeRemedyArgs struct {
+	Remedy   string `json:"remedy" jsonschema:"Remedy document ID, e.g. ACONITUM"`
+	Sections string `json:"sections,omitempty" jsonschema:"Comma-separated section titles to restrict the summary to"`
+}
+
+// ConfigureMCP registers the workflow prompts on the MCP server.
+func (p *PromptMcp) ConfigureMCP(s *gomcp.Server) {
+	addPrompt[caseTakingArgs](s, p, &gomcp.Prompt{
+		Name:        "case_taking",
+		Title:       "Case taking",
+		Description: "Start a Ghegas-style case-taking interview from the presenting complaint.",
+	})
+
+	addPrompt[differentialDiagnosisArgs](s, p, &gomcp.Prompt{
+		Name:        "differential_diagnosis",
+		Title:       "Differential diagnosis",
+		Description: "Work a case through the knowledge base to a most probable remedy with differentials.",
+	})
+
+	addPrompt[compareRemediesArgs](s, p, &gomcp.Prompt{
+		Name:        "compare_remedies",
+		Title:       "Compare remedies",
+		Description: "Compare two or more remedies side by side from their materia medica text.",
+	})
+
+	addPrompt[summarizeRemedyArgs](s, p, &gomcp.Prompt{
+		Name:        "summarize_remedy",
+		Title:       "Summarize remedy",
+		Description: "Summarize a remedy's keynotes, mentals, generals and modalities with citations.",
+	})
+}
+
+// addPrompt registers prompt with arguments inferred from A. The handler
+// validates the arguments against the same schema and renders <name>.md with A.
+func addPrompt[A any](s *gomcp.Server, p *PromptMcp, prompt *gomcp.Prompt) {
+	schema, err := jsonschema.For[A](nil)
+	if err != nil {
+		panic(fmt.Sprintf("prompt %q: %v", prompt.Name, err))
+	}
+	resolved, err := schema.Resolve(nil)
+	if err != nil {
+		panic(fmt.Sprintf("prompt %q: %v", prompt.Name, err))
+	}
+
+	for _, name := range schema.PropertyOrder {
+		prompt.Arguments = append(prompt.Arguments, &gomcp.PromptArgument{
+			Name:        name,
+			Description: schema.Properties[name].Description,
+			Required:    slices.Contains(schema.Required, name),
+		})
+	}
+
+	s.AddPrompt(prompt, func(_ context.Context, req *gomcp.GetPromptRequest) (*gomcp.GetPromptResult, error) {
+		raw := make(map[string]any, len(req.Params.Arguments))
+		for k, v := range req.Params.Arguments {
+			raw[k] = v
+		}
+		if err := resolved.Validate(raw); err != nil {
+			return nil, fmt.Errorf("prompt %s: invalid arguments: %w", prompt.Name, err)
+		}
+
+		var args A
+		b, err := json.Marshal(raw)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &args); err != nil {
+			return nil, err
+		}
+
+		text, err := p.render(prompt.Name, args)
+		if err != nil {
+			return nil, err
+		}
+
+		return &gomcp.GetPromptResult{
+			Description: prompt.Description,
+			Messages: []*gomcp.PromptMessage{
+				{Role: "user", Content: &gomcp.TextContent{Text: text}},
+			},
+		}, nil
+	})
+}
+
+// render executes <dir>/<name>.md with data.
+func (p *PromptMcp) render(name string, data any) (string, error) {
+	path := filepath.Join(p.dir, name+".md")
+	tmpl, err := template.New(filepath.Base(path)).Option("missingkey=error").ParseFiles(path)
+	if err != nil {
+		return "", fmt.Errorf("load prompt %s: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("render prompt %s: %w", name, err)
+	}
+	return buf.String(), nil
+}
@@ -2,19 +2,24 @@ package mcp
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"math"
 	"slices"
 	"sort"
 
 	"github.com/SaiNageswarS/agent-boot/schema"
-	"github.com/SaiNageswarS/go-api-boot/embed"
 	"github.com/SaiNageswarS/go-api-boot/logger"
 	"github.com/SaiNageswarS/go-api-boot/odm"
 	"github.com/SaiNageswarS/go-collection-boot/async"
 	"github.com/SaiNageswarS/go-collection-boot/ds"
 	"github.com/SaiNageswarS/go-collection-boot/linq"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/corpus"
 	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/embedding"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/redact"
 	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -28,30 +33,60 @@ const (
 	vecK               = 10 // # of hits to keep from each engine
 	textK              = 10
 	maxChunks          = 10
+
+	// sourceFilterOversample widens the vector search when results are
+	// filtered by source, since the vector index cannot pre-filter on it.
+	sourceFilterOversample = 3
 )
 
+// SearchOptions narrow a search. The zero value searches every source and
+// returns every matching section.
+type SearchOptions struct {
+	Sources     []string // only chunks from these source URIs (see /metadata/sources)
+	MaxSections int      // at most this many sections; 0: no limit
+}
+
 type SearchTool struct {
-	embedder         embed.Embedder
-	chunkRepository  odm.OdmCollectionInterface[db.ChunkModel]
-	vectorRepository odm.OdmCollectionInterface[db.ChunkAnnModel]
+	model           *embedding.Model
+	chunkRepository odm.OdmCollectionInterface[db.ChunkModel]
+	vectorDatabase  *mongo.Database                                  // holds the vectors of model
+	docRepository   odm.OdmCollectionInterface[db.PageIndexDocModel] // locates sections of chunks stored without their node
 }
 
-func NewSearchTool(chunkRepository odm.OdmCollectionInterface[db.ChunkModel], vectorRepository odm.OdmCollectionInterface[db.ChunkAnnModel], embedder embed.Embedder) *SearchTool {
+func NewSearchTool(chunkRepository odm.OdmCollectionInterface[db.ChunkModel], vectorDatabase *mongo.Database, docRepository odm.OdmCollectionInterface[db.PageIndexDocModel], model *embedding.Model) *SearchTool {
 	return &SearchTool{
-		chunkRepository:  chunkRepository,
-		vectorRepository: vectorRepository,
-		embedder:         embedder,
+		chunkRepository: chunkRepository,
+		vectorDatabase:  vectorDatabase,
+		docRepository:   docRepository,
+		model:           model,
+	}
+}
+
+// SearchToolFor returns a SearchTool over the chunks of the active corpus of
+// the tenant in ctx and their vectors of model.
+func SearchToolFor(ctx context.Context, mongo odm.MongoClient, corpus *corpus.Registry, model *embedding.Model) (*SearchTool, error) {
+	database, err := corpus.Database(ctx)
+	if err != nil {
+		return nil, err
 	}
+	chunkRepository := odm.CollectionOf[db.ChunkModel](mongo, database)
+	docRepository := odm.CollectionOf[db.PageIndexDocModel](mongo, database)
+	return NewSearchTool(chunkRepository, mongo.Database(database), docRepository, model), nil
 }
 
 func (s *SearchTool) Run(ctx context.Context, query string) <-chan *schema.ToolResultChunk {
+	return s.RunWithOptions(ctx, query, SearchOptions{})
+}
+
+// RunWithOptions is Run narrowed by opts.
+func (s *SearchTool) RunWithOptions(ctx context.Context, query string, opts SearchOptions) <-chan *schema.ToolResultChunk {
 	out := make(chan *schema.ToolResultChunk, 20)
 
 	go func() {
 		defer close(out)
 
 		// 1. Perform Hybrid Search and Collect results ranked by RRF score
-		rankedChunks, err := async.Await(s.hybridSearch(ctx, query))
+		rankedChunks, err := async.Await(s.hybridSearch(ctx, query, opts))
 		if err != nil {
 			logger.Error("Failed to perform hybrid search", zap.Error(err))
 			out <- &schema.ToolResultChunk{
@@ -62,6 +97,10 @@ func (s *SearchTool) Run(ctx context.Context, query string) <-chan *schema.ToolR
 
 		// 2. Group by section with adjoining chunks and rank
 		sectionChunks := GroupBySectionWithRank(rankedChunks)
+		if opts.MaxSections > 0 && len(sectionChunks) > opts.MaxSections {
+			sectionChunks = sectionChunks[:opts.MaxSections]
+		}
+		refs := s.nodeRefs(ctx, sectionChunks)
 
 		_, err = linq.Pipe3(
 			linq.FromSlice(ctx, sectionChunks),
@@ -80,6 +119,7 @@ func (s *SearchTool) Run(ctx context.Context, query string) <-chan *schema.ToolR
 					Title:       sectionChunks[0].Title,
 					Attribution: sectionChunks[0].SourceURI,
 					Id:          sectionChunks[0].SectionID,
+					Metadata:    refs[sectionChunks[0].SectionID].metadata(),
 				}
 
 				cache := make(map[string]*db.ChunkModel, len(sectionChunks)*2)
@@ -132,6 +172,101 @@ func (s *SearchTool) Run(ctx context.Context, query string) <-chan *schema.ToolR
 	return out
 }
 
+// nodeRef is the PageIndex node of a section, which get_page_content and
+// GET /documents/{id}/content read with the line range.
+type nodeRef struct {
+	DocID     string
+	NodeID    string
+	LineStart int
+	LineEnd   int
+}
+
+// metadata is r as search result metadata; nil if the document is unknown.
+func (r nodeRef) metadata() map[string]string {
+	if r.DocID == "" {
+		return nil
+	}
+	m := map[string]string{"doc_id": r.DocID}
+	if r.NodeID != "" {
+		m["node_id"] = r.NodeID
+		m["lines"] = fmt.Sprintf("%d-%d", r.LineStart, r.LineEnd)
+	}
+	return m
+}
+
+// nodeRefs returns the node of each section, keyed by section ID. Chunks
+// ingested before they named their node are matched to it by document, the
+// base name of their source, and section path.
+func (s *SearchTool) nodeRefs(ctx context.Context, sections [][]*db.ChunkModel) map[string]nodeRef {
+	refs := make(map[string]nodeRef, len(sections))
+	var unlocated []*db.ChunkModel
+	var docIDs []string
+	for _, sec := range sections {
+		c := sec[0]
+		if c.NodeID != "" {
+			refs[c.SectionID] = nodeRef{DocID: c.DocID, NodeID: c.NodeID, LineStart: c.LineStart, LineEnd: c.LineEnd}
+			continue
+		}
+		unlocated = append(unlocated, c)
+		if id := corpus.SourceDocID(c.SourceURI); !slices.Contains(docIDs, id) {
+			docIDs = append(docIDs, id)
+		}
+	}
+	if len(unlocated) == 0 || s.docRepository == nil {
+		return refs
+	}
+
+	docs, err := async.Await(s.docRepository.Find(ctx, bson.M{"_id": bson.M{"$in": docIDs}}, nil, 0, 0))
+	if err != nil {
+		logger.Error("Failed to fetch documents of search results", zap.Error(err))
+		return refs
+	}
+	for _, c := range unlocated {
+		for i := range docs {
+			if docs[i].DocID == corpus.SourceDocID(c.SourceURI) {
+				refs[c.SectionID] = locateSection(&docs[i], c.SectionPath)
+				break
+			}
+		}
+	}
+	return refs
+}
+
+// locateSection returns the node of doc at sectionPath, its titles joined by
+// " > ", with its line range: from its heading to the line before the next
+// heading. Only the document is known if no node is at the path.
+func locateSection(doc *db.PageIndexDocModel, sectionPath string) nodeRef {
+	type flat struct {
+		path string
+		node *db.PageIndexNode
+	}
+	var nodes []flat
+	var walk func(ns []db.PageIndexNode, prefix string)
+	walk = func(ns []db.PageIndexNode, prefix string) {
+		for i := range ns {
+			p := ns[i].Title
+			if prefix != "" {
+				p = prefix + " > " + p
+			}
+			nodes = append(nodes, flat{p, &ns[i]})
+			walk(ns[i].Nodes, p)
+		}
+	}
+	walk(doc.Structure, "")
+
+	for i, f := range nodes {
+		if f.path != sectionPath {
+			continue
+		}
+		end := doc.LineCount
+		if i+1 < len(nodes) {
+			end = nodes[i+1].node.LineNum - 1
+		}
+		return nodeRef{DocID: doc.DocID, NodeID: f.node.NodeID, LineStart: f.node.LineNum, LineEnd: max(end, f.node.LineNum)}
+	}
+	return nodeRef{DocID: doc.DocID}
+}
+
 // ──────────────────────────────────────────────────────────────────────────────
 //
 //	Reciprocal-Rank Fusion (RRF)
@@ -175,7 +310,7 @@ func (s *SearchTool) Run(ctx context.Context, query string) <-chan *schema.ToolR
 //	score thresholds only for domain-specific guard-rails.
 //
 // ──────────────────────────────────────────────────────────────────────────────
-func (s *SearchTool) hybridSearch(ctx context.Context, query string) <-chan async.Result[[]*db.ChunkModel] {
+func (s *SearchTool) hybridSearch(ctx context.Context, query string, opts SearchOptions) <-chan async.Result[[]*db.ChunkModel] {
 
 	return async.Go(func() ([]*db.ChunkModel, error) {
 		//----------------------------------------------------------------------
@@ -185,22 +320,23 @@ func (s *SearchTool) hybridSearch(ctx context.Context, query string) <-chan asyn
 			TermSearch(ctx, query, odm.TermSearchParams{
 				IndexName: db.TextSearchIndexName,
 				Path:      db.TextSearchPaths,
+				Filter:    sourceFilter(opts.Sources),
 				Limit:     textK,
 			})
 
-		logger.Info("Getting embedding for query", zap.String("queryInput", query))
-		emb, err := async.Await(s.embedder.GetEmbedding(ctx, query, embed.WithTask("retrieval.query")))
+		logger.Info("Getting embedding for query", zap.String("queryInput", redact.Mask(query)))
+		emb, err := s.model.Query(ctx, query)
 		if err != nil {
 			return nil, status.Errorf(codes.Internal, "embed: %v", err)
 		}
 
-		vecTask := s.vectorRepository.
-			VectorSearch(ctx, emb, odm.VectorSearchParams{
-				IndexName:     db.VectorIndexName,
-				Path:          db.VectorPath,
-				K:             vecK,
-				NumCandidates: 100,
-			})
+		k := vecK
+		if len(opts.Sources) > 0 {
+			k *= sourceFilterOversample
+		}
+		vecTask := async.Go(func() ([]odm.SearchHit[db.ChunkAnnModel], error) {
+			return s.model.Search(ctx, s.vectorDatabase, emb, k, 100*k/vecK)
+		})
 
 		//----------------------------------------------------------------------
 		// 2. Convert each result list → id→rank    (rank ∈ {1,2,…})
@@ -211,7 +347,9 @@ func (s *SearchTool) hybridSearch(ctx context.Context, query string) <-chan asyn
 		}
 
 		vecRanks, err := collectVectorSearchRanks(vecTask)
-		if err != nil {
+		if errors.Is(err, embedding.ErrIndexMismatch) {
+			return nil, status.Errorf(codes.FailedPrecondition, "vector search: %v", err)
+		} else if err != nil {
 			logger.Error("vector search failed", zap.Error(err))
 		}
 
@@ -227,6 +365,20 @@ func (s *SearchTool) hybridSearch(ctx context.Context, query string) <-chan asyn
 			combined[id] += vectorSearchWeight / float64(rrfK+r)
 		}
 
+		// Vector hits carry no source; look them up and drop other sources'.
+		if len(opts.Sources) > 0 {
+			ids := make([]string, 0, len(combined))
+			for id := range combined {
+				ids = append(ids, id)
+			}
+			for _, ch := range s.fetchChunksByIds(ctx, cache, ids) {
+				cache[ch.ChunkID] = ch
+				if !slices.Contains(opts.Sources, ch.SourceURI) {
+					delete(combined, ch.ChunkID)
+				}
+			}
+		}
+
 		//----------------------------------------------------------------------
 		// 4. Keep the top-N with a min-heap (higher RRF score = better)
 		//----------------------------------------------------------------------
@@ -261,6 +413,14 @@ func (s *SearchTool) hybridSearch(ctx context.Context, query string) <-chan asyn
 	})
 }
 
+// sourceFilter restricts text search to sources; nil for all.
+func sourceFilter(sources []string) bson.M {
+	if len(sources) == 0 {
+		return nil
+	}
+	return bson.M{"sourceUri": bson.M{"$in": sources}}
+}
+
 // Returns id→rank (1-based) **and** a cache of the full ChunkModel docs.
 func collectTextSearchRanks(
 	task <-chan async.Result[[]odm.SearchHit[db.ChunkModel]],
@@ -293,7 +453,7 @@ func collectVectorSearchRanks(
 
 	hits, err := async.Await(task)
 	if err != nil {
-		return ranks, status.Errorf(codes.Internal, "await vector hits: %v", err)
+		return ranks, fmt.Errorf("await vector hits: %w", err)
 	}
 
 	for i, h := range hits {
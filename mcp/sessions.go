@@ -0,0 +1,159 @@
+package mcp
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SaiNageswarS/go-api-boot/logger"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/middleware"
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+	"go.uber.org/zap"
+)
+
+// SessionInfo describes a live MCP session and the key that opened it.
+type SessionInfo struct {
+	ID        string    `json:"id"`
+	KeyID     string    `json:"keyId"`
+	KeyName   string    `json:"keyName"`
+	CreatedAt time.Time `json:"createdAt"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// SessionRegistry records which API key opened each MCP session.
+// The streamable handler itself rejects requests whose key differs from the
+// one that initialized the session (TokenInfo.UserID is the key ID) and closes
+// idle sessions after StreamableHTTPOptions.SessionTimeout; the registry adds
+// listing and revocation on top.
+type SessionRegistry struct {
+	mu       sync.Mutex
+	server   *gomcp.Server
+	sessions map[string]*SessionInfo
+}
+
+func ProvideSessionRegistry() *SessionRegistry {
+	return &SessionRegistry{sessions: map[string]*SessionInfo{}}
+}
+
+// List returns the live sessions, most recently active first.
+func (r *SessionRegistry) List() []SessionInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]SessionInfo, 0, len(r.sessions))
+	for _, info := range r.sessions {
+		out = append(out, *info)
+	}
+	slices.SortFunc(out, func(a, b SessionInfo) int { return b.LastSeen.Compare(a.LastSeen) })
+	return out
+}
+
+// Revoke closes a session. Further requests with its ID get 404 and the client
+// has to initialize again, authenticating afresh. It reports whether the
+// session existed.
+func (r *SessionRegistry) Revoke(sessionID string) bool {
+	return r.closeMatching(func(ss *gomcp.ServerSession, _ *SessionInfo) bool { return ss.ID() == sessionID }) > 0
+}
+
+// RevokeKey closes every session opened with keyID, including open SSE streams
+// that would otherwise outlive a revoked key. It returns the number closed.
+func (r *SessionRegistry) RevokeKey(keyID string) int {
+	return r.closeMatching(func(_ *gomcp.ServerSession, info *SessionInfo) bool { return info.KeyID == keyID })
+}
+
+func (r *SessionRegistry) closeMatching(match func(*gomcp.ServerSession, *SessionInfo) bool) int {
+	r.mu.Lock()
+	server := r.server
+	r.mu.Unlock()
+	if server == nil {
+		return 0
+	}
+
+	var matched []*gomcp.ServerSession
+	for ss := range server.Sessions() {
+		r.mu.Lock()
+		info := r.sessions[ss.ID()]
+		r.mu.Unlock()
+		if info != nil && match(ss, info) {
+			matched = append(matched, ss)
+		}
+	}
+
+	// Close outside the lock: the session's Wait goroutine removes the entry.
+	for _, ss := range matched {
+		if err := ss.Close(); err != nil {
+			logger.Error("Failed to close MCP session", zap.String("sessionId", ss.ID()), zap.Error(err))
+		}
+	}
+	return len(matched)
+}
+
+func (r *SessionRegistry) track(ss *gomcp.ServerSession, principal *middleware.Principal) {
+	now := time.Now()
+	r.mu.Lock()
+	r.sessions[ss.ID()] = &SessionInfo{
+		ID:        ss.ID(),
+		KeyID:     principal.KeyID,
+		KeyName:   principal.Name,
+		CreatedAt: now,
+		LastSeen:  now,
+	}
+	r.mu.Unlock()
+
+	go func() {
+		_ = ss.Wait()
+		r.mu.Lock()
+		delete(r.sessions, ss.ID())
+		r.mu.Unlock()
+	}()
+}
+
+func (r *SessionRegistry) touch(sessionID string) {
+	r.mu.Lock()
+	if info := r.sessions[sessionID]; info != nil {
+		info.LastSeen = time.Now()
+	}
+	r.mu.Unlock()
+}
+
+// SessionMcp records sessions in the SessionRegistry as they are initialized.
+// It implements server.MCPConfigurator.
+type SessionMcp struct {
+	registry *SessionRegistry
+}
+
+func ProvideSessionMcp(registry *SessionRegistry) *SessionMcp {
+	return &SessionMcp{registry: registry}
+}
+
+// ConfigureMCP installs the session tracking middleware.
+func (m *SessionMcp) ConfigureMCP(s *gomcp.Server) {
+	m.registry.mu.Lock()
+	m.registry.server = s
+	m.registry.mu.Unlock()
+
+	s.AddReceivingMiddleware(m.trackingMiddleware)
+}
+
+func (m *SessionMcp) trackingMiddleware(next gomcp.MethodHandler) gomcp.MethodHandler {
+	return func(ctx context.Context, method string, req gomcp.Request) (gomcp.Result, error) {
+		ss, ok := req.GetSession().(*gomcp.ServerSession)
+		if !ok || ss.ID() == "" {
+			return next(ctx, method, req)
+		}
+
+		if method == "initialize" {
+			if extra := req.GetExtra(); extra != nil {
+				if p, ok := middleware.PrincipalFromTokenInfo(extra.TokenInfo); ok {
+					m.registry.track(ss, p)
+					logger.Info("MCP session opened", zap.String("sessionId", ss.ID()), zap.String("keyId", p.KeyID))
+				}
+			}
+		} else if !strings.HasPrefix(method, "notifications/") {
+			m.registry.touch(ss.ID())
+		}
+		return next(ctx, method, req)
+	}
+}
@@ -0,0 +1,257 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SaiNageswarS/go-api-boot/odm"
+	"github.com/SaiNageswarS/go-collection-boot/async"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/appconfig"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// Scopes granted to API keys. admin implies every other scope.
+const (
+	ScopeSearch        = "search"
+	ScopeDocumentsRead = "documents:read"
+	ScopeCases         = "cases"
+	ScopeAdmin         = "admin"
+)
+
+// KnownScopes lists every scope a key may be granted.
+var KnownScopes = []string{ScopeSearch, ScopeDocumentsRead, ScopeCases, ScopeAdmin}
+
+const (
+	// Keys look like mrk_<keyId>_<secret>. The key ID is stored in clear to
+	// find the record; the whole key is compared by hash.
+	keyPrefix = "mrk_"
+
+	// envKeyID identifies the API_KEY environment variable, kept as a built-in
+	// admin key to bootstrap the store.
+	envKeyID = "env"
+
+	// keyCacheTTL bounds how long a revoked key keeps working on other replicas.
+	keyCacheTTL = time.Minute
+)
+
+// ErrInvalidKey is returned for unknown, disabled or expired keys.
+var ErrInvalidKey = errors.New("invalid API key")
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	KeyID               string
+	Name                string
+	Scopes              []string
+	InstructionsVersion string
+	ExpiresAt           time.Time // zero: never
+	DailyQuota          int       // zero: the configured default; -1: unlimited
+	Tenant              string    // empty: not bound to a tenant
+}
+
+// HasScope reports whether the principal was granted scope.
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, ScopeAdmin) || slices.Contains(p.Scopes, scope)
+}
+
+// EffectiveScopes expands admin into every known scope.
+func (p *Principal) EffectiveScopes() []string {
+	if slices.Contains(p.Scopes, ScopeAdmin) {
+		return slices.Clone(KnownScopes)
+	}
+	return slices.Clone(p.Scopes)
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns ctx carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal set by the auth middleware.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+type cachedKey struct {
+	model     *db.APIKeyModel
+	fetchedAt time.Time
+}
+
+// APIKeyStore issues, looks up and revokes API keys kept in the api_keys collection.
+type APIKeyStore struct {
+	repo   odm.OdmCollectionInterface[db.APIKeyModel]
+	envKey string
+
+	mu    sync.Mutex
+	cache map[string]cachedKey
+}
+
+func ProvideAPIKeyStore(mongo odm.MongoClient, ccfg *appconfig.AppConfig) *APIKeyStore {
+	return &APIKeyStore{
+		repo:   odm.CollectionOf[db.APIKeyModel](mongo, ccfg.ControlDB()),
+		envKey: os.Getenv("API_KEY"),
+		cache:  map[string]cachedKey{},
+	}
+}
+
+// Authenticate resolves key to its principal.
+func (s *APIKeyStore) Authenticate(ctx context.Context, key string) (*Principal, error) {
+	if s.envKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(s.envKey)) == 1 {
+		return &Principal{KeyID: envKeyID, Name: "API_KEY", Scopes: []string{ScopeAdmin}}, nil
+	}
+
+	keyID, ok := parseKey(key)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+
+	model, err := s.lookup(ctx, keyID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hash := hashKey(key)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(model.SecretHash)) != 1 {
+		return nil, ErrInvalidKey
+	}
+	if model.Disabled || (!model.ExpiresAt.IsZero() && time.Now().After(model.ExpiresAt)) {
+		return nil, ErrInvalidKey
+	}
+
+	return &Principal{
+		KeyID:               model.KeyID,
+		Name:                model.Name,
+		Scopes:              model.Scopes,
+		InstructionsVersion: model.InstructionsVersion,
+		ExpiresAt:           model.ExpiresAt,
+		DailyQuota:          model.DailyQuota,
+		Tenant:              model.Tenant,
+	}, nil
+}
+
+// Create issues a new key. The returned key is not stored and cannot be recovered.
+func (s *APIKeyStore) Create(ctx context.Context, model db.APIKeyModel) (string, *db.APIKeyModel, error) {
+	if model.Name == "" {
+		return "", nil, errors.New("name is required")
+	}
+	if len(model.Scopes) == 0 {
+		return "", nil, errors.New("at least one scope is required")
+	}
+	for _, scope := range model.Scopes {
+		if !slices.Contains(KnownScopes, scope) {
+			return "", nil, fmt.Errorf("unknown scope %q (known: %s)", scope, strings.Join(KnownScopes, ", "))
+		}
+	}
+	if !model.ExpiresAt.IsZero() && model.ExpiresAt.Before(time.Now()) {
+		return "", nil, errors.New("expiresAt is in the past")
+	}
+	if model.DailyQuota < -1 {
+		return "", nil, errors.New("dailyQuota must be positive, or -1 for unlimited")
+	}
+
+	idBytes := make([]byte, 6)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", nil, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+
+	model.KeyID = hex.EncodeToString(idBytes)
+	key := keyPrefix + model.KeyID + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	model.SecretHash = hashKey(key)
+	model.Disabled = false
+
+	if _, err := async.Await(s.repo.Save(ctx, model)); err != nil {
+		return "", nil, err
+	}
+	return key, &model, nil
+}
+
+// List returns every key, newest first.
+func (s *APIKeyStore) List(ctx context.Context) ([]db.APIKeyModel, error) {
+	keys, err := async.Await(s.repo.Find(ctx, bson.M{}, bson.D{{Key: "createdOn", Value: -1}}, 0, 0))
+	if err != nil {
+		return nil, err
+	}
+	if keys == nil {
+		keys = []db.APIKeyModel{}
+	}
+	return keys, nil
+}
+
+// Revoke disables a key. The record is kept so the name still shows up in listings.
+func (s *APIKeyStore) Revoke(ctx context.Context, keyID string) error {
+	model, err := async.Await(s.repo.FindOneByID(ctx, keyID))
+	if err != nil {
+		return err
+	}
+
+	model.Disabled = true
+	if _, err := async.Await(s.repo.Save(ctx, *model)); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	delete(s.cache, keyID)
+	s.mu.Unlock()
+	return nil
+}
+
+// lookup reads a key record, cached for keyCacheTTL. Misses are not cached so
+// that guessed IDs cannot grow the cache.
+func (s *APIKeyStore) lookup(ctx context.Context, keyID string) (*db.APIKeyModel, error) {
+	s.mu.Lock()
+	c, ok := s.cache[keyID]
+	s.mu.Unlock()
+	if ok && time.Since(c.fetchedAt) < keyCacheTTL {
+		return c.model, nil
+	}
+
+	model, err := async.Await(s.repo.FindOneByID(ctx, keyID))
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.cache[keyID] = cachedKey{model: model, fetchedAt: time.Now()}
+	s.mu.Unlock()
+	return model, nil
+}
+
+// parseKey returns the key ID of a well-formed mrk_ key.
+func parseKey(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, keyPrefix)
+	if !ok {
+		return "", false
+	}
+	keyID, secret, ok := strings.Cut(rest, "_")
+	if !ok || keyID == "" || secret == "" {
+		return "", false
+	}
+	return keyID, true
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
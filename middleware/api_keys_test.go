@@ -0,0 +1,327 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SaiNageswarS/go-api-boot/odm"
+	"github.com/SaiNageswarS/go-collection-boot/async"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// fakeKeyRepo keeps API key records in memory. Methods the store does not
+// call are left to the nil embedded interface.
+type fakeKeyRepo struct {
+	odm.OdmCollectionInterface[db.APIKeyModel]
+
+	mu    sync.Mutex
+	keys  map[string]db.APIKeyModel
+	reads int
+}
+
+func newFakeKeyRepo() *fakeKeyRepo {
+	return &fakeKeyRepo{keys: map[string]db.APIKeyModel{}}
+}
+
+func (r *fakeKeyRepo) Save(ctx context.Context, model db.APIKeyModel) <-chan async.Result[struct{}] {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys[model.KeyID] = model
+	return async.Go(func() (struct{}, error) { return struct{}{}, nil })
+}
+
+func (r *fakeKeyRepo) FindOneByID(ctx context.Context, id string) <-chan async.Result[*db.APIKeyModel] {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reads++
+	model, ok := r.keys[id]
+	return async.Go(func() (*db.APIKeyModel, error) {
+		if !ok {
+			return nil, mongo.ErrNoDocuments
+		}
+		return &model, nil
+	})
+}
+
+func (r *fakeKeyRepo) Find(ctx context.Context, filters bson.M, sort bson.D, limit, skip int64) <-chan async.Result[[]db.APIKeyModel] {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []db.APIKeyModel
+	for _, m := range r.keys {
+		out = append(out, m)
+	}
+	return async.Go(func() ([]db.APIKeyModel, error) { return out, nil })
+}
+
+func newTestKeyStore(repo *fakeKeyRepo, envKey string) *APIKeyStore {
+	return &APIKeyStore{repo: repo, envKey: envKey, cache: map[string]cachedKey{}}
+}
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		key    string
+		wantID string
+		wantOK bool
+	}{
+		{"mrk_3f9a1c07b2de_c2VjcmV0", "3f9a1c07b2de", true},
+		{"mrk_3f9a1c07b2de_sec_ret", "3f9a1c07b2de", true}, // base64url secrets may contain _
+		{"mrk_3f9a1c07b2de_", "", false},
+		{"mrk__secret", "", false},
+		{"mrk_3f9a1c07b2de", "", false},
+		{"xyz_3f9a1c07b2de_secret", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		id, ok := parseKey(tt.key)
+		if id != tt.wantID || ok != tt.wantOK {
+			t.Errorf("parseKey(%q) = %q, %v; want %q, %v", tt.key, id, ok, tt.wantID, tt.wantOK)
+		}
+	}
+}
+
+func TestHashKey(t *testing.T) {
+	// echo -n abc | sha256sum
+	const want = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if got := hashKey("abc"); got != want {
+		t.Errorf("hashKey(abc) = %s, want %s", got, want)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeKeyRepo()
+	store := newTestKeyStore(repo, "env-secret")
+
+	valid, _, err := store.Create(ctx, db.APIKeyModel{Name: "clinic", Scopes: []string{ScopeSearch}, Tenant: "otherclinic", DailyQuota: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiring, model, err := store.Create(ctx, db.APIKeyModel{Name: "expiring", Scopes: []string{ScopeSearch}, ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := repo.keys[model.KeyID]
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	repo.keys[model.KeyID] = expired
+	disabled, model, err := store.Create(ctx, db.APIKeyModel{Name: "disabled", Scopes: []string{ScopeSearch}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := repo.keys[model.KeyID]
+	d.Disabled = true
+	repo.keys[model.KeyID] = d
+
+	validID, _ := parseKey(valid)
+	tests := []struct {
+		name    string
+		key     string
+		wantErr error
+	}{
+		{"issued key", valid, nil},
+		{"env key", "env-secret", nil},
+		{"wrong secret", "mrk_" + validID + "_not-the-secret", ErrInvalidKey},
+		{"unknown key ID", "mrk_000000000000_secret", ErrInvalidKey},
+		{"malformed", "Bearer " + valid, ErrInvalidKey},
+		{"expired", expiring, ErrInvalidKey},
+		{"disabled", disabled, ErrInvalidKey},
+		{"env key prefix", "env-secre", ErrInvalidKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := store.Authenticate(ctx, tt.key)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Authenticate = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	p, err := store.Authenticate(ctx, valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "clinic" || p.Tenant != "otherclinic" || p.DailyQuota != 50 || p.KeyID != validID {
+		t.Errorf("principal = %+v", p)
+	}
+	if p, _ := store.Authenticate(ctx, "env-secret"); p.KeyID != envKeyID || !p.HasScope(ScopeAdmin) {
+		t.Errorf("env principal = %+v", p)
+	}
+}
+
+func TestAuthenticateWithoutEnvKey(t *testing.T) {
+	store := newTestKeyStore(newFakeKeyRepo(), "")
+	if _, err := store.Authenticate(context.Background(), ""); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("empty key with no API_KEY set = %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestCreateStoresOnlyTheHash(t *testing.T) {
+	repo := newFakeKeyRepo()
+	key, model, err := newTestKeyStore(repo, "").Create(context.Background(), db.APIKeyModel{Name: "clinic", Scopes: []string{ScopeSearch}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, keyPrefix+model.KeyID+"_") {
+		t.Errorf("key %q does not carry its ID %q", key, model.KeyID)
+	}
+	stored := repo.keys[model.KeyID]
+	if stored.SecretHash != hashKey(key) || strings.Contains(stored.SecretHash, key) {
+		t.Errorf("stored hash %q is not the hash of the key", stored.SecretHash)
+	}
+}
+
+func TestCreateRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		model db.APIKeyModel
+	}{
+		{"no name", db.APIKeyModel{Scopes: []string{ScopeSearch}}},
+		{"no scopes", db.APIKeyModel{Name: "clinic"}},
+		{"unknown scope", db.APIKeyModel{Name: "clinic", Scopes: []string{"write"}}},
+		{"expired", db.APIKeyModel{Name: "clinic", Scopes: []string{ScopeSearch}, ExpiresAt: time.Now().Add(-time.Hour)}},
+		{"negative quota", db.APIKeyModel{Name: "clinic", Scopes: []string{ScopeSearch}, DailyQuota: -2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeKeyRepo()
+			if _, _, err := newTestKeyStore(repo, "").Create(context.Background(), tt.model); err == nil {
+				t.Error("Create succeeded")
+			}
+			if len(repo.keys) != 0 {
+				t.Error("rejected key was stored")
+			}
+		})
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeKeyRepo()
+	store := newTestKeyStore(repo, "")
+	key, model, err := store.Create(ctx, db.APIKeyModel{Name: "clinic", Scopes: []string{ScopeSearch}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Authenticate(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Revoke(ctx, model.KeyID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Authenticate(ctx, key); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("revoked key on the revoking replica = %v, want ErrInvalidKey", err)
+	}
+	if !repo.keys[model.KeyID].Disabled {
+		t.Error("revoked record is not disabled")
+	}
+}
+
+func TestRevokeStaleCacheOnOtherReplica(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeKeyRepo()
+	revoking, other := newTestKeyStore(repo, ""), newTestKeyStore(repo, "")
+	key, model, err := revoking.Create(ctx, db.APIKeyModel{Name: "clinic", Scopes: []string{ScopeSearch}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Authenticate(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := revoking.Revoke(ctx, model.KeyID); err != nil {
+		t.Fatal(err)
+	}
+
+	// The other replica serves its cached record until keyCacheTTL passes.
+	reads := repo.reads
+	if _, err := other.Authenticate(ctx, key); err != nil {
+		t.Errorf("cached key within keyCacheTTL = %v, want accepted", err)
+	}
+	if repo.reads != reads {
+		t.Error("cached key was read again within keyCacheTTL")
+	}
+
+	other.mu.Lock()
+	c := other.cache[model.KeyID]
+	c.fetchedAt = time.Now().Add(-keyCacheTTL)
+	other.cache[model.KeyID] = c
+	other.mu.Unlock()
+	if _, err := other.Authenticate(ctx, key); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("stale cache entry after keyCacheTTL = %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestLookupDoesNotCacheMisses(t *testing.T) {
+	store := newTestKeyStore(newFakeKeyRepo(), "")
+	for range 3 {
+		_, _ = store.Authenticate(context.Background(), "mrk_000000000000_secret")
+	}
+	if len(store.cache) != 0 {
+		t.Errorf("cache holds %d entries for unknown keys", len(store.cache))
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	tests := []struct {
+		scopes []string
+		scope  string
+		want   bool
+	}{
+		{[]string{ScopeSearch}, ScopeSearch, true},
+		{[]string{ScopeSearch}, ScopeDocumentsRead, false},
+		{[]string{ScopeSearch, ScopeDocumentsRead}, ScopeDocumentsRead, true},
+		{[]string{ScopeAdmin}, ScopeCases, true},
+		{[]string{ScopeAdmin}, ScopeAdmin, true},
+		{[]string{ScopeCases}, ScopeAdmin, false},
+		{nil, ScopeSearch, false},
+	}
+	for _, tt := range tests {
+		p := &Principal{Scopes: tt.scopes}
+		if got := p.HasScope(tt.scope); got != tt.want {
+			t.Errorf("%v HasScope(%s) = %v, want %v", tt.scopes, tt.scope, got, tt.want)
+		}
+	}
+}
+
+func TestEffectiveScopes(t *testing.T) {
+	admin := (&Principal{Scopes: []string{ScopeAdmin}}).EffectiveScopes()
+	if len(admin) != len(KnownScopes) {
+		t.Errorf("admin effective scopes = %v, want %v", admin, KnownScopes)
+	}
+	admin[0] = "changed"
+	if KnownScopes[0] == "changed" {
+		t.Error("EffectiveScopes returned KnownScopes itself")
+	}
+	if got := (&Principal{Scopes: []string{ScopeSearch}}).EffectiveScopes(); len(got) != 1 || got[0] != ScopeSearch {
+		t.Errorf("search effective scopes = %v", got)
+	}
+}
+
+// TestDecodeStoredKey decodes a record as odm writes it, with createdOn in
+// Unix seconds.
+func TestDecodeStoredKey(t *testing.T) {
+	raw, err := bson.Marshal(bson.M{
+		"_id":        "3f9a1c07b2de",
+		"secretHash": hashKey("mrk_3f9a1c07b2de_secret"),
+		"name":       "clinic",
+		"scopes":     bson.A{ScopeSearch},
+		"disabled":   false,
+		"createdOn":  int64(1760000000),
+		"updatedOn":  int64(1760000000),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var model db.APIKeyModel
+	if err := bson.Unmarshal(raw, &model); err != nil {
+		t.Fatalf("decoding a stored key: %v", err)
+	}
+	if model.CreatedOn != 1760000000 || model.KeyID != "3f9a1c07b2de" {
+		t.Errorf("decoded %+v", model)
+	}
+}
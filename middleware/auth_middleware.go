@@ -1,78 +1,219 @@
 package middleware
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
-	"os"
 	"strings"
+	"time"
 
 	"github.com/SaiNageswarS/go-api-boot/logger"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/audit"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/tenant"
+	"github.com/modelcontextprotocol/go-sdk/auth"
 	"go.uber.org/zap"
 )
 
-// APIKeyAuthMiddleware validates API key from Authorization header or X-API-Key header.
-// Requests with a valid Mcp-Session-Id are allowed through without an API key,
-// since the session was already authenticated during the initialize handshake.
-func APIKeyAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+// principalExtraKey holds the *Principal in auth.TokenInfo.Extra, which is how
+// MCP handlers see the caller (via CallToolRequest.Extra.TokenInfo).
+const principalExtraKey = "principal"
+
+// APIKeyAuth authenticates requests against the APIKeyStore, enforces scopes,
+// resolves the tenant, applies the rate limiter and records REST requests in
+// the audit log. When an OAuthVerifier is configured, /mcp also accepts JWT
+// access tokens.
+type APIKeyAuth struct {
+	store   *APIKeyStore
+	oauth   *OAuthVerifier // nil: API keys only
+	limiter *RateLimiter   // nil: no limits
+	tenants *tenant.Registry
+	audit   *audit.Log // nil: not audited
+}
+
+func ProvideAPIKeyAuth(store *APIKeyStore, oauth *OAuthVerifier, limiter *RateLimiter, tenants *tenant.Registry, auditLog *audit.Log) *APIKeyAuth {
+	return &APIKeyAuth{store: store, oauth: oauth, limiter: limiter, tenants: tenants, audit: auditLog}
+}
+
+// Require validates the API key from the Authorization header, X-API-Key header
+// or api_key query parameter, checks that it grants scope and may read the
+// requested tenant, applies the rate limit of the scope's route class, and
+// stores the Principal and Tenant in the request context. Every request with a
+// valid key is audited, including those refused here.
+func (a *APIKeyAuth) Require(scope string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// If the request already carries a session ID, the client was authenticated
-		// during the MCP initialize call. The MCP framework validates the session
-		// ID itself, so we can skip API key checks here.
-		if r.Header.Get("Mcp-Session-Id") != "" {
-			next(w, r)
+		principal, status, msg := a.authenticate(r)
+		if principal == nil {
+			http.Error(w, msg, status)
 			return
 		}
 
-		apiKey := os.Getenv("API_KEY")
-		if apiKey == "" {
-			logger.Error("API_KEY environment variable is not set")
-			http.Error(w, "Server configuration error", http.StatusInternalServerError)
-			return
+		ctx, call := a.audit.Start(r.Context(), audit.ChannelREST, r.Method+" "+routePattern(r), principal.KeyID, principal.Name)
+		for name, values := range r.URL.Query() {
+			if name != "api_key" {
+				call.SetArg(name, values[0])
+			}
 		}
+		sw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() { call.Finish(sw.status, nil) }()
+		w, r = sw, r.WithContext(ctx)
 
-		// Check for API key in Authorization header (Bearer token), X-API-Key header, or query parameter
-		authHeader := r.Header.Get("Authorization")
-		apiKeyHeader := r.Header.Get("X-API-Key")
-		queryKey := r.URL.Query().Get("api_key")
-
-		var providedKey string
-		if authHeader != "" {
-			// Extract token from "Bearer <token>" format
-			parts := strings.Split(authHeader, " ")
-			if len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" {
-				providedKey = parts[1]
-			} else if len(parts) == 1 {
-				// If no Bearer prefix, use the whole header value
-				providedKey = parts[0]
-			}
-		} else if apiKeyHeader != "" {
-			providedKey = apiKeyHeader
-		} else if queryKey != "" {
-			providedKey = queryKey
+		if !principal.HasScope(scope) {
+			logger.Error("API key lacks scope", zap.String("path", r.URL.Path), zap.String("keyId", principal.KeyID), zap.String("scope", scope))
+			http.Error(w, "API key does not grant the "+scope+" scope", http.StatusForbidden)
+			return
 		}
 
-		if providedKey == "" {
-			logger.Error("API key missing from request", zap.String("path", r.URL.Path))
-			http.Error(w, "API key required. Provide it in Authorization header (Bearer <key>) or X-API-Key header", http.StatusUnauthorized)
+		t, err := a.tenants.Resolve(tenant.Requested(r.Context()), principal.Tenant, principal.HasScope(ScopeAdmin))
+		if errors.Is(err, tenant.ErrTenantMismatch) {
+			logger.Error("API key used for another tenant", zap.String("path", r.URL.Path), zap.String("keyId", principal.KeyID), zap.String("tenant", principal.Tenant))
+			http.Error(w, "API key is not valid for this tenant", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Unknown tenant", http.StatusNotFound)
 			return
 		}
+		call.SetTenant(t.ID)
 
-		if providedKey != apiKey {
-			logger.Error("Invalid API key provided", zap.String("path", r.URL.Path))
-			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+		if !a.limiter.limit(w, r, principal, scope) {
 			return
 		}
 
-		// API key is valid, proceed to next handler
-		next(w, r)
+		ctx = tenant.WithTenant(WithPrincipal(ctx, principal), t)
+		next(w, r.WithContext(ctx))
 	}
 }
 
-// APIKeyAuthHandler wraps an http.Handler with the same API key validation.
-// Suitable for use with WithMCPMiddleware and similar handler-level middleware.
-func APIKeyAuthHandler(next http.Handler) http.Handler {
+// routePattern returns the pattern of the matched route without the tenant
+// prefix, e.g. "/documents/{id}/content".
+func routePattern(r *http.Request) string {
+	if r.Pattern == "" {
+		return r.URL.Path
+	}
+	return strings.TrimPrefix(r.Pattern, tenant.PathPrefix+"{tenant}")
+}
+
+// statusRecorder remembers the status written, for the audit log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// MCPHandler is the WithMCPMiddleware counterpart of Require. The key is passed
+// on as an auth.TokenInfo so MCP handlers can see the principal. Rate limits
+// apply to tool calls only, in PageIndexMcp, not to every HTTP request.
+// Every request is authenticated, including those of an established session:
+// the key ID becomes TokenInfo.UserID, and the streamable handler rejects a
+// session ID presented with any key other than the one that initialized it.
+// With OAuth enabled, 401s carry a WWW-Authenticate challenge pointing at the
+// protected resource metadata so clients can discover the authorization server.
+func (a *APIKeyAuth) MCPHandler(next http.Handler) http.Handler {
+	opts := &auth.RequireBearerTokenOptions{Scopes: []string{ScopeDocumentsRead}}
+	if a.oauth != nil {
+		opts.ResourceMetadataURL = a.oauth.MetadataURL()
+	}
+	bearer := auth.RequireBearerToken(a.verifyToken, opts)(next)
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		APIKeyAuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
-			next.ServeHTTP(w, r)
-		})(w, r)
+		key := providedKey(r)
+		if key == "" {
+			logger.Error("API key missing from request", zap.String("path", r.URL.Path))
+			if a.oauth != nil {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer resource_metadata=%q, scope=%q", opts.ResourceMetadataURL, ScopeDocumentsRead))
+			}
+			http.Error(w, "API key required. Provide it in Authorization header (Bearer <key>) or X-API-Key header", http.StatusUnauthorized)
+			return
+		}
+
+		// RequireBearerToken only reads the Authorization header.
+		r = r.Clone(r.Context())
+		r.Header.Set("Authorization", "Bearer "+key)
+		bearer.ServeHTTP(w, r)
 	})
 }
+
+func (a *APIKeyAuth) verifyToken(ctx context.Context, token string, r *http.Request) (*auth.TokenInfo, error) {
+	var principal *Principal
+	var err error
+	if a.oauth != nil && looksLikeJWT(token) {
+		principal, err = a.oauth.Verify(ctx, token)
+	} else {
+		principal, err = a.store.Authenticate(ctx, token)
+	}
+	if errors.Is(err, ErrInvalidKey) {
+		logger.Error("Invalid bearer token provided", zap.String("path", r.URL.Path), zap.Error(err))
+		return nil, auth.ErrInvalidToken
+	}
+	if err != nil {
+		logger.Error("Failed to authenticate bearer token", zap.Error(err))
+		return nil, err
+	}
+
+	// TokenInfo requires an expiry; keys without one are valid for this request.
+	expiration := principal.ExpiresAt
+	if expiration.IsZero() {
+		expiration = time.Now().Add(time.Hour)
+	}
+
+	return &auth.TokenInfo{
+		Scopes:     principal.EffectiveScopes(),
+		Expiration: expiration,
+		UserID:     principal.KeyID,
+		Extra:      map[string]any{principalExtraKey: principal},
+	}, nil
+}
+
+// PrincipalFromTokenInfo returns the principal carried by an MCP request's TokenInfo.
+func PrincipalFromTokenInfo(ti *auth.TokenInfo) (*Principal, bool) {
+	if ti == nil {
+		return nil, false
+	}
+	p, ok := ti.Extra[principalExtraKey].(*Principal)
+	return p, ok
+}
+
+// authenticate returns the principal, or the status and message to reply with.
+func (a *APIKeyAuth) authenticate(r *http.Request) (*Principal, int, string) {
+	key := providedKey(r)
+	if key == "" {
+		logger.Error("API key missing from request", zap.String("path", r.URL.Path))
+		return nil, http.StatusUnauthorized, "API key required. Provide it in Authorization header (Bearer <key>) or X-API-Key header"
+	}
+
+	principal, err := a.store.Authenticate(r.Context(), key)
+	if errors.Is(err, ErrInvalidKey) {
+		logger.Error("Invalid API key provided", zap.String("path", r.URL.Path))
+		return nil, http.StatusUnauthorized, "Invalid API key"
+	}
+	if err != nil {
+		logger.Error("Failed to authenticate API key", zap.Error(err))
+		return nil, http.StatusInternalServerError, "Failed to authenticate API key"
+	}
+	return principal, 0, ""
+}
+
+// providedKey extracts the API key from the Authorization header (Bearer token),
+// X-API-Key header, or api_key query parameter.
+func providedKey(r *http.Request) string {
+	if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+		// Extract token from "Bearer <token>" format
+		parts := strings.Split(authHeader, " ")
+		if len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" {
+			return parts[1]
+		} else if len(parts) == 1 {
+			// If no Bearer prefix, use the whole header value
+			return parts[0]
+		}
+		return ""
+	}
+	if apiKeyHeader := r.Header.Get("X-API-Key"); apiKeyHeader != "" {
+		return apiKeyHeader
+	}
+	return r.URL.Query().Get("api_key")
+}
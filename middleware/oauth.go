@@ -0,0 +1,341 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math/big"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SaiNageswarS/go-api-boot/logger"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/appconfig"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/modelcontextprotocol/go-sdk/oauthex"
+	"go.uber.org/zap"
+)
+
+// ProtectedResourcePath serves the RFC 9728 metadata that points MCP clients
+// at the authorization server.
+const ProtectedResourcePath = "/.well-known/oauth-protected-resource"
+
+// oauthKeyIDPrefix keeps OAuth subjects apart from API key IDs in session
+// ownership and logs.
+const oauthKeyIDPrefix = "oauth:"
+
+// signingMethods are the JWT algorithms accepted; symmetric ones are not, as
+// the JWKS holds public keys only.
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// OAuthVerifier validates JWT access tokens issued by an external
+// authorization server, making the MCP endpoint an OAuth 2.1 resource server.
+// Signing keys come from a JWKS file, re-read when it changes so keys can be
+// rotated without a restart.
+type OAuthVerifier struct {
+	issuer   string
+	audience string
+	jwksFile string
+	scopeMap map[string]string // token scope -> our scope
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	modTime time.Time
+}
+
+// ProvideOAuthVerifier returns nil when oauth_issuer is not configured.
+func ProvideOAuthVerifier(ccfg *appconfig.AppConfig) (*OAuthVerifier, error) {
+	if ccfg.OAuthIssuer == "" {
+		return nil, nil
+	}
+	if ccfg.OAuthJWKSFile == "" {
+		return nil, errors.New("oauth_jwks_file is required with oauth_issuer")
+	}
+
+	scopeMap, err := parseScopeMap(ccfg.OAuthScopeMap)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &OAuthVerifier{
+		issuer:   ccfg.OAuthIssuer,
+		audience: OAuthAudience(ccfg),
+		jwksFile: ccfg.OAuthJWKSFile,
+		scopeMap: scopeMap,
+	}
+	if _, err := v.signingKeys(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// OAuthAudience is the aud access tokens must carry: oauth_audience, or the
+// public URL of the MCP endpoint.
+func OAuthAudience(ccfg *appconfig.AppConfig) string {
+	if ccfg.OAuthAudience != "" {
+		return ccfg.OAuthAudience
+	}
+	return strings.TrimSuffix(ccfg.PublicURL, "/") + "/mcp"
+}
+
+// Metadata describes this resource for /.well-known/oauth-protected-resource.
+func (v *OAuthVerifier) Metadata() *oauthex.ProtectedResourceMetadata {
+	return &oauthex.ProtectedResourceMetadata{
+		Resource:                          v.audience,
+		AuthorizationServers:              []string{v.issuer},
+		ScopesSupported:                   slices.Sorted(maps.Keys(v.scopeMap)),
+		BearerMethodsSupported:            []string{"header"},
+		ResourceSigningAlgValuesSupported: signingMethods,
+		ResourceName:                      "Medicine RAG MCP",
+	}
+}
+
+// MetadataURL is the absolute URL of the metadata document, sent in
+// WWW-Authenticate challenges. Per RFC 9728 the well-known segment goes
+// between the host and the resource path.
+func (v *OAuthVerifier) MetadataURL() string {
+	u, err := url.Parse(v.audience)
+	if err != nil {
+		return ProtectedResourcePath
+	}
+	u.Path = ProtectedResourcePath + strings.TrimSuffix(u.Path, "/")
+	u.RawPath, u.RawQuery, u.Fragment = "", "", ""
+	return u.String()
+}
+
+// Verify validates token and maps its claims to a principal. A tenant claim
+// binds the token to that tenant, like an API key's tenant.
+func (v *OAuthVerifier) Verify(ctx context.Context, token string) (*Principal, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, v.keyFunc,
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(v.issuer),
+		jwt.WithAudience(v.audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30*time.Second),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+
+	sub, _ := claims.GetSubject()
+	if sub == "" {
+		return nil, fmt.Errorf("%w: token has no subject", ErrInvalidKey)
+	}
+	exp, _ := claims.GetExpirationTime()
+
+	tenantID, _ := claims["tenant"].(string)
+
+	name := sub
+	if clientID, ok := claims["client_id"].(string); ok && clientID != "" {
+		name = clientID
+	}
+
+	return &Principal{
+		KeyID:     oauthKeyIDPrefix + sub,
+		Name:      name,
+		Scopes:    v.mapScopes(claims),
+		ExpiresAt: exp.Time,
+		Tenant:    tenantID,
+	}, nil
+}
+
+// mapScopes reads the scope (RFC 9068, space separated) or scp claim and keeps
+// the scopes that map to ours.
+func (v *OAuthVerifier) mapScopes(claims jwt.MapClaims) []string {
+	var granted []string
+	if scp, ok := claims["scope"].(string); ok {
+		granted = strings.Fields(scp)
+	}
+	switch scp := claims["scp"].(type) {
+	case string:
+		granted = append(granted, strings.Fields(scp)...)
+	case []any:
+		for _, s := range scp {
+			if s, ok := s.(string); ok {
+				granted = append(granted, s)
+			}
+		}
+	}
+
+	scopes := []string{}
+	for _, s := range granted {
+		if ours, ok := v.scopeMap[s]; ok && !slices.Contains(scopes, ours) {
+			scopes = append(scopes, ours)
+		}
+	}
+	return scopes
+}
+
+func (v *OAuthVerifier) keyFunc(t *jwt.Token) (any, error) {
+	keys, err := v.signingKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	kid, _ := t.Header["kid"].(string)
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	// A JWKS with a single key may omit kid, and so may its tokens.
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// signingKeys returns the keys of the JWKS file, reloading it when modified.
+func (v *OAuthVerifier) signingKeys() (map[string]crypto.PublicKey, error) {
+	info, err := os.Stat(v.jwksFile)
+	if err != nil {
+		return nil, fmt.Errorf("read JWKS: %w", err)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.keys != nil && info.ModTime().Equal(v.modTime) {
+		return v.keys, nil
+	}
+
+	data, err := os.ReadFile(v.jwksFile)
+	if err != nil {
+		return nil, fmt.Errorf("read JWKS: %w", err)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse JWKS %s: %w", v.jwksFile, err)
+	}
+
+	logger.Info("Loaded OAuth signing keys", zap.String("file", v.jwksFile), zap.Int("keys", len(keys)))
+	v.keys, v.modTime = keys, info.ModTime()
+	return keys, nil
+}
+
+// JWK is a public JSON Web Key (RFC 7517) of type RSA, EC or OKP (Ed25519).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set JWKS
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys")
+	}
+	return keys, nil
+}
+
+func (k JWK) publicKey() (crypto.PublicKey, error) {
+	b64 := base64.RawURLEncoding
+	switch k.Kty {
+	case "RSA":
+		n, err := b64.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := b64.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return ecdsa.ParseUncompressedPublicKey(curve, append(append([]byte{4}, x...), y...))
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := b64.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// parseScopeMap reads oauth_scope_map, "ext=ours,ext2=ours2". Only the token
+// scopes it lists are granted; our own names are not taken as is, since the
+// issuer may use them for other things. A bare admin scope never maps to
+// admin.
+func parseScopeMap(s string) (map[string]string, error) {
+	m := map[string]string{}
+	for pair := range strings.SplitSeq(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		ext, ours, ok := strings.Cut(pair, "=")
+		ext, ours = strings.TrimSpace(ext), strings.TrimSpace(ours)
+		if !ok || ext == "" || !slices.Contains(KnownScopes, ours) {
+			return nil, fmt.Errorf("invalid oauth_scope_map entry %q", pair)
+		}
+		if ext == ScopeAdmin && ours == ScopeAdmin {
+			return nil, errors.New("oauth_scope_map must not map admin to admin; map the issuer's own admin scope")
+		}
+		m[ext] = ours
+	}
+	return m, nil
+}
+
+// looksLikeJWT tells access tokens apart from API keys.
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2 && !strings.HasPrefix(token, keyPrefix)
+}
@@ -0,0 +1,305 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/appconfig"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://issuer.example"
+	testAudience = "https://api.example/mcp"
+	testKid      = "test-key"
+)
+
+// testIssuerKeys is a local key pair whose JWKS the verifier trusts.
+type testIssuerKeys struct {
+	private  ed25519.PrivateKey
+	jwksFile string
+}
+
+func newTestIssuerKeys(t *testing.T) *testIssuerKeys {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, err := json.Marshal(JWKS{Keys: []JWK{{
+		Kty: "OKP", Crv: "Ed25519", Kid: testKid, Use: "sig", Alg: "EdDSA",
+		X: base64.RawURLEncoding.EncodeToString(pub),
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(file, jwks, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return &testIssuerKeys{private: priv, jwksFile: file}
+}
+
+func (k *testIssuerKeys) verifier(t *testing.T, scopeMap string) *OAuthVerifier {
+	t.Helper()
+	v, err := ProvideOAuthVerifier(&appconfig.AppConfig{
+		OAuthIssuer:   testIssuer,
+		OAuthAudience: testAudience,
+		OAuthJWKSFile: k.jwksFile,
+		OAuthScopeMap: scopeMap,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// validClaims are claims the verifier accepts; tests change one at a time.
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":   testIssuer,
+		"aud":   testAudience,
+		"sub":   "alice",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "mcp:read",
+	}
+}
+
+func sign(t *testing.T, key ed25519.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestVerify(t *testing.T) {
+	keys := newTestIssuerKeys(t)
+	v := keys.verifier(t, "mcp:read=documents:read")
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	with := func(change func(jwt.MapClaims)) jwt.MapClaims {
+		c := validClaims()
+		change(c)
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"valid", sign(t, keys.private, testKid, validClaims()), true},
+		{"single key without kid", sign(t, keys.private, "", validClaims()), true},
+		{"bad signature", sign(t, otherKey, testKid, validClaims()), false},
+		{"tampered payload", tamper(t, sign(t, keys.private, testKid, validClaims())), false},
+		{"wrong issuer", sign(t, keys.private, testKid, with(func(c jwt.MapClaims) { c["iss"] = "https://evil.example" })), false},
+		{"wrong audience", sign(t, keys.private, testKid, with(func(c jwt.MapClaims) { c["aud"] = "https://api.example/other" })), false},
+		{"audience list", sign(t, keys.private, testKid, with(func(c jwt.MapClaims) { c["aud"] = []string{"x", testAudience} })), true},
+		{"expired", sign(t, keys.private, testKid, with(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() })), false},
+		{"expired within leeway", sign(t, keys.private, testKid, with(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-10 * time.Second).Unix() })), true},
+		{"no expiry", sign(t, keys.private, testKid, with(func(c jwt.MapClaims) { delete(c, "exp") })), false},
+		{"missing sub", sign(t, keys.private, testKid, with(func(c jwt.MapClaims) { delete(c, "sub") })), false},
+		{"unknown kid", sign(t, keys.private, "rotated-away", validClaims()), false},
+		{"unsigned", unsigned(t, validClaims()), false},
+		{"not a JWT", "mrk_3f9a1c07b2de_secret", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := v.Verify(context.Background(), tt.token)
+			if tt.ok {
+				if err != nil {
+					t.Fatalf("Verify = %v, want accepted", err)
+				}
+				if p.KeyID != oauthKeyIDPrefix+"alice" {
+					t.Errorf("KeyID = %q", p.KeyID)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("Verify = %v, want ErrInvalidKey", err)
+			}
+		})
+	}
+}
+
+// tamper swaps the payload of token for one granting admin, keeping the
+// signature.
+func tamper(t *testing.T, token string) string {
+	t.Helper()
+	c := validClaims()
+	c["scope"] = "admin"
+	payload, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+	return parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+}
+
+func unsigned(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestVerifyClaims(t *testing.T) {
+	keys := newTestIssuerKeys(t)
+	v := keys.verifier(t, "mcp:read=documents:read")
+
+	c := validClaims()
+	c["client_id"] = "claude-desktop"
+	c["tenant"] = "otherclinic"
+	p, err := v.Verify(context.Background(), sign(t, keys.private, testKid, c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "claude-desktop" || p.Tenant != "otherclinic" || p.ExpiresAt.IsZero() {
+		t.Errorf("principal = %+v", p)
+	}
+}
+
+func TestVerifyScopeMapping(t *testing.T) {
+	keys := newTestIssuerKeys(t)
+	v := keys.verifier(t, "mcp:read=documents:read, mcp:search=search, search=search, clinic:admin=admin")
+
+	tests := []struct {
+		name  string
+		claim func(jwt.MapClaims)
+		want  []string
+	}{
+		{"scope claim", func(c jwt.MapClaims) { c["scope"] = "mcp:read mcp:search" }, []string{ScopeDocumentsRead, ScopeSearch}},
+		{"scp string", func(c jwt.MapClaims) { delete(c, "scope"); c["scp"] = "mcp:search" }, []string{ScopeSearch}},
+		{"scp list", func(c jwt.MapClaims) { delete(c, "scope"); c["scp"] = []string{"mcp:read", "clinic:admin"} }, []string{ScopeDocumentsRead, ScopeAdmin}},
+		{"unmapped dropped", func(c jwt.MapClaims) { c["scope"] = "openid profile mcp:read" }, []string{ScopeDocumentsRead}},
+		{"own name mapped explicitly", func(c jwt.MapClaims) { c["scope"] = "search" }, []string{ScopeSearch}},
+		{"own name not mapped", func(c jwt.MapClaims) { c["scope"] = "documents:read cases" }, []string{}},
+		{"literal admin", func(c jwt.MapClaims) { c["scope"] = "admin" }, []string{}},
+		{"duplicates", func(c jwt.MapClaims) { c["scope"] = "mcp:search search" }, []string{ScopeSearch}},
+		{"no scopes", func(c jwt.MapClaims) { delete(c, "scope") }, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validClaims()
+			tt.claim(c)
+			p, err := v.Verify(context.Background(), sign(t, keys.private, testKid, c))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(p.Scopes, tt.want) {
+				t.Errorf("scopes = %v, want %v", p.Scopes, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyWithoutScopeMap(t *testing.T) {
+	keys := newTestIssuerKeys(t)
+	v := keys.verifier(t, "")
+	c := validClaims()
+	c["scope"] = "admin search documents:read cases"
+	p, err := v.Verify(context.Background(), sign(t, keys.private, testKid, c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Scopes) != 0 {
+		t.Errorf("scopes without oauth_scope_map = %v, want none", p.Scopes)
+	}
+}
+
+func TestParseScopeMap(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"", map[string]string{}, false},
+		{"mcp:read=documents:read", map[string]string{"mcp:read": ScopeDocumentsRead}, false},
+		{" a = search , b=cases,", map[string]string{"a": ScopeSearch, "b": ScopeCases}, false},
+		{"clinic:admin=admin", map[string]string{"clinic:admin": ScopeAdmin}, false},
+		{"admin=admin", nil, true},
+		{"mcp:write=write", nil, true},
+		{"mcp:read", nil, true},
+		{"=search", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseScopeMap(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseScopeMap(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !maps.Equal(got, tt.want) {
+			t.Errorf("parseScopeMap(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyReloadsRotatedKeys(t *testing.T) {
+	keys := newTestIssuerKeys(t)
+	v := keys.verifier(t, "mcp:read=documents:read")
+	old := sign(t, keys.private, testKid, validClaims())
+
+	rotated := newTestIssuerKeys(t)
+	data, err := os.ReadFile(rotated.jwksFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keys.jwksFile, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(keys.jwksFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := v.Verify(context.Background(), old); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("token of a rotated-away key = %v, want ErrInvalidKey", err)
+	}
+	if _, err := v.Verify(context.Background(), sign(t, rotated.private, testKid, validClaims())); err != nil {
+		t.Errorf("token of the new key = %v", err)
+	}
+}
+
+func TestProvideOAuthVerifierDisabled(t *testing.T) {
+	v, err := ProvideOAuthVerifier(&appconfig.AppConfig{})
+	if v != nil || err != nil {
+		t.Errorf("without oauth_issuer = %v, %v; want nil, nil", v, err)
+	}
+	if _, err := ProvideOAuthVerifier(&appconfig.AppConfig{OAuthIssuer: testIssuer}); err == nil {
+		t.Error("oauth_issuer without oauth_jwks_file was accepted")
+	}
+}
+
+func TestLooksLikeJWT(t *testing.T) {
+	tests := map[string]bool{
+		"eyJh.eyJz.c2ln":          true,
+		"mrk_3f9a1c07b2de_a.b.c":  false,
+		"mrk_3f9a1c07b2de_secret": false,
+		"plain-env-key":           false,
+		"a.b":                     false,
+	}
+	for token, want := range tests {
+		if got := looksLikeJWT(token); got != want {
+			t.Errorf("looksLikeJWT(%q) = %v, want %v", token, got, want)
+		}
+	}
+}
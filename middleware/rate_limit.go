@@ -0,0 +1,376 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SaiNageswarS/go-api-boot/logger"
+	"github.com/SaiNageswarS/go-api-boot/odm"
+	"github.com/SaiNageswarS/go-collection-boot/async"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/appconfig"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// Defaults, in requests per minute per key, for routes requiring each scope.
+	// Search embeds the query and runs two Atlas searches, so it gets the least.
+	defaultSearchPerMinute = 30
+	defaultReadPerMinute   = 120
+	defaultCasesPerMinute  = 60
+	defaultAdminPerMinute  = 60
+
+	// quotaSyncInterval is how often usage counts are written to and re-read
+	// from api_usage. Between syncs, other replicas' requests are not seen.
+	quotaSyncInterval = 10 * time.Second
+
+	// bucketIdleTimeout drops the bucket of a key unused for this long; a fresh
+	// bucket starts full, which is the state an idle one would be in anyway.
+	bucketIdleTimeout = 10 * time.Minute
+)
+
+// LimitResult is the outcome of RateLimiter.Allow, reported in X-RateLimit-*
+// headers.
+type LimitResult struct {
+	Allowed    bool
+	Reason     string        // why a request was refused
+	RetryAfter time.Duration // when refused
+
+	Limit     int           // requests per minute for the route class; 0: unlimited
+	Remaining int           // requests left in the bucket
+	Reset     time.Duration // until the bucket is full again
+
+	QuotaLimit     int // requests per UTC day; 0: unlimited
+	QuotaRemaining int
+}
+
+// RateLimiter applies a token bucket per API key and route class, plus a daily
+// quota per key. The route class is the scope the route requires, so /search
+// is limited separately from (and more tightly than) document reads. Buckets
+// live in memory on each replica; daily counts are shared through Mongo.
+type RateLimiter struct {
+	perMinute  map[string]int
+	dailyQuota int
+
+	mu        sync.Mutex
+	buckets   map[bucketKey]*bucket
+	lastSweep time.Time
+
+	quota *quotaCounter
+}
+
+type bucketKey struct {
+	keyID string
+	class string
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+func ProvideRateLimiter(ccfg *appconfig.AppConfig, mongo odm.MongoClient) *RateLimiter {
+	perMinute := map[string]int{
+		ScopeSearch:        orDefault(ccfg.RateLimitSearch, defaultSearchPerMinute),
+		ScopeDocumentsRead: orDefault(ccfg.RateLimitDocumentsRead, defaultReadPerMinute),
+		ScopeCases:         orDefault(ccfg.RateLimitCases, defaultCasesPerMinute),
+		ScopeAdmin:         orDefault(ccfg.RateLimitAdmin, defaultAdminPerMinute),
+	}
+	return &RateLimiter{
+		perMinute:  perMinute,
+		dailyQuota: ccfg.DailyQuota,
+		buckets:    map[bucketKey]*bucket{},
+		quota:      newQuotaCounter(mongo, ccfg.ControlDB()),
+	}
+}
+
+// orDefault treats 0 as unset and a negative value as unlimited (0).
+func orDefault(v, def int) int {
+	switch {
+	case v == 0:
+		return def
+	case v < 0:
+		return 0
+	}
+	return v
+}
+
+// Allow takes one request for the principal in class from its bucket and daily
+// quota. A refused request consumes neither.
+func (l *RateLimiter) Allow(ctx context.Context, p *Principal, class string) LimitResult {
+	return l.allowAt(ctx, p, class, time.Now())
+}
+
+func (l *RateLimiter) allowAt(ctx context.Context, p *Principal, class string, now time.Time) LimitResult {
+	res := LimitResult{Allowed: true, Limit: l.perMinute[class]}
+
+	res.QuotaLimit = l.dailyQuota
+	if p.DailyQuota != 0 {
+		res.QuotaLimit = max(p.DailyQuota, 0)
+	}
+	if res.QuotaLimit > 0 {
+		// Taken before the bucket is tried and given back if it refuses, so
+		// that concurrent requests cannot all pass the check before counting.
+		used, ok := l.quota.take(ctx, p.KeyID, int64(res.QuotaLimit), now)
+		res.QuotaRemaining = max(res.QuotaLimit-int(used), 0)
+		if !ok {
+			res.Allowed = false
+			res.Reason = "Daily quota exceeded"
+			res.RetryAfter = untilNextDay(now)
+			return res
+		}
+	}
+
+	if res.Limit > 0 {
+		limiter := l.bucket(p.KeyID, class, res.Limit, now)
+		reservation := limiter.ReserveN(now, 1)
+		if delay := reservation.DelayFrom(now); delay > 0 {
+			reservation.CancelAt(now)
+			res.Allowed = false
+			res.Reason = "Rate limit exceeded"
+			res.RetryAfter = delay
+		}
+		tokens := limiter.TokensAt(now)
+		res.Remaining = max(int(math.Floor(tokens)), 0)
+		res.Reset = time.Duration((float64(res.Limit) - tokens) / float64(limiter.Limit()) * float64(time.Second))
+		if !res.Allowed && res.QuotaLimit > 0 {
+			l.quota.release(p.KeyID, now)
+			res.QuotaRemaining++
+		}
+	}
+	return res
+}
+
+// bucket returns the key's bucket for class, which holds one minute's worth of
+// requests and refills continuously.
+func (l *RateLimiter) bucket(keyID, class string, perMinute int, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > bucketIdleTimeout {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastUsed) > bucketIdleTimeout {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	k := bucketKey{keyID: keyID, class: class}
+	b, ok := l.buckets[k]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(float64(perMinute)/60), perMinute)}
+		l.buckets[k] = b
+	}
+	b.lastUsed = now
+	return b.limiter
+}
+
+// WriteHeaders sets the X-RateLimit-* headers, and Retry-After when refused.
+func (r LimitResult) WriteHeaders(w http.ResponseWriter) {
+	h := w.Header()
+	if r.Limit > 0 {
+		h.Set("X-RateLimit-Limit", strconv.Itoa(r.Limit))
+		h.Set("X-RateLimit-Remaining", strconv.Itoa(r.Remaining))
+		h.Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(r.Reset)))
+	}
+	if r.QuotaLimit > 0 {
+		h.Set("X-RateLimit-Daily-Limit", strconv.Itoa(r.QuotaLimit))
+		h.Set("X-RateLimit-Daily-Remaining", strconv.Itoa(r.QuotaRemaining))
+	}
+	if !r.Allowed {
+		h.Set("Retry-After", strconv.Itoa(max(ceilSeconds(r.RetryAfter), 1)))
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+func untilNextDay(now time.Time) time.Duration {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC).Sub(now)
+}
+
+// quotaCounter keeps each key's request count for the day. Requests are
+// counted locally and added to api_usage every quotaSyncInterval, when the
+// total across replicas is read back.
+type quotaCounter struct {
+	coll *mongo.Collection
+	repo odm.OdmCollectionInterface[db.APIUsageModel]
+
+	mu       sync.Mutex
+	counts   map[string]*usageCount
+	lastSync time.Time
+	syncing  bool
+}
+
+type usageCount struct {
+	keyID   string
+	day     string
+	synced  int64 // total in api_usage at the last sync
+	pending int64 // counted here since
+}
+
+func newQuotaCounter(mongo odm.MongoClient, database string) *quotaCounter {
+	return &quotaCounter{
+		coll:   mongo.Database(database).Collection(db.APIUsageModel{}.CollectionName()),
+		repo:   odm.CollectionOf[db.APIUsageModel](mongo, database),
+		counts: map[string]*usageCount{},
+	}
+}
+
+// take counts one request of the key today unless limit have been counted
+// already, and returns the count including it. Check and count happen under
+// one lock, so concurrent requests cannot overshoot the limit on a replica.
+func (q *quotaCounter) take(ctx context.Context, keyID string, limit int64, now time.Time) (int64, bool) {
+	q.load(ctx, keyID, now)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	c := q.counts[usageID(keyID, now)]
+	if c.synced+c.pending >= limit {
+		return c.synced + c.pending, false
+	}
+	c.pending++
+	if !q.syncing && now.Sub(q.lastSync) >= quotaSyncInterval {
+		q.syncing = true
+		q.lastSync = now
+		go q.sync()
+	}
+	return c.synced + c.pending, true
+}
+
+// release gives back a request take counted, refused afterwards.
+func (q *quotaCounter) release(keyID string, now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if c, ok := q.counts[usageID(keyID, now)]; ok {
+		c.pending--
+	}
+}
+
+func usageID(keyID string, now time.Time) string {
+	return keyID + ":" + now.UTC().Format(time.DateOnly)
+}
+
+// load reads the key's count for today from Mongo on its first request on
+// this replica, so that a restart does not reset the quota.
+func (q *quotaCounter) load(ctx context.Context, keyID string, now time.Time) {
+	day := now.UTC().Format(time.DateOnly)
+	id := usageID(keyID, now)
+
+	q.mu.Lock()
+	_, ok := q.counts[id]
+	q.mu.Unlock()
+	if ok {
+		return
+	}
+
+	var synced int64
+	usage, err := async.Await(q.repo.FindOneByID(ctx, id))
+	if err == nil {
+		synced = usage.Count
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		logger.Error("Failed to read API usage", zap.String("keyId", keyID), zap.Error(err))
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.counts[id]; !ok {
+		q.counts[id] = &usageCount{keyID: keyID, day: day, synced: synced}
+	}
+}
+
+// sync adds the pending counts to api_usage and reads back the totals. Counts
+// of past days are dropped once written.
+func (q *quotaCounter) sync() {
+	ctx := context.Background()
+	today := time.Now().UTC().Format(time.DateOnly)
+
+	q.mu.Lock()
+	deltas := make(map[string]int64, len(q.counts))
+	for id, c := range q.counts {
+		deltas[id] = c.pending
+		c.pending = 0
+	}
+	q.mu.Unlock()
+
+	totals := map[string]int64{}
+	for id, delta := range deltas {
+		q.mu.Lock()
+		c := q.counts[id]
+		q.mu.Unlock()
+
+		var usage db.APIUsageModel
+		err := q.coll.FindOneAndUpdate(ctx,
+			bson.M{"_id": id},
+			bson.M{"$inc": bson.M{"count": delta}, "$setOnInsert": bson.M{"keyId": c.keyID, "day": c.day}},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&usage)
+		if err != nil {
+			logger.Error("Failed to sync API usage", zap.String("keyId", c.keyID), zap.Error(err))
+			// Keep the requests for the next sync.
+			q.mu.Lock()
+			c.pending += delta
+			q.mu.Unlock()
+			continue
+		}
+		totals[id] = usage.Count
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for id, total := range totals {
+		c := q.counts[id]
+		if c.day != today && c.pending == 0 {
+			delete(q.counts, id)
+			continue
+		}
+		c.synced = total
+	}
+	q.syncing = false
+}
+
+// limit applies the rate limiter to a request for class. It reports whether
+// the request may proceed, having written the 429 otherwise.
+func (l *RateLimiter) limit(w http.ResponseWriter, r *http.Request, p *Principal, class string) bool {
+	if l == nil {
+		return true
+	}
+
+	res := l.Allow(r.Context(), p, class)
+	res.WriteHeaders(w)
+	if !res.Allowed {
+		logger.Error("Request rate limited", zap.String("path", r.URL.Path), zap.String("keyId", p.KeyID), zap.String("class", class), zap.String("reason", res.Reason))
+		http.Error(w, res.Reason, http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// LimitTool is the MCP counterpart of limit: it takes one call of tool, in
+// class, for the principal. A refused call gets an error naming when to retry,
+// since a tool result carries no headers.
+func (l *RateLimiter) LimitTool(ctx context.Context, p *Principal, tool, class string) error {
+	if l == nil {
+		return nil
+	}
+
+	res := l.Allow(ctx, p, class)
+	if !res.Allowed {
+		logger.Error("Tool call rate limited", zap.String("tool", tool), zap.String("keyId", p.KeyID), zap.String("class", class), zap.String("reason", res.Reason))
+		return fmt.Errorf("%s; retry in %d seconds", res.Reason, max(ceilSeconds(res.RetryAfter), 1))
+	}
+	return nil
+}
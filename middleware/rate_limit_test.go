@@ -0,0 +1,264 @@
+package middleware
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SaiNageswarS/go-api-boot/odm"
+	"github.com/SaiNageswarS/go-collection-boot/async"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// fakeUsageRepo holds the api_usage counts other replicas synced.
+type fakeUsageRepo struct {
+	odm.OdmCollectionInterface[db.APIUsageModel]
+	counts map[string]int64
+}
+
+func (r *fakeUsageRepo) FindOneByID(ctx context.Context, id string) <-chan async.Result[*db.APIUsageModel] {
+	n, ok := r.counts[id]
+	return async.Go(func() (*db.APIUsageModel, error) {
+		if !ok {
+			return nil, mongo.ErrNoDocuments
+		}
+		return &db.APIUsageModel{ID: id, Count: n}, nil
+	})
+}
+
+// newTestLimiter limits search to searchPerMinute and documents:read to 120
+// per minute. Its quota counter never syncs, which needs Mongo.
+func newTestLimiter(searchPerMinute, dailyQuota int, synced map[string]int64) *RateLimiter {
+	return &RateLimiter{
+		perMinute:  map[string]int{ScopeSearch: searchPerMinute, ScopeDocumentsRead: 120},
+		dailyQuota: dailyQuota,
+		buckets:    map[bucketKey]*bucket{},
+		quota: &quotaCounter{
+			repo:    &fakeUsageRepo{counts: synced},
+			counts:  map[string]*usageCount{},
+			syncing: true,
+		},
+	}
+}
+
+var testNow = time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+func TestTokenBucket(t *testing.T) {
+	l := newTestLimiter(3, 0, nil)
+	ctx := context.Background()
+	alice := &Principal{KeyID: "alice"}
+
+	for i, want := range []int{2, 1, 0} {
+		res := l.allowAt(ctx, alice, ScopeSearch, testNow)
+		if !res.Allowed || res.Remaining != want {
+			t.Fatalf("request %d = %+v, want allowed with %d remaining", i+1, res, want)
+		}
+	}
+
+	res := l.allowAt(ctx, alice, ScopeSearch, testNow)
+	if res.Allowed || res.Reason != "Rate limit exceeded" {
+		t.Fatalf("request over the bucket = %+v, want refused", res)
+	}
+	if res.RetryAfter != 20*time.Second {
+		t.Errorf("RetryAfter = %v, want 20s for 3 per minute", res.RetryAfter)
+	}
+	if res.Reset != time.Minute {
+		t.Errorf("Reset = %v, want 1m", res.Reset)
+	}
+
+	if res := l.allowAt(ctx, alice, ScopeDocumentsRead, testNow); !res.Allowed {
+		t.Error("document read refused; classes have separate buckets")
+	}
+	if res := l.allowAt(ctx, &Principal{KeyID: "bob"}, ScopeSearch, testNow); !res.Allowed {
+		t.Error("other key refused; keys have separate buckets")
+	}
+
+	if res := l.allowAt(ctx, alice, ScopeSearch, testNow.Add(19*time.Second)); res.Allowed {
+		t.Error("allowed before a token was refilled")
+	}
+	if res := l.allowAt(ctx, alice, ScopeSearch, testNow.Add(20*time.Second)); !res.Allowed {
+		t.Errorf("refused after a token was refilled: %+v", res)
+	}
+}
+
+func TestTokenBucketUnlimited(t *testing.T) {
+	l := newTestLimiter(0, 0, nil)
+	for range 1000 {
+		if res := l.allowAt(context.Background(), &Principal{KeyID: "alice"}, ScopeSearch, testNow); !res.Allowed || res.Limit != 0 {
+			t.Fatalf("unlimited class = %+v", res)
+		}
+	}
+}
+
+func TestDailyQuotaRollover(t *testing.T) {
+	lateEvening := time.Date(2026, 10, 18, 23, 59, 30, 0, time.UTC)
+	// One request was counted today before a restart, or on another replica.
+	l := newTestLimiter(0, 2, map[string]int64{"alice:2026-10-18": 1})
+	ctx := context.Background()
+	alice := &Principal{KeyID: "alice"}
+
+	res := l.allowAt(ctx, alice, ScopeSearch, lateEvening)
+	if !res.Allowed || res.QuotaLimit != 2 || res.QuotaRemaining != 0 {
+		t.Fatalf("last request of the day = %+v", res)
+	}
+
+	res = l.allowAt(ctx, alice, ScopeSearch, lateEvening)
+	if res.Allowed || res.Reason != "Daily quota exceeded" {
+		t.Fatalf("request over the quota = %+v, want refused", res)
+	}
+	if res.RetryAfter != 30*time.Second {
+		t.Errorf("RetryAfter = %v, want 30s until midnight UTC", res.RetryAfter)
+	}
+
+	nextDay := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	res = l.allowAt(ctx, alice, ScopeSearch, nextDay)
+	if !res.Allowed || res.QuotaRemaining != 1 {
+		t.Errorf("first request of the next day = %+v, want allowed with 1 remaining", res)
+	}
+}
+
+func TestDailyQuotaOverride(t *testing.T) {
+	l := newTestLimiter(0, 1, nil)
+	ctx := context.Background()
+
+	unlimited := &Principal{KeyID: "unlimited", DailyQuota: -1}
+	for range 5 {
+		if res := l.allowAt(ctx, unlimited, ScopeSearch, testNow); !res.Allowed || res.QuotaLimit != 0 {
+			t.Fatalf("key with dailyQuota -1 = %+v", res)
+		}
+	}
+
+	raised := &Principal{KeyID: "raised", DailyQuota: 3}
+	for i := range 4 {
+		res := l.allowAt(ctx, raised, ScopeSearch, testNow)
+		if res.Allowed != (i < 3) {
+			t.Fatalf("request %d of a key with dailyQuota 3 = %+v", i+1, res)
+		}
+	}
+}
+
+func TestRefusedRequestConsumesNoQuota(t *testing.T) {
+	l := newTestLimiter(1, 10, nil)
+	ctx := context.Background()
+	alice := &Principal{KeyID: "alice"}
+
+	if res := l.allowAt(ctx, alice, ScopeSearch, testNow); !res.Allowed || res.QuotaRemaining != 9 {
+		t.Fatalf("first request = %+v", res)
+	}
+	for range 3 {
+		res := l.allowAt(ctx, alice, ScopeSearch, testNow)
+		if res.Allowed || res.QuotaRemaining != 9 {
+			t.Fatalf("request refused by the bucket = %+v, want 9 of the quota left", res)
+		}
+	}
+	if res := l.allowAt(ctx, alice, ScopeDocumentsRead, testNow); !res.Allowed || res.QuotaRemaining != 8 {
+		t.Errorf("next allowed request = %+v, want 8 of the quota left", res)
+	}
+}
+
+func TestDailyQuotaConcurrent(t *testing.T) {
+	const quota = 10
+	l := newTestLimiter(0, quota, nil)
+	alice := &Principal{KeyID: "alice"}
+
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if l.allowAt(context.Background(), alice, ScopeSearch, testNow).Allowed {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed.Load() != quota {
+		t.Errorf("%d concurrent requests allowed, want the quota of %d", allowed.Load(), quota)
+	}
+}
+
+func TestWriteHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		res  LimitResult
+		want map[string]string
+	}{
+		{
+			name: "allowed",
+			res:  LimitResult{Allowed: true, Limit: 30, Remaining: 12, Reset: 36500 * time.Millisecond, QuotaLimit: 1000, QuotaRemaining: 999},
+			want: map[string]string{
+				"X-RateLimit-Limit": "30", "X-RateLimit-Remaining": "12", "X-RateLimit-Reset": "37",
+				"X-RateLimit-Daily-Limit": "1000", "X-RateLimit-Daily-Remaining": "999", "Retry-After": "",
+			},
+		},
+		{
+			name: "rate limited",
+			res:  LimitResult{Limit: 30, RetryAfter: 1500 * time.Millisecond},
+			want: map[string]string{"X-RateLimit-Remaining": "0", "Retry-After": "2", "X-RateLimit-Daily-Limit": ""},
+		},
+		{
+			name: "retry at once",
+			res:  LimitResult{Limit: 30},
+			want: map[string]string{"Retry-After": "1"},
+		},
+		{
+			name: "quota exceeded",
+			res:  LimitResult{QuotaLimit: 5, RetryAfter: 2 * time.Hour},
+			want: map[string]string{"X-RateLimit-Limit": "", "X-RateLimit-Daily-Remaining": "0", "Retry-After": "7200"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.res.WriteHeaders(w)
+			for name, want := range tt.want {
+				if got := w.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestUntilNextDay(t *testing.T) {
+	ist := time.FixedZone("IST", 5*3600+1800)
+	tests := []struct {
+		now  time.Time
+		want time.Duration
+	}{
+		{time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC), 24 * time.Hour},
+		{time.Date(2026, 10, 18, 23, 59, 59, 0, time.UTC), time.Second},
+		{time.Date(2026, 12, 31, 18, 0, 0, 0, time.UTC), 6 * time.Hour},
+		// 01:00 IST is 19:30 UTC the day before.
+		{time.Date(2026, 10, 19, 1, 0, 0, 0, ist), 4*time.Hour + 30*time.Minute},
+	}
+	for _, tt := range tests {
+		if got := untilNextDay(tt.now); got != tt.want {
+			t.Errorf("untilNextDay(%v) = %v, want %v", tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestLimitTool(t *testing.T) {
+	var none *RateLimiter
+	if err := none.LimitTool(context.Background(), &Principal{KeyID: "alice"}, "list_documents", ScopeDocumentsRead); err != nil {
+		t.Errorf("nil limiter = %v", err)
+	}
+
+	l := newTestLimiter(1, 0, nil)
+	alice := &Principal{KeyID: "alice"}
+	if err := l.LimitTool(context.Background(), alice, "search", ScopeSearch); err != nil {
+		t.Fatalf("first call = %v", err)
+	}
+	err := l.LimitTool(context.Background(), alice, "search", ScopeSearch)
+	if err == nil || !strings.Contains(err.Error(), "Rate limit exceeded; retry in") {
+		t.Errorf("call over the limit = %v", err)
+	}
+}
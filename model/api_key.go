@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+)
+
+// CreateAPIKeyRequest is the body of POST /admin/keys.
+type CreateAPIKeyRequest struct {
+	Name                string    `json:"name"`                          // e.g. "Devinder Healthcare Custom GPT"
+	Scopes              []string  `json:"scopes"`                        // search, documents:read, admin
+	ExpiresAt           time.Time `json:"expiresAt,omitzero"`            // optional
+	InstructionsVersion string    `json:"instructionsVersion,omitempty"` // optional, overrides the active version
+	DailyQuota          int       `json:"dailyQuota,omitempty"`          // optional, overrides daily_quota; -1: unlimited
+	Tenant              string    `json:"tenant,omitempty"`              // optional, binds the key to one tenant
+}
+
+// CreateAPIKeyResponse carries the new key. It is shown only once.
+type CreateAPIKeyResponse struct {
+	Key    string          `json:"key"`
+	APIKey *db.APIKeyModel `json:"apiKey"`
+}
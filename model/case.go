@@ -0,0 +1,31 @@
+package model
+
+import "github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+
+// CaseRequest is the body of POST /cases and PUT /cases/{id}. PUT replaces the
+// whole case.
+type CaseRequest struct {
+	Title        string            `json:"title" jsonschema:"Short description of the case, e.g. Recurrent tonsillitis, child of 6"`
+	PatientRef   string            `json:"patientRef,omitempty" jsonschema:"The practice's own patient reference, e.g. a file number. Avoid names"`
+	Symptoms     []db.CaseSymptom  `json:"symptoms,omitempty" jsonschema:"Symptoms of the case"`
+	Citations    []db.CaseCitation `json:"citations,omitempty" jsonschema:"Remedy passages consulted"`
+	ChosenRemedy *db.ChosenRemedy  `json:"chosenRemedy,omitempty" jsonschema:"The remedy prescribed, once chosen"`
+	FollowUps    []db.CaseFollowUp `json:"followUps,omitempty" jsonschema:"Notes from follow-up consultations"`
+}
+
+// Apply copies the request's fields onto c.
+func (r CaseRequest) Apply(c *db.CaseModel) {
+	c.Title = r.Title
+	c.PatientRef = r.PatientRef
+	c.Symptoms = r.Symptoms
+	c.Citations = r.Citations
+	c.ChosenRemedy = r.ChosenRemedy
+	c.FollowUps = r.FollowUps
+}
+
+// FollowUpRequest is the body of POST /cases/{id}/follow-ups: what a follow-up
+// consultation found and, if the remedy is changed, the new prescription.
+type FollowUpRequest struct {
+	Entries   []db.CaseFollowUp `json:"entries" jsonschema:"One entry per finding, e.g. amelioration of the chief complaint and a new symptom"`
+	Prescribe *db.ChosenRemedy  `json:"prescribe,omitempty" jsonschema:"A second prescription; the current remedy moves to previousRemedies"`
+}
@@ -0,0 +1,23 @@
+package model
+
+import "github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+
+// CorpusResponse lists the corpus versions of a tenant and the one served.
+type CorpusResponse struct {
+	Tenant   string                  `json:"tenant"`
+	Active   string                  `json:"active,omitempty"` // active version; empty when the tenant's own database is served
+	Database string                  `json:"database"`         // database the API reads the corpus from
+	Versions []db.CorpusVersionModel `json:"versions"`         // newest first
+}
+
+// PromoteCorpusRequest is the body of POST /admin/corpus/promote.
+type PromoteCorpusRequest struct {
+	Tenant  string `json:"tenant,omitempty"` // default: the key's tenant
+	Version string `json:"version"`          // e.g. v20261018093000
+	Force   bool   `json:"force,omitempty"`  // promote even if its search indexes are still building
+}
+
+// RollbackCorpusRequest is the body of POST /admin/corpus/rollback.
+type RollbackCorpusRequest struct {
+	Tenant string `json:"tenant,omitempty"` // default: the key's tenant
+}
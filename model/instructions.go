@@ -0,0 +1,10 @@
+package model
+
+// InstructionsResponse is the rendered assistant instructions for one channel.
+type InstructionsResponse struct {
+	Version      string   `json:"version"`      // Version rendered
+	Active       string   `json:"active"`       // Version served by default
+	Channel      string   `json:"channel"`      // "mcp" or "custom-gpt"
+	Versions     []string `json:"versions"`     // All available versions
+	Instructions string   `json:"instructions"` // Rendered text
+}
@@ -1,8 +1,12 @@
 package model
 
-// QueryRequest represents the incoming query request from ChatGPT custom GPT
+// QueryRequest represents the incoming query request from ChatGPT custom GPT.
+// It is the body of POST /search, for case descriptions too long for a URL.
 type QueryRequest struct {
-	Query string `json:"query" binding:"required"`
+	Query   string   `json:"query" binding:"required" jsonschema:"Symptoms, remedy names, a question or a case description, up to 8000 characters"`
+	Sources []string `json:"sources,omitempty" jsonschema:"Only search these sources, as returned by ListSources"`
+	Limit   int      `json:"limit,omitempty" jsonschema:"At most this many passages, 0 to 10 (0 or absent: all matches)"`
+	CaseID  string   `json:"caseId,omitempty" jsonschema:"A saved case whose leading symptoms are added to the search"`
 }
 
 // QueryResponse represents the response containing passages for ChatGPT custom GPT
@@ -10,3 +14,8 @@ type QueryResponse struct {
 	Query    string   `json:"query"`    // Echo back the query
 	Passages []string `json:"passages"` // Retrieved passages with source and title
 }
+
+// SourcesResponse lists the distinct sources indexed for hybrid search.
+type SourcesResponse struct {
+	Sources []string `json:"sources"`
+}
@@ -0,0 +1,373 @@
+// Package openapi builds the OpenAPI 3.1 document from the controllers' route
+// registrations, so the spec the Custom GPT imports cannot drift from the code.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+const (
+	Version            = "3.1.0"
+	apiKeySchemeName   = "ApiKeyAuth"
+	componentSchemaRef = "#/components/schemas/"
+)
+
+// Param is a path or query parameter. All parameters are strings.
+type Param struct {
+	Name        string
+	In          string // "path" or "query"
+	Description string
+	Required    bool
+}
+
+// Request describes the JSON request body of an operation.
+type Request struct {
+	Description string
+	Body        any // typed zero value (e.g. model.QueryRequest{}); nil means no body
+}
+
+// Response describes the success response of an operation.
+type Response struct {
+	Status      int // default 200; 204 has no content
+	Description string
+	ContentType string // default application/json
+	Body        any    // typed nil (e.g. []mcp.DocSummary(nil)); nil means a plain string
+}
+
+// Operation is a route registration together with its documentation.
+// Controllers declare operations and derive their Routes() from them.
+type Operation struct {
+	Method      string
+	Pattern     string // net/http pattern path, e.g. /documents/{id}/structure
+	OperationID string
+	Summary     string
+	Description string
+	Params      []Param
+	Request     Request
+	Response    Response
+	Errors      map[int]string // status code -> description; 401/403/429 are added unless Public
+	Scope       string         // API key scope required, e.g. documents:read
+	Public      bool           // served without an API key
+	Hidden      bool           // registered but left out of the document
+	Handler     http.HandlerFunc
+}
+
+// Info is the document's info object.
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Document is an OpenAPI 3.1 document. Field order matches the conventional
+// layout so the generated JSON diffs cleanly against the committed file.
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       Info                            `json:"info"`
+	Servers    []serverObject                  `json:"servers,omitempty"`
+	Security   []map[string][]string           `json:"security,omitempty"`
+	Paths      map[string]map[string]operation `json:"paths"`
+	Components components                      `json:"components"`
+}
+
+type serverObject struct {
+	URL string `json:"url"`
+}
+
+type operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Parameters  []parameter           `json:"parameters,omitempty"`
+	RequestBody *requestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]response   `json:"responses"`
+}
+
+type requestBody struct {
+	Description string               `json:"description,omitempty"`
+	Required    bool                 `json:"required"`
+	Content     map[string]mediaType `json:"content"`
+}
+
+type parameter struct {
+	Name        string             `json:"name"`
+	In          string             `json:"in"`
+	Required    bool               `json:"required"`
+	Schema      *jsonschema.Schema `json:"schema"`
+	Description string             `json:"description,omitempty"`
+}
+
+type response struct {
+	Description string               `json:"description"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+type mediaType struct {
+	Schema *jsonschema.Schema `json:"schema"`
+}
+
+type components struct {
+	SecuritySchemes map[string]securityScheme     `json:"securitySchemes"`
+	Schemas         map[string]*jsonschema.Schema `json:"schemas,omitempty"`
+}
+
+type securityScheme struct {
+	Type string `json:"type"`
+	In   string `json:"in"`
+	Name string `json:"name"`
+}
+
+var (
+	pathParamPattern = regexp.MustCompile(`\{([^}]+)\}`)
+	timeType         = reflect.TypeFor[time.Time]()
+)
+
+// Build generates the document for ops. serverURL may be empty.
+func Build(info Info, serverURL string, ops []Operation) (*Document, error) {
+	doc := &Document{
+		OpenAPI:  Version,
+		Info:     info,
+		Security: []map[string][]string{{apiKeySchemeName: {}}},
+		Paths:    map[string]map[string]operation{},
+		Components: components{
+			SecuritySchemes: map[string]securityScheme{
+				apiKeySchemeName: {Type: "apiKey", In: "header", Name: "X-API-Key"},
+			},
+		},
+	}
+	if serverURL != "" {
+		doc.Servers = []serverObject{{URL: serverURL}}
+	}
+
+	gen := newSchemaGenerator()
+	for _, op := range ops {
+		if !op.Public && op.Scope == "" {
+			return nil, fmt.Errorf("%s %s: scope is required unless public", op.Method, op.Pattern)
+		}
+		if op.Hidden {
+			continue
+		}
+		if op.OperationID == "" {
+			return nil, fmt.Errorf("%s %s: operation ID is required", op.Method, op.Pattern)
+		}
+
+		o := operation{
+			OperationID: op.OperationID,
+			Summary:     op.Summary,
+			Description: op.Description,
+			Responses:   map[string]response{},
+		}
+		if op.Public {
+			o.Security = []map[string][]string{{}}
+		}
+
+		for _, name := range pathParamPattern.FindAllStringSubmatch(op.Pattern, -1) {
+			if !slices.ContainsFunc(op.Params, func(p Param) bool { return p.In == "path" && p.Name == name[1] }) {
+				return nil, fmt.Errorf("%s %s: path parameter %q is not documented", op.Method, op.Pattern, name[1])
+			}
+		}
+		for _, p := range op.Params {
+			o.Parameters = append(o.Parameters, parameter{
+				Name:        p.Name,
+				In:          p.In,
+				Required:    p.Required || p.In == "path",
+				Schema:      &jsonschema.Schema{Type: "string"},
+				Description: p.Description,
+			})
+		}
+
+		if op.Request.Body != nil {
+			schema, err := gen.schemaFor(op.Request.Body)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: request: %w", op.Method, op.Pattern, err)
+			}
+			o.RequestBody = &requestBody{
+				Description: op.Request.Description,
+				Required:    true,
+				Content:     map[string]mediaType{"application/json": {Schema: schema}},
+			}
+		}
+
+		status := op.Response.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := response{Description: op.Response.Description}
+		if status != http.StatusNoContent {
+			body, err := gen.schemaFor(op.Response.Body)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", op.Method, op.Pattern, err)
+			}
+			contentType := op.Response.ContentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			success.Content = map[string]mediaType{contentType: {Schema: body}}
+		}
+		o.Responses[fmt.Sprint(status)] = success
+
+		errs := map[int]string{}
+		if !op.Public {
+			errs[http.StatusUnauthorized] = "Unauthorized"
+			errs[http.StatusForbidden] = "API key lacks the " + op.Scope + " scope"
+			errs[http.StatusTooManyRequests] = "Rate limit or daily quota exceeded; see Retry-After"
+		}
+		for code, desc := range op.Errors {
+			errs[code] = desc
+		}
+		for code, desc := range errs {
+			o.Responses[fmt.Sprint(code)] = response{Description: desc}
+		}
+
+		method := strings.ToLower(op.Method)
+		if method == "" {
+			return nil, fmt.Errorf("%s: method is required", op.Pattern)
+		}
+		if doc.Paths[op.Pattern] == nil {
+			doc.Paths[op.Pattern] = map[string]operation{}
+		}
+		if _, dup := doc.Paths[op.Pattern][method]; dup {
+			return nil, fmt.Errorf("%s %s: duplicate operation", op.Method, op.Pattern)
+		}
+		doc.Paths[op.Pattern][method] = o
+	}
+
+	schemas, err := gen.components()
+	if err != nil {
+		return nil, err
+	}
+	doc.Components.Schemas = schemas
+	return doc, nil
+}
+
+// Marshal renders the document in the committed file's format.
+func (d *Document) Marshal() ([]byte, error) {
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// --- schemas ---
+
+// schemaGenerator turns Go types into schemas. Every named struct type becomes
+// a component and is referenced by $ref, which also makes recursive types such
+// as PageIndexNode representable.
+type schemaGenerator struct {
+	types map[string]reflect.Type
+}
+
+func newSchemaGenerator() *schemaGenerator {
+	return &schemaGenerator{types: map[string]reflect.Type{}}
+}
+
+func (g *schemaGenerator) schemaFor(v any) (*jsonschema.Schema, error) {
+	if v == nil {
+		return &jsonschema.Schema{Type: "string"}, nil
+	}
+	t := reflect.TypeOf(v)
+	if err := g.collect(t); err != nil {
+		return nil, err
+	}
+	s, err := jsonschema.ForType(t, &jsonschema.ForOptions{TypeSchemas: g.refs(nil)})
+	if err != nil {
+		return nil, err
+	}
+	// Handlers encode empty results as [], never null.
+	if t.Kind() == reflect.Slice {
+		s.Types, s.Type = nil, "array"
+	}
+	return s, nil
+}
+
+// collect registers every named struct type reachable from t.
+func (g *schemaGenerator) collect(t reflect.Type) error {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		return g.collect(t.Elem())
+	case reflect.Map:
+		return g.collect(t.Elem())
+	case reflect.Struct:
+		if t.Name() == "" || t == timeType {
+			break
+		}
+		if prev, ok := g.types[t.Name()]; ok {
+			if prev != t {
+				return fmt.Errorf("schema name %s used by both %s and %s", t.Name(), prev, t)
+			}
+			return nil
+		}
+		g.types[t.Name()] = t
+		for i := 0; i < t.NumField(); i++ {
+			if f := t.Field(i); f.IsExported() {
+				if err := g.collect(f.Type); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// refs maps every component type except self to its $ref. For self, only
+// []self and *self are mapped, so its own fields are expanded but recursion
+// is not. time.Time is a date-time string.
+func (g *schemaGenerator) refs(self reflect.Type) map[reflect.Type]*jsonschema.Schema {
+	m := make(map[reflect.Type]*jsonschema.Schema, len(g.types)+1)
+	m[timeType] = &jsonschema.Schema{Type: "string", Format: "date-time"}
+	for name, t := range g.types {
+		ref := &jsonschema.Schema{Ref: componentSchemaRef + name}
+		if t == self {
+			m[reflect.SliceOf(t)] = &jsonschema.Schema{Type: "array", Items: ref}
+			m[reflect.PointerTo(t)] = ref
+			continue
+		}
+		m[t] = ref
+	}
+	return m
+}
+
+// nullableRefs rewrites the schemas inferred for pointers to components. The
+// inference marks them {"type": ["null"], "$ref": ...}, which in 3.1 only
+// validates null; anyOf allows either.
+func nullableRefs(s *jsonschema.Schema) {
+	if s == nil {
+		return
+	}
+	if s.Ref != "" && slices.Equal(s.Types, []string{"null"}) {
+		*s = jsonschema.Schema{
+			Description: s.Description,
+			AnyOf:       []*jsonschema.Schema{{Ref: s.Ref}, {Type: "null"}},
+		}
+		return
+	}
+	for _, p := range s.Properties {
+		nullableRefs(p)
+	}
+	nullableRefs(s.Items)
+	nullableRefs(s.AdditionalProperties)
+}
+
+func (g *schemaGenerator) components() (map[string]*jsonschema.Schema, error) {
+	out := make(map[string]*jsonschema.Schema, len(g.types))
+	for name, t := range g.types {
+		s, err := jsonschema.ForType(t, &jsonschema.ForOptions{TypeSchemas: g.refs(t)})
+		if err != nil {
+			return nil, err
+		}
+		nullableRefs(s)
+		out[name] = s
+	}
+	return out, nil
+}
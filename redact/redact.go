@@ -0,0 +1,157 @@
+// Package redact finds patient details in free text, such as the case
+// narratives physicians paste into /search, so they can be masked in logs and
+// audit records and kept from the embedding provider.
+//
+// Detection is pattern based. Names are only recognised after a patient's
+// honorific or a patient-name label ("Mrs Sharma", "patient name: Ravi
+// Kumar"), since remedy, symptom and author names are capitalised too; "Dr"
+// is left alone, as it names the physicians and the materia medica authors
+// ("Dr Kent").
+package redact
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Kind is the kind of personal detail found; masked text shows it as [KIND].
+type Kind string
+
+const (
+	KindName  Kind = "NAME"
+	KindPhone Kind = "PHONE"
+	KindEmail Kind = "EMAIL"
+	KindDOB   Kind = "DOB"
+	KindDate  Kind = "DATE"
+	KindID    Kind = "ID"
+)
+
+const months = `(?:jan|feb|mar|apr|may|jun|jul|aug|sep|sept|oct|nov|dec)[a-z]*\.?`
+
+// date matches full dates; a year alone is not identifying and is kept.
+const date = `(?:\d{1,2}[/.\-]\d{1,2}[/.\-](?:\d{4}|\d{2})` +
+	`|\d{4}-\d{1,2}-\d{1,2}` +
+	`|\d{1,2}(?:st|nd|rd|th)?\s+` + months + `,?\s+\d{4}` +
+	`|` + months + `\s+\d{1,2}(?:st|nd|rd|th)?,?\s+\d{4})`
+
+const personName = `[A-Z][a-z]+(?:[ \t]+[A-Z][a-z]+){0,2}` // on one line
+
+// rule masks group of each match of re, when valid (if set) accepts it.
+type rule struct {
+	kind  Kind
+	re    *regexp.Regexp
+	group int
+	valid func(string) bool
+}
+
+// rules apply in order, so e.g. a date of birth is masked as DOB before the
+// date rule sees it, dates before their digits look like an ID, and grouped
+// digits ("1234 5678 9012") as a whole before a label claims the first group.
+var rules = []rule{
+	{kind: KindEmail, re: regexp.MustCompile(`(?i)\b[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,}\b`)},
+	{kind: KindDOB, re: regexp.MustCompile(`(?i)\b(?:dob|d\.o\.b\.?|date\s+of\s+birth|born(?:\s+on)?)\s*[:\-]?\s*(` + date + `)`), group: 1},
+	// All full dates are identifying (HIPAA Safe Harbor keeps only the year).
+	{kind: KindDate, re: regexp.MustCompile(`(?i)\b` + date + `\b`)},
+	{kind: KindPhone, re: regexp.MustCompile(`\+\d[\d\s().\-]{7,}\d`), valid: digitsBetween(8, 15)},
+	{kind: KindPhone, re: regexp.MustCompile(`\b\d[\d\s().\-]{8,}\d\b`), valid: digitsBetween(10, 11)},
+	{kind: KindID, re: regexp.MustCompile(`\b\d[\d\s\-]{4,}\d\b`), valid: func(s string) bool { return digitsBetween(6, 20)(s) && !numberRanges.MatchString(s) }},
+	{kind: KindID, re: regexp.MustCompile(`(?i)\b(?:mrn|uhid|ip\s*no|op\s*no|reg(?:istration)?\s*no|patient\s*id|aadhaa?r|pan|passport|ssn|id)\s*(?:no\.?|number|#)?\s*[:#\-]?\s*([a-z0-9][a-z0-9\-/]{3,})`), group: 1, valid: hasDigit},
+	{kind: KindID, re: regexp.MustCompile(`\b[A-Z]{5}\d{4}[A-Z]\b`)}, // PAN
+	{kind: KindName, re: regexp.MustCompile(`\b(?:Mr|Mrs|Ms|Miss|Mx|Shri|Sri|Smt|Kumari|Master|Baby)\.?\s+(` + personName + `)`), group: 1},
+	// "patient name is", "name of the patient:", "patient: ", "pt named",
+	// and "Name:" starting a line; not "patient is", which precedes symptoms.
+	{kind: KindName, re: regexp.MustCompile(`(?i:\b(?:patient|pt\.?)(?:'s)?\s+name\s*(?:is|:|-)?\s*` +
+		`|\bname\s+of\s+(?:the\s+)?patient\s*(?:is|:|-)?\s*` +
+		`|\b(?:patient|pt\.?)\s*[:\-]\s*` +
+		`|\b(?:patient|pt\.?)\s+(?:named|called)\s+` +
+		`|(?m:^)\s*name\s*[:\-]\s*)(` + personName + `)`), group: 1, valid: notVocabulary},
+}
+
+// vocabulary are capitalised words that follow a "patient:" label in case
+// notes or cite an author, and are not names.
+var vocabulary = map[string]bool{
+	"kent": true, "hahnemann": true, "boericke": true, "allen": true, "clarke": true,
+	"hering": true, "boger": true, "phatak": true, "farrington": true, "nash": true,
+	"anxious": true, "restless": true, "irritable": true, "weeping": true, "fearful": true,
+	"chilly": true, "thirsty": true, "thirstless": true, "sad": true, "angry": true,
+	"sensitive": true, "obstinate": true, "jealous": true, "better": true, "worse": true,
+	"male": true, "female": true, "complains": true, "suffering": true, "presents": true,
+	"aged": true, "child": true, "boy": true, "girl": true, "man": true, "woman": true,
+}
+
+func notVocabulary(name string) bool {
+	first, _, _ := strings.Cut(name, " ")
+	return !vocabulary[strings.ToLower(first)]
+}
+
+var (
+	numberRanges   = regexp.MustCompile(`^\d+\s*-\s*\d+(?:\s+\d+\s*-\s*\d+)*$`) // e.g. lines 321-349 or 100-150 200-250
+	spaces         = regexp.MustCompile(`[ \t]{2,}`)
+	spaceBeforeSep = regexp.MustCompile(`[ \t]+([,;.])`)
+)
+
+// Mask replaces each personal detail in text with its [KIND].
+func Mask(text string) string {
+	return apply(text, func(k Kind) string { return "[" + string(k) + "]" })
+}
+
+// Strip removes the personal details from text, for sending it to third
+// parties such as the embedding provider.
+func Strip(text string) string {
+	text = apply(text, func(Kind) string { return "" })
+	text = spaceBeforeSep.ReplaceAllString(spaces.ReplaceAllString(text, " "), "$1")
+	return strings.TrimSpace(text)
+}
+
+// Find returns the kinds of personal detail in text, in rule order, each once.
+func Find(text string) []Kind {
+	var found []Kind
+	apply(text, func(k Kind) string {
+		if !slices.Contains(found, k) {
+			found = append(found, k)
+		}
+		return "[" + string(k) + "]"
+	})
+	return found
+}
+
+func apply(text string, replace func(Kind) string) string {
+	for _, r := range rules {
+		matches := r.re.FindAllStringSubmatchIndex(text, -1)
+		if matches == nil {
+			continue
+		}
+
+		var b strings.Builder
+		last := 0
+		for _, m := range matches {
+			start, end := m[2*r.group], m[2*r.group+1]
+			if start < 0 || (r.valid != nil && !r.valid(text[start:end])) {
+				continue
+			}
+			b.WriteString(text[last:start])
+			b.WriteString(replace(r.kind))
+			last = end
+		}
+		b.WriteString(text[last:])
+		text = b.String()
+	}
+	return text
+}
+
+func hasDigit(s string) bool {
+	return strings.ContainsAny(s, "0123456789")
+}
+
+func digitsBetween(lo, hi int) func(string) bool {
+	return func(s string) bool {
+		n := 0
+		for _, c := range s {
+			if c >= '0' && c <= '9' {
+				n++
+			}
+		}
+		return n >= lo && n <= hi
+	}
+}
@@ -0,0 +1,82 @@
+package redact
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		// Personal details.
+		{"honorific", "Mrs Sharma, 42, burning pains", "Mrs [NAME], 42, burning pains"},
+		{"honorific with full name", "Shri Ravi Kumar complains of vertigo", "Shri [NAME] complains of vertigo"},
+		{"patient label", "Patient: Ravi Kumar, 34M", "Patient: [NAME], 34M"},
+		{"patient name label", "patient name is Anita Rao", "patient name is [NAME]"},
+		{"name of the patient", "Name of the patient: Meera", "Name of the patient: [NAME]"},
+		{"pt named", "pt named Arjun, fever since Tuesday", "pt named [NAME], fever since Tuesday"},
+		{"name line", "Name: Priya Nair\nAge: 30", "Name: [NAME]\nAge: 30"},
+		{"email", "write to ravi.k@example.com", "write to [EMAIL]"},
+		{"indian mobile", "call +91 98765 43210", "call [PHONE]"},
+		{"local phone", "ph 9876543210", "ph [PHONE]"},
+		{"date of birth", "DOB: 12/03/1988", "DOB: [DOB]"},
+		{"born on", "born on 3rd March 1990", "born on [DOB]"},
+		{"date", "seen on 2024-05-17", "seen on [DATE]"},
+		{"written date", "relapse Jan 5, 2024", "relapse [DATE]"},
+		{"mrn", "MRN: 4471239", "MRN: [ID]"},
+		{"aadhaar", "Aadhaar 1234 5678 9012", "Aadhaar [ID]"},
+		{"pan", "PAN ABCDE1234F", "PAN [ID]"},
+
+		// Known false positives, kept as they are.
+		{"Dr and author", "Dr Kent and Dr Hahnemann advise waiting", "Dr Kent and Dr Hahnemann advise waiting"},
+		{"patient is symptom", "patient is Anxious and Restless at night", "patient is Anxious and Restless at night"},
+		{"patient label symptom", "Patient: Restless, worse at midnight", "Patient: Restless, worse at midnight"},
+		{"author after label", "name: Kent, Repertory", "name: Kent, Repertory"},
+		{"line range", "lines 321-349", "lines 321-349"},
+		{"line ranges", "lines 100-150 200-250", "lines 100-150 200-250"},
+		{"line list", "lines 19-34,321-349", "lines 19-34,321-349"},
+		{"potencies", "Sulph 30C, then 200, later 1M and 10M", "Sulph 30C, then 200, later 1M and 10M"},
+		{"potency series", "Calc. Carb. 6X 30 200", "Calc. Carb. 6X 30 200"},
+		{"remedy abbreviations", "Nux-v., Ars. alb., Rhus-t. and Puls. compared", "Nux-v., Ars. alb., Rhus-t. and Puls. compared"},
+		{"year", "since 2019, worse in winter", "since 2019, worse in winter"},
+		{"age", "Male, 45 years, ailments from grief", "Male, 45 years, ailments from grief"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Mask(tt.in); got != tt.want {
+				t.Errorf("Mask(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStrip(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Mrs Sharma, DOB 12/03/1988, burning pains", "Mrs, DOB, burning pains"},
+		{"Patient: Ravi Kumar . thirst for cold water", "Patient:. thirst for cold water"},
+		{"call +91 98765 43210 after 6pm", "call after 6pm"},
+		{"Dr Kent: Sulph 200", "Dr Kent: Sulph 200"},
+	}
+	for _, tt := range tests {
+		if got := Strip(tt.in); got != tt.want {
+			t.Errorf("Strip(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	got := Find("Mr Rao, ph 9876543210, DOB 1/2/1980, seen 2024-05-17, alt 9876501234")
+	want := []Kind{KindDOB, KindDate, KindPhone, KindName}
+	if !slices.Equal(got, want) {
+		t.Errorf("Find = %v, want %v", got, want)
+	}
+	if got := Find("Dr Kent: Lyc. 200 for lines 10-25"); len(got) != 0 {
+		t.Errorf("Find on clean text = %v", got)
+	}
+}
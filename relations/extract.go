@@ -0,0 +1,275 @@
+// Package relations builds the graph of relations between remedies —
+// complementary, inimical, antidote, follows well and compare — from the
+// labelled lists in the relationship sections of the materia medica, e.g.
+//
+//	RELATIONSHIP.--Complementary: Sulph. Compare: Bell.; Bry.; Gels. Antidote: Acetic acid; Wine.
+//
+// Names are abbreviated as the authors wrote them and are resolved to
+// documents by word prefix ("Calc. carb" is CALCAREA CARBONICA). Names that
+// match no document, like Wine above, are kept with an empty target.
+package relations
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+)
+
+// Relation types.
+const (
+	Complementary = "complementary"
+	Inimical      = "inimical"
+	Antidote      = "antidote"
+	FollowsWell   = "follows_well"
+	Compare       = "compare"
+)
+
+// Types lists the relation types in the order they are reported.
+var Types = []string{Complementary, Inimical, Antidote, FollowsWell, Compare}
+
+const (
+	maxNameWords  = 4   // longer "names" are prose
+	maxExcerpt    = 300 // characters of the list kept as the citation
+	minPrefixSize = 3   // "Ac." is too short to resolve
+)
+
+var (
+	// sectionTitle matches the titles of the sections relations are read from.
+	sectionTitle = regexp.MustCompile(`(?i)\b(relationship|relations|compare|comparisons?|antidot|complementary|inimical|incompatible|follows?\s+well)`)
+
+	// label matches the label of a list of related remedies, with its
+	// punctuation.
+	label = regexp.MustCompile(`(?i)\b(complementary|incompatible|compatible|inimical|antidoted\s+by|antidotes?|it\s+antidotes|follows?\s+well(?:\s+(?:after|before))?|followed\s+(?:well\s+)?by|compare|comparisons?|cf\.)(?:\s+(?:to|with|also|after))?\s*[:.\-–—]*`)
+
+	parenthetical = regexp.MustCompile(`\([^)]*\)|\[[^\]]*\]`)
+	separator     = regexp.MustCompile(`[;,]|\s+and\s+|\s+or\s+`)
+	sentenceEnd   = regexp.MustCompile(`\.\s+([A-Z][a-z]*)`) // "Coffee. Acon. follows well": lists are not always separated
+	paragraph     = regexp.MustCompile(`\n\s*\n`)
+	listEnd       = regexp.MustCompile(`(?i)\b(?:dose|dosage)\b`) // Boericke runs the dose on after the lists
+)
+
+// relationOf maps a matched label to its relation type.
+func relationOf(l string) string {
+	l = strings.ToLower(l)
+	switch {
+	case strings.HasPrefix(l, "complementary"):
+		return Complementary
+	case strings.HasPrefix(l, "inimical"), strings.HasPrefix(l, "incompatible"):
+		return Inimical
+	case strings.Contains(l, "antidot"):
+		return Antidote
+	case strings.HasPrefix(l, "follow"), strings.HasPrefix(l, "compatible"):
+		return FollowsWell
+	case strings.HasPrefix(l, "compar"), strings.HasPrefix(l, "cf"):
+		return Compare
+	}
+	return ""
+}
+
+// Remedy is a document names are resolved against.
+type Remedy struct {
+	ID   string
+	Name string
+}
+
+// Resolver maps remedy names as written in the texts to document IDs.
+type Resolver struct {
+	remedies []resolvable
+}
+
+type resolvable struct {
+	id    string
+	words [][]string // of the name and of the ID
+}
+
+func NewResolver(remedies []Remedy) *Resolver {
+	r := &Resolver{}
+	for _, rem := range remedies {
+		res := resolvable{id: rem.ID, words: [][]string{words(rem.Name)}}
+		if idWords := words(rem.ID); !slices.Equal(idWords, res.words[0]) {
+			res.words = append(res.words, idWords)
+		}
+		r.remedies = append(r.remedies, res)
+	}
+	slices.SortFunc(r.remedies, func(a, b resolvable) int { return strings.Compare(a.id, b.id) })
+	return r
+}
+
+// Resolve returns the ID of the document name refers to, or "". Each word of
+// name must begin the corresponding word of the document's name or ID. An
+// exact match wins; otherwise the document with the fewest words, so "Calc."
+// is CALCAREA CARBONICA rather than CALCAREA CARBONICA ARSENICOSA, with ties
+// going to the first ID alphabetically.
+func (r *Resolver) Resolve(name string) string {
+	nw := words(name)
+	if len(nw) == 0 || len(nw[0]) < minPrefixSize {
+		return ""
+	}
+
+	best, bestLen := "", 0
+	for _, rem := range r.remedies {
+		for _, w := range rem.words {
+			if !prefixes(nw, w) {
+				continue
+			}
+			if slices.Equal(nw, w) {
+				return rem.id
+			}
+			if best == "" || len(w) < bestLen {
+				best, bestLen = rem.id, len(w)
+			}
+		}
+	}
+	return best
+}
+
+func prefixes(name, of []string) bool {
+	if len(name) > len(of) {
+		return false
+	}
+	for i, w := range name {
+		if !strings.HasPrefix(of[i], w) {
+			return false
+		}
+	}
+	return true
+}
+
+// words splits s into lower-case words of letters.
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(c rune) bool { return !unicode.IsLetter(c) })
+}
+
+// Extract returns the edges named in doc's relationship sections. Edge IDs are
+// deterministic, so re-extracting a document yields the same edges.
+func Extract(doc *db.PageIndexDocModel, r *Resolver) []db.RemedyRelationModel {
+	var edges []db.RemedyRelationModel
+	seen := map[string]bool{}
+
+	var walk func(nodes []db.PageIndexNode, inSection bool)
+	walk = func(nodes []db.PageIndexNode, inSection bool) {
+		for _, n := range nodes {
+			in := inSection || sectionTitle.MatchString(n.Title)
+			if in {
+				for _, e := range extractNode(doc.DocID, n, r) {
+					if !seen[e.ID] {
+						seen[e.ID] = true
+						edges = append(edges, e)
+					}
+				}
+			}
+			walk(n.Nodes, in)
+		}
+	}
+	walk(doc.Structure, false)
+	return edges
+}
+
+// extractNode reads the labelled lists in n's text. Text before the first
+// label belongs to the relation the title names, if any ("Antidotes" over a
+// bare list).
+func extractNode(from string, n db.PageIndexNode, r *Resolver) []db.RemedyRelationModel {
+	var edges []db.RemedyRelationModel
+	for _, para := range paragraph.Split(n.Text, -1) {
+		labels := label.FindAllStringSubmatchIndex(para, -1)
+
+		titleRelation := ""
+		if m := label.FindStringSubmatch(n.Title); m != nil {
+			titleRelation = relationOf(m[1])
+		}
+		first := len(para)
+		if len(labels) > 0 {
+			first = labels[0][0]
+		}
+		if titleRelation != "" {
+			edges = appendList(edges, from, titleRelation, para[:first], para[:first], n, r)
+		}
+
+		for i, m := range labels {
+			end := len(para)
+			if i+1 < len(labels) {
+				end = labels[i+1][0]
+			}
+			edges = appendList(edges, from, relationOf(para[m[2]:m[3]]), para[m[0]:end], para[m[1]:end], n, r)
+		}
+	}
+	return edges
+}
+
+// appendList adds an edge for each remedy named in list, citing excerpt.
+func appendList(edges []db.RemedyRelationModel, from, relation, excerpt, list string, n db.PageIndexNode, r *Resolver) []db.RemedyRelationModel {
+	excerpt = strings.Join(strings.Fields(excerpt), " ")
+	if runes := []rune(excerpt); len(runes) > maxExcerpt {
+		excerpt = string(runes[:maxExcerpt]) + "…"
+	}
+
+	for _, name := range splitNames(list, r) {
+		to := r.Resolve(name)
+		if to == from {
+			continue
+		}
+		edges = append(edges, db.RemedyRelationModel{
+			ID:       strings.Join([]string{from, relation, strings.ToLower(name), n.NodeID}, "|"),
+			From:     from,
+			To:       to,
+			Name:     name,
+			Relation: relation,
+			NodeID:   n.NodeID,
+			Title:    n.Title,
+			LineNum:  n.LineNum,
+			Excerpt:  excerpt,
+		})
+	}
+	return edges
+}
+
+// splitNames returns the remedy names in a list, without parenthetical notes
+// and dropping entries that read as prose or potencies.
+func splitNames(list string, r *Resolver) []string {
+	if loc := listEnd.FindStringIndex(list); loc != nil {
+		list = list[:loc[0]]
+	}
+
+	var names []string
+	list = splitSentences(parenthetical.ReplaceAllString(list, " "), r)
+	for _, part := range separator.Split(list, -1) {
+		name := strings.Join(strings.Fields(part), " ")
+		name = strings.TrimRight(strings.TrimLeft(name, ".:-–— "), ".:-–— ")
+		if name == "" || strings.ContainsAny(name, "0123456789") {
+			continue
+		}
+		if first := []rune(name)[0]; !unicode.IsUpper(first) {
+			continue
+		}
+		if len(strings.Fields(name)) > maxNameWords {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// splitSentences separates the names in list that only a full stop divides,
+// except where the words on either side of it name one remedy together: "Bell.
+// Bry." are two remedies, "Calc. Carb." is one.
+func splitSentences(list string, r *Resolver) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range sentenceEnd.FindAllStringSubmatchIndex(list, -1) {
+		before := list[strings.LastIndexAny(list[:m[0]], ";,.")+1 : m[0]]
+		if parts := separator.Split(before, -1); len(parts) > 0 {
+			before = parts[len(parts)-1]
+		}
+		if strings.TrimSpace(before) != "" && r.Resolve(before+" "+list[m[2]:m[3]]) != "" {
+			continue
+		}
+		b.WriteString(list[last:m[0]])
+		b.WriteString(";")
+		last = m[2]
+	}
+	b.WriteString(list[last:])
+	return b.String()
+}
@@ -0,0 +1,205 @@
+package relations
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+)
+
+var testRemedies = []Remedy{
+	{ID: "ACONITUM_NAPELLUS", Name: "Aconitum Napellus"},
+	{ID: "ARSENICUM_ALBUM", Name: "Arsenicum Album"},
+	{ID: "BARYTA_CARBONICA", Name: "Baryta Carbonica"},
+	{ID: "BELLADONNA", Name: "Belladonna"},
+	{ID: "CALCAREA_CARBONICA", Name: "Calcarea Carbonica"},
+	{ID: "CALCAREA_CARBONICA_ARSENICOSA", Name: "Calcarea Carbonica Arsenicosa"},
+	{ID: "CALCAREA_PHOSPHORICA", Name: "Calcarea Phosphorica"},
+	{ID: "CHAMOMILLA", Name: "Chamomilla"},
+	{ID: "COFFEA_CRUDA", Name: "Coffea Cruda"},
+	{ID: "IGNATIA", Name: "Ignatia Amara"},
+	{ID: "KALI_BICHROMICUM", Name: "Kali Bichromicum"},
+	{ID: "KALI_MURIATICUM", Name: "Kali Muriaticum"},
+	{ID: "LYCOPODIUM", Name: "Lycopodium Clavatum"},
+	{ID: "NITRICUM_ACIDUM", Name: "Nitricum Acidum"},
+	{ID: "NUX_VOMICA", Name: "Nux Vomica"},
+	{ID: "PULSATILLA", Name: "Pulsatilla"},
+	{ID: "RHUS_TOXICODENDRON", Name: "Rhus Toxicodendron"},
+	{ID: "SILICEA", Name: "Silicea"},
+	{ID: "SULPHUR", Name: "Sulphur"},
+}
+
+func TestResolve(t *testing.T) {
+	r := NewResolver(testRemedies)
+	tests := map[string]string{
+		"Calc.":         "CALCAREA_CARBONICA", // fewest words; ties go to the first ID
+		"Calc. carb":    "CALCAREA_CARBONICA",
+		"Calc. Carb.":   "CALCAREA_CARBONICA",
+		"Calc. phos":    "CALCAREA_PHOSPHORICA",
+		"Calc. c. ars.": "CALCAREA_CARBONICA_ARSENICOSA",
+		"Bar. c.":       "BARYTA_CARBONICA",
+		"Nit. ac.":      "NITRICUM_ACIDUM",
+		"Nux":           "NUX_VOMICA",
+		"Rhus":          "RHUS_TOXICODENDRON",
+		"Kali mur":      "KALI_MURIATICUM",
+		"Lycop.":        "LYCOPODIUM",
+		"Sulph.":        "SULPHUR",
+		"Ign.":          "IGNATIA",
+		"Silicea":       "SILICEA",
+		"Silica":        "", // not a prefix of Silicea
+		"Kali":          "KALI_BICHROMICUM",
+		"Ac.":           "", // too short
+		"Wine":          "",
+		"Bell. Bry.":    "",
+	}
+	for name, want := range tests {
+		if got := r.Resolve(name); got != want {
+			t.Errorf("Resolve(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+// edge is an extracted edge as the tests compare it.
+type edge struct {
+	relation, name, to string
+}
+
+func extractEdges(t *testing.T, from, title, text string) []edge {
+	t.Helper()
+	doc := &db.PageIndexDocModel{
+		DocID: from,
+		Structure: []db.PageIndexNode{{
+			Title:  strings.ToUpper(from),
+			NodeID: "0001",
+			Nodes:  []db.PageIndexNode{{Title: title, NodeID: "0042", LineNum: 310, Text: text}},
+		}},
+	}
+	var out []edge
+	for _, e := range Extract(doc, NewResolver(testRemedies)) {
+		if e.From != from || e.NodeID != "0042" || e.LineNum != 310 || e.Title != title || e.Excerpt == "" {
+			t.Errorf("edge %+v does not cite its section", e)
+		}
+		out = append(out, edge{e.Relation, e.Name, e.To})
+	}
+	return out
+}
+
+func TestExtractBoericke(t *testing.T) {
+	// Boericke, Calcarea carbonica.
+	text := "RELATIONSHIP.--Complementary: Bell.; Rhus; Lycop.; Silica. Calcarea is useful after Sulphur, " +
+		"where the pupils remain dilated; when Lycopod. is not working well. " +
+		"Inimical: Bar. c.; Nit. ac.; Sulph., after each other. " +
+		"Compare: Lycop.; Sil.; Puls.; Cham.; Calc. phos.\n\n" +
+		"Dose.--Sixth trituration. Thirtieth and higher potencies."
+
+	got := extractEdges(t, "CALCAREA_CARBONICA", "RELATIONSHIP", text)
+	want := []edge{
+		{Complementary, "Bell", "BELLADONNA"},
+		{Complementary, "Rhus", "RHUS_TOXICODENDRON"},
+		{Complementary, "Lycop", "LYCOPODIUM"},
+		{Complementary, "Silica", ""},
+		{Inimical, "Bar. c", "BARYTA_CARBONICA"},
+		{Inimical, "Nit. ac", "NITRICUM_ACIDUM"},
+		{Inimical, "Sulph", "SULPHUR"},
+		{Compare, "Lycop", "LYCOPODIUM"},
+		{Compare, "Sil", "SILICEA"},
+		{Compare, "Puls", "PULSATILLA"},
+		{Compare, "Cham", "CHAMOMILLA"},
+		{Compare, "Calc. phos", "CALCAREA_PHOSPHORICA"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("edges =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestExtractAllen(t *testing.T) {
+	// Allen, Keynotes, Sulphur.
+	text := "Relations. - Complementary: Aloe, Psor., Nux. Calc. Carb. Lyc. Puls. Follows well: " +
+		"Acon., Nux, Calc. Carb. Antidotes: Camph., Cham., Coff., Nux."
+
+	got := extractEdges(t, "SULPHUR", "Relations", text)
+	want := []edge{
+		{Complementary, "Aloe", ""},
+		{Complementary, "Psor", ""},
+		{Complementary, "Nux", "NUX_VOMICA"},
+		{Complementary, "Calc. Carb", "CALCAREA_CARBONICA"},
+		{Complementary, "Lyc", "LYCOPODIUM"},
+		{Complementary, "Puls", "PULSATILLA"},
+		{FollowsWell, "Acon", "ACONITUM_NAPELLUS"},
+		{FollowsWell, "Nux", "NUX_VOMICA"},
+		{FollowsWell, "Calc. Carb", "CALCAREA_CARBONICA"},
+		{Antidote, "Camph", ""},
+		{Antidote, "Cham", "CHAMOMILLA"},
+		{Antidote, "Coff", "COFFEA_CRUDA"},
+		{Antidote, "Nux", "NUX_VOMICA"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("edges =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestExtractTitledList(t *testing.T) {
+	// A bare list under a section titled with its relation, and a remedy
+	// naming itself, which is no edge.
+	got := extractEdges(t, "PULSATILLA", "Antidotes", "Coffea; Cham.; Ign.; Nux. Puls. Wine.")
+	want := []edge{
+		{Antidote, "Coffea", "COFFEA_CRUDA"},
+		{Antidote, "Cham", "CHAMOMILLA"},
+		{Antidote, "Ign", "IGNATIA"},
+		{Antidote, "Nux", "NUX_VOMICA"},
+		{Antidote, "Wine", ""},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("edges =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestSplitNames(t *testing.T) {
+	r := NewResolver(testRemedies)
+	tests := []struct {
+		list string
+		want []string
+	}{
+		{"Calc. Carb., Lyc.", []string{"Calc. Carb", "Lyc"}},
+		{"Bell. Bry. Gels.", []string{"Bell", "Bry", "Gels"}},
+		{"Coffee. Acon.", []string{"Coffee", "Acon"}},
+		{"Kali mur. (in glandular swellings); Merc. 30", []string{"Kali mur"}}, // a potency reads as prose
+		{"Ars. and Lach. or Apis", []string{"Ars", "Lach", "Apis"}},
+		{"Bell.; Bry. Dose.--Third potency", []string{"Bell", "Bry"}},
+		{"useful after Sulphur in chronic cases of the skin", nil},
+	}
+	for _, tt := range tests {
+		if got := splitNames(tt.list, r); !slices.Equal(got, tt.want) {
+			t.Errorf("splitNames(%q) = %q, want %q", tt.list, got, tt.want)
+		}
+	}
+}
+
+func TestGroup(t *testing.T) {
+	edges := []db.RemedyRelationModel{
+		{From: "SULPHUR", To: "CALCAREA_CARBONICA", Name: "Calc. Carb", Relation: Complementary, NodeID: "0042"},
+		{From: "SULPHUR", To: "CALCAREA_CARBONICA", Name: "Calc.", Relation: Complementary, NodeID: "0043"},
+		{From: "SULPHUR", To: "", Name: "Wine", Relation: Antidote, NodeID: "0042"},
+		{From: "CALCAREA_CARBONICA", To: "SULPHUR", Name: "Sulph", Relation: Inimical, NodeID: "0007"},
+		{From: "PSORINUM", To: "SULPHUR", Name: "Sulph", Relation: Compare, NodeID: "0009"},
+	}
+	rel := group("SULPHUR", edges, map[string]string{"CALCAREA_CARBONICA": "Calcarea Carbonica"})
+
+	if len(rel.Complementary) != 1 || len(rel.Complementary[0].Citations) != 2 {
+		t.Errorf("complementary = %+v, want one neighbour cited twice", rel.Complementary)
+	}
+	if len(rel.Antidote) != 1 || rel.Antidote[0].DocID != "" || rel.Antidote[0].Name != "Wine" {
+		t.Errorf("antidote = %+v", rel.Antidote)
+	}
+	in := rel.Inimical
+	if len(in) != 1 || in[0].Direction != DirectionIn || in[0].DocID != "CALCAREA_CARBONICA" || in[0].Name != "Calcarea Carbonica" {
+		t.Errorf("incoming inimical = %+v, want named by the source document", in)
+	}
+	if c := rel.Compare; len(c) != 1 || c[0].Name != "PSORINUM" {
+		t.Errorf("incoming compare of an unnamed document = %+v, want its ID", c)
+	}
+	if rel.FollowsWell == nil || rel.Count() != 4 {
+		t.Errorf("relationships = %+v", rel)
+	}
+}
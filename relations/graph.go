@@ -0,0 +1,275 @@
+package relations
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/SaiNageswarS/go-api-boot/logger"
+	"github.com/SaiNageswarS/go-api-boot/odm"
+	"github.com/SaiNageswarS/go-collection-boot/async"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/corpus"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/db"
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/tenant"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.uber.org/zap"
+)
+
+// Directions of a neighbour relative to the remedy asked about.
+const (
+	DirectionOut = "out" // the neighbour is named in the remedy's text
+	DirectionIn  = "in"  // the remedy is named in the neighbour's text
+)
+
+const (
+	indexTimeout = time.Minute
+	writeBatch   = 500
+)
+
+// ErrNotFound is returned for remedies not in the knowledge base.
+var ErrNotFound = errors.New("document not found")
+
+// Citation is the passage an edge was read from.
+type Citation struct {
+	DocID   string `json:"doc_id" jsonschema:"Document the passage is in"`
+	NodeID  string `json:"node_id" jsonschema:"Section node ID"`
+	Title   string `json:"title" jsonschema:"Section title"`
+	LineNum int    `json:"line_num" jsonschema:"Line number of the section heading, for fetching its full text"`
+	Excerpt string `json:"excerpt" jsonschema:"The labelled list the remedy is named in"`
+}
+
+// Neighbour is a remedy related to the one asked about, with every passage
+// that relates them in one direction.
+type Neighbour struct {
+	DocID     string     `json:"doc_id,omitempty" jsonschema:"Document ID of the related remedy; empty when it is not in the knowledge base"`
+	Name      string     `json:"name" jsonschema:"The remedy as named in the text, e.g. Calc. carb"`
+	Direction string     `json:"direction" jsonschema:"out: named in this remedy's text; in: this remedy is named in the other's text"`
+	Citations []Citation `json:"citations"`
+}
+
+// Relationships are a remedy's neighbours by relation type.
+type Relationships struct {
+	DocID         string      `json:"doc_id"`
+	Complementary []Neighbour `json:"complementary"`
+	Inimical      []Neighbour `json:"inimical"`
+	Antidote      []Neighbour `json:"antidote"`
+	FollowsWell   []Neighbour `json:"follows_well"`
+	Compare       []Neighbour `json:"compare"`
+}
+
+// Count returns the number of neighbours of all types.
+func (r *Relationships) Count() int {
+	return len(r.Complementary) + len(r.Inimical) + len(r.Antidote) + len(r.FollowsWell) + len(r.Compare)
+}
+
+func (r *Relationships) of(relation string) *[]Neighbour {
+	switch relation {
+	case Complementary:
+		return &r.Complementary
+	case Inimical:
+		return &r.Inimical
+	case Antidote:
+		return &r.Antidote
+	case FollowsWell:
+		return &r.FollowsWell
+	case Compare:
+		return &r.Compare
+	}
+	return nil
+}
+
+// Graph reads and rebuilds the remedy_relationships collection of a corpus.
+type Graph struct {
+	mongo  odm.MongoClient
+	corpus *corpus.Registry
+}
+
+func ProvideGraph(mongo odm.MongoClient, corpus *corpus.Registry, tenants *tenant.Registry) *Graph {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), indexTimeout)
+		defer cancel()
+		for _, database := range tenants.Databases() {
+			if err := odm.EnsureIndexes[db.RemedyRelationModel](ctx, mongo, database); err != nil {
+				logger.Error("Failed to create relationship indexes", zap.String("database", database), zap.Error(err))
+			}
+		}
+	}()
+	return &Graph{mongo: mongo, corpus: corpus}
+}
+
+// Neighbours returns the remedies related to docID in the active corpus of the
+// tenant in ctx, whether named in its text or naming it in theirs.
+func (g *Graph) Neighbours(ctx context.Context, docID string) (*Relationships, error) {
+	database, err := g.corpus.Database(ctx)
+	if err != nil {
+		return nil, err
+	}
+	docs := g.mongo.Database(database).Collection(db.PageIndexDocModel{}.CollectionName())
+	if n, err := docs.CountDocuments(ctx, bson.M{"_id": docID}); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrNotFound
+	}
+
+	repo := odm.CollectionOf[db.RemedyRelationModel](g.mongo, database)
+	edges, err := async.Await(repo.Find(ctx, bson.M{"$or": bson.A{bson.M{"from": docID}, bson.M{"to": docID}}}, bson.D{{Key: "lineNum", Value: 1}}, 0, 0))
+	if err != nil {
+		return nil, err
+	}
+	names, err := sourceNames(ctx, docs, docID, edges)
+	if err != nil {
+		return nil, err
+	}
+	return group(docID, edges, names), nil
+}
+
+// sourceNames returns the names of the documents naming docID, by ID.
+func sourceNames(ctx context.Context, docs *mongo.Collection, docID string, edges []db.RemedyRelationModel) (map[string]string, error) {
+	ids := bson.A{}
+	for _, e := range edges {
+		if e.From != docID {
+			ids = append(ids, e.From)
+		}
+	}
+	names := map[string]string{}
+	if len(ids) == 0 {
+		return names, nil
+	}
+
+	cur, err := docs.Find(ctx, bson.M{"_id": bson.M{"$in": ids}}, options.Find().SetProjection(bson.M{"docName": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var found []db.PageIndexDocModel
+	if err := cur.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	for _, d := range found {
+		names[d.DocID] = d.DocName
+	}
+	return names, nil
+}
+
+// group collects docID's edges into neighbours, one per related remedy and
+// direction, in the order they occur. Remedies naming docID are named by
+// their document's name, from names, or else by its ID.
+func group(docID string, edges []db.RemedyRelationModel, names map[string]string) *Relationships {
+	rel := &Relationships{DocID: docID}
+	for _, t := range Types {
+		*rel.of(t) = []Neighbour{}
+	}
+
+	for _, e := range edges {
+		list := rel.of(e.Relation)
+		if list == nil {
+			continue
+		}
+		n := Neighbour{DocID: e.To, Name: e.Name, Direction: DirectionOut}
+		if e.From != docID {
+			n = Neighbour{DocID: e.From, Name: cmp.Or(names[e.From], e.From), Direction: DirectionIn}
+		}
+		cit := Citation{DocID: e.From, NodeID: e.NodeID, Title: e.Title, LineNum: e.LineNum, Excerpt: e.Excerpt}
+
+		i := slices.IndexFunc(*list, func(x Neighbour) bool {
+			if x.Direction != n.Direction {
+				return false
+			}
+			if n.DocID != "" {
+				return x.DocID == n.DocID
+			}
+			return x.DocID == "" && strings.EqualFold(x.Name, n.Name)
+		})
+		if i < 0 {
+			*list = append(*list, n)
+			i = len(*list) - 1
+		}
+		(*list)[i].Citations = append((*list)[i].Citations, cit)
+	}
+	return rel
+}
+
+// Rebuild extracts the edges of every document in database and replaces the
+// stored ones with them, returning how many there are. Edges are upserted
+// before stale ones are removed, so readers never see an empty graph.
+func (g *Graph) Rebuild(ctx context.Context, database string) (int, error) {
+	if err := odm.EnsureIndexes[db.RemedyRelationModel](ctx, g.mongo, database); err != nil {
+		return 0, err
+	}
+
+	dbh := g.mongo.Database(database)
+	docs := dbh.Collection(db.PageIndexDocModel{}.CollectionName())
+	edges := dbh.Collection(db.RemedyRelationModel{}.CollectionName())
+
+	resolver, err := LoadResolver(ctx, docs)
+	if err != nil {
+		return 0, err
+	}
+
+	// Documents are streamed, as their texts together are the whole corpus.
+	cur, err := docs.Find(ctx, bson.M{})
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+
+	ids := bson.A{}
+	var batch []mongo.WriteModel
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := edges.BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(false))
+		batch = batch[:0]
+		return err
+	}
+	for cur.Next(ctx) {
+		var doc db.PageIndexDocModel
+		if err := cur.Decode(&doc); err != nil {
+			return 0, err
+		}
+		for _, e := range Extract(&doc, resolver) {
+			ids = append(ids, e.ID)
+			batch = append(batch, mongo.NewReplaceOneModel().SetFilter(bson.M{"_id": e.ID}).SetReplacement(e).SetUpsert(true))
+			if len(batch) >= writeBatch {
+				if err := flush(); err != nil {
+					return 0, err
+				}
+			}
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return 0, err
+	}
+	if err := flush(); err != nil {
+		return 0, err
+	}
+
+	if _, err := edges.DeleteMany(ctx, bson.M{"_id": bson.M{"$nin": ids}}); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// LoadResolver returns a resolver for the documents in docs, a pageindex_docs
+// collection.
+func LoadResolver(ctx context.Context, docs *mongo.Collection) (*Resolver, error) {
+	cur, err := docs.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"docName": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var found []db.PageIndexDocModel
+	if err := cur.All(ctx, &found); err != nil {
+		return nil, err
+	}
+
+	names := make([]Remedy, 0, len(found))
+	for _, d := range found {
+		names = append(names, Remedy{ID: d.DocID, Name: d.DocName})
+	}
+	return NewResolver(names), nil
+}
@@ -0,0 +1,142 @@
+// Package tenant resolves which practice's knowledge base a request reads.
+package tenant
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/appconfig"
+)
+
+// defaultTenantID is the single tenant of deployments that define none; its
+// database is the one the API used before tenants existed.
+const defaultTenantID = "devinderhealthcare"
+
+// PathPrefix selects a tenant by URL, e.g. /t/devinderhealthcare/documents.
+const PathPrefix = "/t/"
+
+var (
+	// ErrUnknownTenant is returned for a tenant ID not defined in config.ini.
+	ErrUnknownTenant = errors.New("unknown tenant")
+
+	// ErrTenantMismatch is returned when a path prefix names another tenant
+	// than the one the caller's key may read.
+	ErrTenantMismatch = errors.New("key is not valid for this tenant")
+
+	// ErrNoTenant is returned by data access called without a tenant in the
+	// context. It guards against falling back to another tenant's data.
+	ErrNoTenant = errors.New("no tenant in context")
+)
+
+// Registry holds the tenants defined in config.ini.
+type Registry struct {
+	tenants   map[string]*appconfig.Tenant
+	ids       []string
+	defaultID string
+}
+
+func ProvideRegistry(ccfg *appconfig.AppConfig) *Registry {
+	defaultID := ccfg.DefaultTenant
+	if defaultID == "" {
+		defaultID = defaultTenantID
+	}
+
+	r := &Registry{tenants: map[string]*appconfig.Tenant{}, defaultID: defaultID}
+	for _, t := range ccfg.Tenants {
+		r.tenants[t.ID] = &t
+		r.ids = append(r.ids, t.ID)
+	}
+	if _, ok := r.tenants[defaultID]; !ok {
+		r.tenants[defaultID] = &appconfig.Tenant{ID: defaultID, Name: defaultID, Database: defaultID}
+		r.ids = append(r.ids, defaultID)
+	}
+	slices.Sort(r.ids)
+	return r
+}
+
+// Get returns the tenant with the given ID.
+func (r *Registry) Get(id string) (*appconfig.Tenant, bool) {
+	t, ok := r.tenants[id]
+	return t, ok
+}
+
+// Resolve picks the tenant of a request: the one the key is bound to, else the
+// default. A path prefix (requested) may only name that tenant, except for an
+// admin key bound to none, which may name any. Unbound keys include the
+// API_KEY of the environment and keys issued before tenants existed, so they
+// must not reach other practices' data.
+func (r *Registry) Resolve(requested, bound string, admin bool) (*appconfig.Tenant, error) {
+	own := cmp.Or(bound, r.defaultID)
+	if requested != "" && requested != own && (bound != "" || !admin) {
+		return nil, ErrTenantMismatch
+	}
+
+	id := cmp.Or(requested, own)
+	t, ok := r.tenants[id]
+	if !ok {
+		return nil, ErrUnknownTenant
+	}
+	return t, nil
+}
+
+// Default returns the tenant of keys and requests that name none.
+func (r *Registry) Default() *appconfig.Tenant {
+	return r.tenants[r.defaultID]
+}
+
+// List returns every tenant, sorted by ID.
+func (r *Registry) List() []*appconfig.Tenant {
+	out := make([]*appconfig.Tenant, 0, len(r.ids))
+	for _, id := range r.ids {
+		out = append(out, r.tenants[id])
+	}
+	return out
+}
+
+// Databases returns the distinct tenant databases.
+func (r *Registry) Databases() []string {
+	var dbs []string
+	for _, t := range r.List() {
+		if !slices.Contains(dbs, t.Database) {
+			dbs = append(dbs, t.Database)
+		}
+	}
+	return dbs
+}
+
+type tenantKey struct{}
+type requestedKey struct{}
+
+// WithTenant returns ctx carrying the resolved tenant.
+func WithTenant(ctx context.Context, t *appconfig.Tenant) context.Context {
+	return context.WithValue(ctx, tenantKey{}, t)
+}
+
+// FromContext returns the tenant resolved for the request.
+func FromContext(ctx context.Context) (*appconfig.Tenant, bool) {
+	t, ok := ctx.Value(tenantKey{}).(*appconfig.Tenant)
+	return t, ok && t != nil
+}
+
+// Database returns the database of the request's tenant.
+func Database(ctx context.Context) (string, error) {
+	t, ok := FromContext(ctx)
+	if !ok {
+		return "", ErrNoTenant
+	}
+	return t.Database, nil
+}
+
+// WithRequested records the tenant named by the path prefix, before it is
+// checked against the caller's key.
+func WithRequested(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestedKey{}, id)
+}
+
+// Requested returns the tenant ID from the path prefix, if any.
+func Requested(ctx context.Context) string {
+	id, _ := ctx.Value(requestedKey{}).(string)
+	return id
+}
@@ -0,0 +1,46 @@
+package tenant
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/SaiNageswarS/medicine-rag-custom-gpt/appconfig"
+)
+
+func TestResolve(t *testing.T) {
+	r := ProvideRegistry(&appconfig.AppConfig{
+		DefaultTenant: "devinderhealthcare",
+		Tenants:       []appconfig.Tenant{{ID: "devinderhealthcare"}, {ID: "otherclinic"}},
+	})
+
+	tests := []struct {
+		name      string
+		requested string
+		bound     string
+		admin     bool
+		want      string
+		wantErr   error
+	}{
+		{"unbound", "", "", false, "devinderhealthcare", nil},
+		{"unbound, default prefix", "devinderhealthcare", "", false, "devinderhealthcare", nil},
+		{"unbound, other prefix", "otherclinic", "", false, "", ErrTenantMismatch},
+		{"unbound admin, other prefix", "otherclinic", "", true, "otherclinic", nil},
+		{"unbound admin, unknown prefix", "nosuchclinic", "", true, "", ErrUnknownTenant},
+		{"bound", "", "otherclinic", false, "otherclinic", nil},
+		{"bound, own prefix", "otherclinic", "otherclinic", false, "otherclinic", nil},
+		{"bound, default prefix", "devinderhealthcare", "otherclinic", false, "", ErrTenantMismatch},
+		{"bound admin, other prefix", "devinderhealthcare", "otherclinic", true, "", ErrTenantMismatch},
+		{"bound to an unknown tenant", "", "nosuchclinic", false, "", ErrUnknownTenant},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Resolve(tt.requested, tt.bound, tt.admin)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Resolve = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got.ID != tt.want {
+				t.Errorf("Resolve = %s, want %s", got.ID, tt.want)
+			}
+		})
+	}
+}